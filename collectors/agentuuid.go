@@ -3,13 +3,14 @@ package collectors
 import (
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"fmt"
 	"time"
 )
 
 // UUIDCollector collects a unique UUID for the system
-func UUIDCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("agent_uuid", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+func UUIDCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector("agent_uuid", ttl, func(ctx context.Context) (any, error) {
 		// Retrieve the UUID from the file or create a new one if it doesn't exist
 		uuid, err := common.GetOrCreateUUID()
 		if err != nil {
@@ -18,5 +19,5 @@ func UUIDCollector(ttl time.Duration, config *configuration.Config) *Collector {
 
 		// Return the UUID directly
 		return uuid, nil
-	})
+	}))
 }
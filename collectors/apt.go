@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"log/slog"
 	"regexp"
 	"runtime"
@@ -19,38 +20,53 @@ type AptUpdateInfo struct {
 	IsSecurityUpdate bool   `json:"is_security_update"`
 }
 
-// AptUpdatesCollector returns a collector for available APT updates on Ubuntu systems
-func AptUpdatesCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("apt", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
-		if runtime.GOOS != "linux" {
-			return nil, ErrCollectorSkipped
-		}
+// aptCollector gathers available APT updates
+type aptCollector struct {
+	ttl time.Duration
+	run commandRunner
+}
 
-		// Get the list of upgradable packages
-		results, _, exitCode, err := common.RunCommand("apt list --upgradable", &common.CommandOptions{
-			Timeout: 10,
-		})
-		if err != nil || exitCode != 0 {
-			return nil, err
-		}
+func (a *aptCollector) Name() string              { return "apt" }
+func (a *aptCollector) DefaultTTL() time.Duration { return a.ttl }
+
+// Collect lists upgradable packages and flags the ones coming from a security pocket
+func (a *aptCollector) Collect(ctx context.Context) (any, error) {
+	if runtime.GOOS != "linux" {
+		return nil, ErrCollectorSkipped
+	}
+
+	// Get the list of upgradable packages
+	results, _, exitCode, err := a.run(ctx, "apt list --upgradable", &common.CommandOptions{
+		Timeout: 10,
+	})
+	if err != nil || exitCode != 0 {
+		return nil, err
+	}
+
+	// Parse the apt output
+	updates, err := parseAptUpdates(results)
+	if err != nil {
+		return nil, err
+	}
 
-		// Parse the apt output
-		updates, err := parseAptUpdates(results)
-		if err != nil {
+	// For each package, determine if it is a security update
+	for i, update := range updates {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
+		updates[i].IsSecurityUpdate = a.isSecurityUpdate(ctx, update.PackageName)
+	}
 
-		// For each package, determine if it is a security update
-		for i, update := range updates {
-			updates[i].IsSecurityUpdate = isSecurityUpdate(update.PackageName)
-		}
+	// Create the final data structure to return
+	return map[string]interface{}{
+		"available_updates": updates,
+		"collected_at":      time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
 
-		// Create the final data structure to return
-		return map[string]interface{}{
-			"available_updates": updates,
-			"collected_at":      time.Now().UTC().Format(time.RFC3339),
-		}, nil
-	})
+// AptUpdatesCollector returns a collector for available APT updates on Ubuntu systems
+func AptUpdatesCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(&aptCollector{ttl: ttl, run: common.RunCommandContext})
 }
 
 func parseAptUpdates(output string) ([]AptUpdateInfo, error) {
@@ -86,9 +102,9 @@ func parseAptUpdates(output string) ([]AptUpdateInfo, error) {
 }
 
 // isSecurityUpdate determines if a package is a security update
-func isSecurityUpdate(packageName string) bool {
+func (a *aptCollector) isSecurityUpdate(ctx context.Context, packageName string) bool {
 	// Run command to check if the package is in the security updates list
-	output, _, exitCode, err := common.RunCommand("apt-cache policy "+packageName, &common.CommandOptions{
+	output, _, exitCode, err := a.run(ctx, "apt-cache policy "+packageName, &common.CommandOptions{
 		Timeout: 30,
 	})
 	if err != nil || exitCode != 0 {
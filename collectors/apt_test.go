@@ -1,8 +1,13 @@
 package collectors
 
 import (
+	"cartographer-go-agent/common"
+	"context"
+	"errors"
 	"reflect"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestParseAptUpdates(t *testing.T) {
@@ -51,3 +56,67 @@ wazuh-agent/stable 4.9.1-1 amd64 [upgradable from: 4.9.0-1]`
 		t.Errorf("Expected: %+v, got: %+v", expected, updates)
 	}
 }
+
+func TestAptCollectorWithFakeRunner(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("apt collector only runs on linux")
+	}
+
+	var commands []string
+	a := &aptCollector{
+		ttl: time.Minute,
+		run: func(ctx context.Context, command string, options *common.CommandOptions) (string, string, int, error) {
+			commands = append(commands, command)
+			switch command {
+			case "apt list --upgradable":
+				return "Listing... Done\nopenssl/jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]\ncurl/jammy 7.81.0-1ubuntu1.16 amd64 [upgradable from: 7.81.0-1ubuntu1.15]", "", 0, nil
+			case "apt-cache policy openssl":
+				return "500 http://archive.ubuntu.com/ubuntu jammy-security/main amd64 Packages", "", 0, nil
+			default:
+				return "500 http://archive.ubuntu.com/ubuntu jammy-updates/main amd64 Packages", "", 0, nil
+			}
+		},
+	}
+
+	data, err := a.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updates := data.(map[string]interface{})["available_updates"].([]AptUpdateInfo)
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(updates))
+	}
+	if !updates[0].IsSecurityUpdate || updates[1].IsSecurityUpdate {
+		t.Errorf("expected only openssl to be a security update, got %+v", updates)
+	}
+	if len(commands) != 3 {
+		t.Errorf("expected 3 commands, got %v", commands)
+	}
+}
+
+func TestAptCollectorStopsWhenCancelled(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("apt collector only runs on linux")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policyCalls := 0
+	a := &aptCollector{
+		ttl: time.Minute,
+		run: func(ctx context.Context, command string, options *common.CommandOptions) (string, string, int, error) {
+			if command == "apt list --upgradable" {
+				return "pkg-a/jammy 2 amd64 [upgradable from: 1]\npkg-b/jammy 2 amd64 [upgradable from: 1]", "", 0, nil
+			}
+			policyCalls++
+			cancel()
+			return "", "", 0, nil
+		},
+	}
+
+	if _, err := a.Collect(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if policyCalls != 1 {
+		t.Errorf("expected collection to stop after cancellation, got %d policy calls", policyCalls)
+	}
+}
@@ -3,6 +3,7 @@ package collectors
 import (
 	"bufio"
 	"cartographer-go-agent/configuration"
+	"context"
 	"log/slog"
 	"os"
 	"regexp"
@@ -18,8 +19,8 @@ type SSHLoginEvent struct {
 	SourceIP string `json:"source_ip"`
 }
 
-// parseSSHLogins parses the SSH logins from the given log file
-func parseSSHLogins(logFile string) ([]SSHLoginEvent, error) {
+// parseSSHLogins parses the SSH logins from the given log file, giving up when ctx is done
+func parseSSHLogins(ctx context.Context, logFile string) ([]SSHLoginEvent, error) {
 	file, err := os.Open(logFile)
 	if err != nil {
 		return nil, err
@@ -50,6 +51,9 @@ func parseSSHLogins(logFile string) ([]SSHLoginEvent, error) {
 	mostRecentLogins := make(map[string]SSHLoginEvent)
 
 	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		line := scanner.Text()
 		matches := regex.FindStringSubmatch(line)
 		if matches != nil {
@@ -110,17 +114,17 @@ func parseEventTime(event SSHLoginEvent) time.Time {
 }
 
 // SSHLoginEventsCollector returns a collector that gathers SSH login events, only on Linux systems
-func SSHLoginEventsCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("ssh_login_events", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+func SSHLoginEventsCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector("ssh_login_events", ttl, func(ctx context.Context) (any, error) {
 		if runtime.GOOS != "linux" {
 			return nil, ErrCollectorSkipped
 		}
 
-		events, err := parseSSHLogins("/var/log/auth.log")
+		events, err := parseSSHLogins(ctx, "/var/log/auth.log")
 		if err != nil {
 			return nil, err
 		}
 
 		return events, nil
-	})
+	}))
 }
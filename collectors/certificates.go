@@ -0,0 +1,206 @@
+package collectors
+
+import (
+	"cartographer-go-agent/common"
+	"cartographer-go-agent/configuration"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CertificateSite is an nginx server block that uses a certificate
+type CertificateSite struct {
+	ServerNames []string `json:"server_names"`
+	ListenPorts []string `json:"listen_ports"`
+	ConfigFile  string   `json:"config_file"`
+}
+
+// CertificateInfo describes the first certificate in a PEM file, and where it is used
+type CertificateInfo struct {
+	Path               string            `json:"path"`
+	Subject            string            `json:"subject,omitempty"`
+	Issuer             string            `json:"issuer,omitempty"`
+	SerialNumber       string            `json:"serial_number,omitempty"`
+	DNSNames           []string          `json:"dns_names,omitempty"`
+	IPAddresses        []string          `json:"ip_addresses,omitempty"`
+	NotBefore          string            `json:"not_before,omitempty"`
+	NotAfter           string            `json:"not_after,omitempty"`
+	DaysRemaining      int               `json:"days_remaining"`
+	Expired            bool              `json:"expired"`
+	KeyType            string            `json:"key_type,omitempty"`
+	KeyBits            int               `json:"key_bits,omitempty"`
+	SignatureAlgorithm string            `json:"signature_algorithm,omitempty"`
+	FingerprintSHA256  string            `json:"fingerprint_sha256,omitempty"`
+	ChainLength        int               `json:"chain_length"` // certificates in the file, the leaf included
+	Sites              []CertificateSite `json:"nginx_sites,omitempty"`
+	Error              string            `json:"error,omitempty"` // set when a file nginx references can't be read
+}
+
+// certificatesCollector inventories certificates on disk and the nginx sites using them
+type certificatesCollector struct {
+	ttl        time.Duration
+	paths      []string
+	nginxSites func(ctx context.Context) []NginxSite
+	now        func() time.Time
+}
+
+func (c *certificatesCollector) Name() string              { return "certificates" }
+func (c *certificatesCollector) DefaultTTL() time.Duration { return c.ttl }
+
+// Collect parses the certificates matching the configured globs and those referenced by
+// nginx ssl_certificate directives, soonest to expire first
+func (c *certificatesCollector) Collect(ctx context.Context) (any, error) {
+	certs := make(map[string]*CertificateInfo)
+
+	for _, pattern := range c.paths {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			slog.Debug("Invalid certificate path pattern", slog.String("pattern", pattern), slog.String("error", err.Error()))
+			continue
+		}
+		for _, path := range matches {
+			// Keyed like the nginx paths below, so a file is listed once however it was matched
+			path = filepath.Clean(path)
+			if _, ok := certs[path]; ok {
+				continue
+			}
+			if info, err := c.readCertificate(path); err == nil {
+				certs[path] = info
+			} else {
+				// Globs also match private keys and other PEM files
+				slog.Debug("Skipping certificate file", slog.String("path", path), slog.String("error", err.Error()))
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, site := range c.nginxSites(ctx) {
+		for _, path := range site.SSLCertificates {
+			// Paths built from variables are only known per request
+			if strings.Contains(path, "$") || strings.HasPrefix(path, "data:") {
+				continue
+			}
+			path = filepath.Clean(path)
+			info, ok := certs[path]
+			if !ok {
+				var err error
+				if info, err = c.readCertificate(path); err != nil {
+					info = &CertificateInfo{Path: path, Error: err.Error()}
+				}
+				certs[path] = info
+			}
+			info.Sites = append(info.Sites, CertificateSite{
+				ServerNames: site.ServerNames,
+				ListenPorts: site.ListenPorts,
+				ConfigFile:  site.ConfigFile,
+			})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, ErrCollectorSkipped
+	}
+
+	inventory := make([]CertificateInfo, 0, len(certs))
+	for _, info := range certs {
+		inventory = append(inventory, *info)
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].NotAfter != inventory[j].NotAfter {
+			return inventory[i].NotAfter < inventory[j].NotAfter
+		}
+		return inventory[i].Path < inventory[j].Path
+	})
+	return inventory, nil
+}
+
+// CertificatesCollector returns a collector that inventories certificates and links them
+// to the nginx sites that use them
+func CertificatesCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(&certificatesCollector{
+		ttl:        ttl,
+		paths:      config.GetCertificatePaths(),
+		nginxSites: configuredNginxSites,
+		now:        time.Now,
+	})
+}
+
+// configuredNginxSites parses the sites of an installed nginx, whether or not it is running
+func configuredNginxSites(ctx context.Context) []NginxSite {
+	nginxPath := findNginxBinary()
+	if nginxPath == "" {
+		return nil
+	}
+	n := &nginxCollector{run: common.RunCommandContext}
+	configPath := n.getNginxConfigPath(ctx, nginxPath)
+	if configPath == "" {
+		return nil
+	}
+	sites, err := parseNginxSites(configPath)
+	if err != nil {
+		slog.Warn("Failed to parse nginx sites", slog.String("error", err.Error()))
+		return nil
+	}
+	return sites
+}
+
+// readCertificate parses the first certificate in a PEM file and counts the rest
+func (c *certificatesCollector) readCertificate(path string) (*CertificateInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errNoCertificate
+	}
+
+	leaf := chain[0]
+	keyType, keyBits := common.PublicKeyInfo(leaf)
+	remaining := leaf.NotAfter.Sub(c.now())
+	info := &CertificateInfo{
+		Path:               path,
+		Subject:            leaf.Subject.String(),
+		Issuer:             leaf.Issuer.String(),
+		SerialNumber:       leaf.SerialNumber.Text(16),
+		DNSNames:           leaf.DNSNames,
+		NotBefore:          leaf.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:           leaf.NotAfter.UTC().Format(time.RFC3339),
+		DaysRemaining:      int(remaining.Hours() / 24),
+		Expired:            remaining < 0,
+		KeyType:            keyType,
+		KeyBits:            keyBits,
+		SignatureAlgorithm: leaf.SignatureAlgorithm.String(),
+		FingerprintSHA256:  common.CertificateFingerprint(leaf),
+		ChainLength:        len(chain),
+	}
+	for _, ip := range leaf.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info, nil
+}
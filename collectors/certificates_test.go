@@ -0,0 +1,171 @@
+package collectors
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var certTestNow = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// writeTestCertificate writes a self-signed certificate for name expiring at notAfter,
+// followed by extra copies to stand in for a chain
+func writeTestCertificate(t *testing.T, path, name string, notAfter time.Time, chain int) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name, "www." + name},
+		IPAddresses:  []net.IP{net.ParseIP("192.0.2.1")},
+		NotBefore:    notAfter.AddDate(0, -3, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for range 1 + chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificatesCollector(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificate(t, filepath.Join(dir, "app.crt"), "app.example.com", certTestNow.AddDate(0, 0, 60), 0)
+	writeTestCertificate(t, filepath.Join(dir, "fullchain.pem"), "example.com", certTestNow.AddDate(0, 0, 10), 1)
+	writeTestCertificate(t, filepath.Join(dir, "old.pem"), "old.example.com", certTestNow.AddDate(0, 0, -2), 0)
+
+	// A private key matched by the glob is skipped
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keyDER, _ := x509.MarshalECPrivateKey(ecKey)
+	if err := os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sites := []NginxSite{
+		{
+			ServerNames:     []string{"example.com", "www.example.com"},
+			ListenPorts:     []string{"443 ssl"},
+			ConfigFile:      "/etc/nginx/sites-enabled/example",
+			SSLCertificates: []string{filepath.Join(dir, "fullchain.pem")},
+		},
+		{
+			ServerNames:     []string{"missing.example.com"},
+			ListenPorts:     []string{"443 ssl"},
+			ConfigFile:      "/etc/nginx/sites-enabled/missing",
+			SSLCertificates: []string{filepath.Join(dir, "missing.pem"), "/etc/ssl/$ssl_server_name.crt"},
+		},
+	}
+	collector := &certificatesCollector{
+		paths:      []string{filepath.Join(dir, "*.pem"), filepath.Join(dir, "*.crt")},
+		nginxSites: func(ctx context.Context) []NginxSite { return sites },
+		now:        func() time.Time { return certTestNow },
+	}
+
+	data, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	inventory := data.([]CertificateInfo)
+
+	var paths []string
+	for _, cert := range inventory {
+		paths = append(paths, filepath.Base(cert.Path))
+	}
+	// The unreadable file sorts first, then soonest to expire
+	if want := []string{"missing.pem", "old.pem", "fullchain.pem", "app.crt"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("inventory paths = %v, want %v", paths, want)
+	}
+
+	missing, old, fullchain, app := inventory[0], inventory[1], inventory[2], inventory[3]
+	if missing.Error == "" || len(missing.Sites) != 1 || missing.Sites[0].ConfigFile != "/etc/nginx/sites-enabled/missing" {
+		t.Errorf("unexpected entry for a missing file: %+v", missing)
+	}
+	if !old.Expired || old.DaysRemaining != -2 {
+		t.Errorf("old.pem expired = %v, days remaining = %d", old.Expired, old.DaysRemaining)
+	}
+	if fullchain.ChainLength != 2 || fullchain.DaysRemaining != 10 || fullchain.Expired {
+		t.Errorf("unexpected fullchain.pem entry: %+v", fullchain)
+	}
+	wantSites := []CertificateSite{{ServerNames: []string{"example.com", "www.example.com"}, ListenPorts: []string{"443 ssl"}, ConfigFile: "/etc/nginx/sites-enabled/example"}}
+	if !reflect.DeepEqual(fullchain.Sites, wantSites) {
+		t.Errorf("fullchain.pem sites = %+v, want %+v", fullchain.Sites, wantSites)
+	}
+	if app.Subject != "CN=app.example.com" || app.Issuer != "CN=app.example.com" || app.SerialNumber != "2a" {
+		t.Errorf("unexpected app.crt names: %+v", app)
+	}
+	if !reflect.DeepEqual(app.DNSNames, []string{"app.example.com", "www.app.example.com"}) || !reflect.DeepEqual(app.IPAddresses, []string{"192.0.2.1"}) {
+		t.Errorf("unexpected app.crt SANs: %v %v", app.DNSNames, app.IPAddresses)
+	}
+	if app.KeyType != "RSA" || app.KeyBits != 2048 || app.SignatureAlgorithm != "SHA256-RSA" || len(app.FingerprintSHA256) != 64 {
+		t.Errorf("unexpected app.crt key: %+v", app)
+	}
+	if app.NotAfter != "2026-07-31T12:00:00Z" || len(app.Sites) != 0 {
+		t.Errorf("unexpected app.crt expiry or sites: %+v", app)
+	}
+}
+
+func TestCertificatesCollectorCleansGlobMatches(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live", "example.com")
+	if err := os.MkdirAll(live, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestCertificate(t, filepath.Join(live, "fullchain.pem"), "example.com", certTestNow.AddDate(0, 0, 30), 0)
+
+	site := NginxSite{
+		ServerNames:     []string{"example.com"},
+		ConfigFile:      "/etc/nginx/sites-enabled/example",
+		SSLCertificates: []string{filepath.Join(live, "fullchain.pem")},
+	}
+	collector := &certificatesCollector{
+		// Unclean patterns, both matching the file nginx references
+		paths:      []string{dir + "/live//*/fullchain.pem", dir + "/live/*/../*/fullchain.pem"},
+		nginxSites: func(ctx context.Context) []NginxSite { return []NginxSite{site} },
+		now:        func() time.Time { return certTestNow },
+	}
+
+	data, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	inventory := data.([]CertificateInfo)
+	if len(inventory) != 1 {
+		t.Fatalf("expected one entry for the file, got %+v", inventory)
+	}
+	if inventory[0].Path != filepath.Join(live, "fullchain.pem") || len(inventory[0].Sites) != 1 {
+		t.Errorf("expected the clean path linked to its site, got %+v", inventory[0])
+	}
+}
+
+func TestCertificatesCollectorSkipsWithoutCertificates(t *testing.T) {
+	collector := &certificatesCollector{
+		paths:      []string{filepath.Join(t.TempDir(), "*.pem")},
+		nginxSites: func(ctx context.Context) []NginxSite { return nil },
+		now:        time.Now,
+	}
+	if _, err := collector.Collect(context.Background()); !errors.Is(err, ErrCollectorSkipped) {
+		t.Errorf("Collect() error = %v, want ErrCollectorSkipped", err)
+	}
+}
@@ -1,106 +1,376 @@
 package collectors
 
 import (
+	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"sync"
 	"time"
 )
 
 // CollectorStatus represents the outcome of a collector's most recent execution
 type CollectorStatus struct {
-	Status   string  `json:"status"`             // "ok", "error", "skipped"
-	Error    string  `json:"error,omitempty"`    // error message if status is "error"
+	Status   string  `json:"status"`             // "ok", "error", "skipped", "timeout"
+	Error    string  `json:"error,omitempty"`    // error message if status is "error" or "timeout"
 	Duration float64 `json:"duration_ms"`        // execution time in milliseconds
 	Cached   bool    `json:"cached,omitempty"`   // true if result was served from cache
+	Stale    bool    `json:"stale,omitempty"`    // true if an expired cached result was served after a timeout
 	LastRun  string  `json:"last_run,omitempty"` // timestamp of last successful collection
 }
 
-// Collector is a struct that represents a collector
-type Collector struct {
-	Name       string
-	CollectFn  func(config *configuration.Config) (interface{}, error)
-	data       interface{}
+// Collector is a source of inventory data. Implementations should return
+// promptly with ctx.Err() once ctx is done.
+type Collector interface {
+	// Name is the key the collected data is reported under
+	Name() string
+	// Collect gathers the data; return ErrCollectorSkipped if it doesn't apply to this host
+	Collect(ctx context.Context) (any, error)
+	// DefaultTTL is how long a successful result may be served from cache
+	DefaultTTL() time.Duration
+}
+
+// funcCollector adapts a plain function to the Collector interface
+type funcCollector struct {
+	name string
+	ttl  time.Duration
+	fn   func(ctx context.Context) (any, error)
+}
+
+func (f *funcCollector) Name() string                             { return f.name }
+func (f *funcCollector) DefaultTTL() time.Duration                { return f.ttl }
+func (f *funcCollector) Collect(ctx context.Context) (any, error) { return f.fn(ctx) }
+
+// FuncCollector returns a Collector that calls fn to gather data
+func FuncCollector(name string, ttl time.Duration, fn func(ctx context.Context) (any, error)) Collector {
+	return &funcCollector{name: name, ttl: ttl, fn: fn}
+}
+
+// CachedCollector wraps a Collector with TTL caching, deadlines, panic recovery and
+// status tracking. It is safe for concurrent use and itself implements Collector.
+type CachedCollector struct {
+	source Collector
+
+	// Timeout bounds each collection. A collection is shared by every caller waiting on it,
+	// so it isn't cancelled when a caller gives up; with zero Timeout it runs until the
+	// source returns.
+	Timeout time.Duration
+	// ServeStale returns the last cached value (even if expired) when a collection times out.
+	ServeStale bool
+
+	mu         sync.Mutex
+	data       any
 	lastUpdate time.Time
 	ttl        time.Duration
-	Config     *configuration.Config
-	LastStatus CollectorStatus
-}
-
-// NewCollector creates a new collector with the given name, ttl, configuration, and collection function
-func NewCollector(name string, ttl time.Duration, config *configuration.Config, collectFn func(config *configuration.Config) (interface{}, error)) *Collector {
-	return &Collector{
-		Name:      name,
-		ttl:       ttl,
-		CollectFn: collectFn,
-		Config:    config,
-		data:      nil,
+	lastStatus CollectorStatus
+	inFlight   *collectRun
+	now        func() time.Time
+	store      *DiskCache
+}
+
+// collectRun tracks a single in-progress execution of the source collector
+type collectRun struct {
+	done  chan struct{}
+	start time.Time
+	data  any
+	err   error
+	// status is the status recorded by finish, so waiters don't read a lastStatus that
+	// a later run or cache hit has since replaced
+	status CollectorStatus
+}
+
+// NewCachedCollector wraps source, caching its results for source.DefaultTTL()
+func NewCachedCollector(source Collector) *CachedCollector {
+	return &CachedCollector{
+		source: source,
+		ttl:    source.DefaultTTL(),
+		now:    time.Now,
 	}
 }
 
+// NewCollector creates a new collector with the given name, ttl, configuration, and collection function.
+// It adapts functions written before Collector took a context; prefer FuncCollector for new code.
+func NewCollector(name string, ttl time.Duration, config *configuration.Config, collectFn func(config *configuration.Config) (interface{}, error)) *CachedCollector {
+	return NewCachedCollector(FuncCollector(name, ttl, func(ctx context.Context) (any, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return collectFn(config)
+	}))
+}
+
+// Name returns the name of the wrapped collector
+func (c *CachedCollector) Name() string {
+	return c.source.Name()
+}
+
+// DefaultTTL returns the cache TTL in use
+func (c *CachedCollector) DefaultTTL() time.Duration {
+	return c.ttl
+}
+
+// Status returns the outcome of the collector's most recent execution
+func (c *CachedCollector) Status() CollectorStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastStatus
+}
+
+// Idle returns a channel that is closed once no collection is running. Callers
+// that gave up on a timed-out collection use it to learn when the source has
+// actually returned.
+func (c *CachedCollector) Idle() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight != nil {
+		return c.inFlight.done
+	}
+	idle := make(chan struct{})
+	close(idle)
+	return idle
+}
+
 // Collect collects the data from the collector, with panic recovery to prevent
 // a single collector from crashing the entire agent.
-func (c *Collector) Collect() (data interface{}, err error) {
-	start := time.Now()
+func (c *CachedCollector) Collect(ctx context.Context) (any, error) {
+	data, _, err := c.CollectStatus(ctx)
+	return data, err
+}
+
+// CollectStatus is like Collect but also returns the status recorded for this call,
+// so concurrent callers don't race on Status().
+//
+// If a previous collection is still running, CollectStatus waits on that run
+// instead of starting a second one.
+func (c *CachedCollector) CollectStatus(ctx context.Context) (any, CollectorStatus, error) {
+	return c.collect(ctx, true)
+}
+
+// Refresh is like CollectStatus but ignores the TTL, so the source always runs
+// unless a collection is already in progress, in which case it waits on that one.
+func (c *CachedCollector) Refresh(ctx context.Context) (any, CollectorStatus, error) {
+	return c.collect(ctx, false)
+}
+
+func (c *CachedCollector) collect(ctx context.Context, useCache bool) (any, CollectorStatus, error) {
+	c.mu.Lock()
+	if useCache && !c.lastUpdate.IsZero() && c.now().Sub(c.lastUpdate) < c.ttl {
+		slog.Debug("Using cached data for collector", slog.String("collector", c.Name()))
+		c.lastStatus = CollectorStatus{
+			Status:  "ok",
+			Cached:  true,
+			LastRun: c.lastUpdate.UTC().Format(time.RFC3339),
+		}
+		data, status := c.data, c.lastStatus
+		c.mu.Unlock()
+		return data, status, nil
+	}
+
+	timeout := c.Timeout
+	run := c.inFlight
+	if run == nil {
+		slog.Debug("Running collection for collector", slog.String("collector", c.Name()))
+		// The run is shared, so it isn't cancelled with this caller; each waiter gives up
+		// on its own context below
+		runCtx, cancel := withOptionalTimeout(context.WithoutCancel(ctx), timeout)
+		run = &collectRun{done: make(chan struct{}), start: c.now()}
+		c.inFlight = run
+		go c.execute(runCtx, cancel, run)
+	} else {
+		slog.Debug("Waiting on in-flight collection for collector", slog.String("collector", c.Name()))
+	}
+	c.mu.Unlock()
+
+	// Wait on our own deadline too, in case the source ignores its context
+	waitCtx, cancel := withOptionalTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case <-run.done:
+		if errors.Is(run.err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return c.timedOut(timeout)
+		}
+		if run.err != nil {
+			return nil, run.status, run.err
+		}
+		return run.data, run.status, nil
+	case <-waitCtx.Done():
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return c.cancelled(ctx.Err())
+		}
+		return c.timedOut(timeout)
+	}
+}
+
+// execute runs the source collector for the given run, updating the cache and status when it finishes.
+func (c *CachedCollector) execute(ctx context.Context, cancel context.CancelFunc, run *collectRun) {
+	defer close(run.done)
+	defer cancel()
 
 	// Recover from panics in collector functions
 	defer func() {
 		if r := recover(); r != nil {
-			elapsed := time.Since(start)
-			err = fmt.Errorf("collector panicked: %v", r)
-			data = nil
-			c.LastStatus = CollectorStatus{
-				Status:   "error",
-				Error:    err.Error(),
-				Duration: float64(elapsed.Milliseconds()),
-			}
+			run.data = nil
+			run.err = fmt.Errorf("collector panicked: %v", r)
+			c.finish(run)
 			slog.Error("Collector panicked",
-				slog.String("collector", c.Name),
-				slog.String("error", err.Error()),
+				slog.String("collector", c.Name()),
+				slog.String("error", run.err.Error()),
 			)
 		}
 	}()
 
-	if !c.lastUpdate.IsZero() && time.Since(c.lastUpdate) < c.ttl {
-		slog.Debug("Using cached data for collector", slog.String("collector", c.Name))
-		c.LastStatus = CollectorStatus{
-			Status:  "ok",
-			Cached:  true,
-			LastRun: c.lastUpdate.UTC().Format(time.RFC3339),
-		}
-		return c.data, nil
-	}
+	run.data, run.err = c.source.Collect(ctx)
+	c.finish(run)
+}
 
-	slog.Debug("Running collection for collector", slog.String("collector", c.Name))
-	collectedData, err := c.CollectFn(c.Config)
-	elapsed := time.Since(start)
+// finish records the outcome of a completed run and persists it if a disk cache is attached
+func (c *CachedCollector) finish(run *collectRun) {
+	elapsed := c.now().Sub(run.start)
 
-	if err != nil {
-		if errors.Is(err, ErrCollectorSkipped) {
-			c.LastStatus = CollectorStatus{
+	c.mu.Lock()
+	c.inFlight = nil
+
+	if run.err != nil {
+		switch {
+		case errors.Is(run.err, ErrCollectorSkipped):
+			c.lastStatus = CollectorStatus{
 				Status:   "skipped",
 				Duration: float64(elapsed.Milliseconds()),
 			}
-			return nil, err
+		case errors.Is(run.err, context.DeadlineExceeded):
+			// The waiting callers record the timeout
+			c.mu.Unlock()
+			return
+		default:
+			c.lastStatus = CollectorStatus{
+				Status:   "error",
+				Error:    run.err.Error(),
+				Duration: float64(elapsed.Milliseconds()),
+			}
 		}
-		c.LastStatus = CollectorStatus{
-			Status:   "error",
-			Error:    err.Error(),
+	} else {
+		// Update the cache
+		c.data = run.data
+		c.lastUpdate = c.now()
+
+		c.lastStatus = CollectorStatus{
+			Status:   "ok",
 			Duration: float64(elapsed.Milliseconds()),
+			LastRun:  c.lastUpdate.UTC().Format(time.RFC3339),
 		}
-		return nil, err
 	}
 
-	// Update the cache
-	c.data = collectedData
-	c.lastUpdate = time.Now()
+	run.status = c.lastStatus
+	store, data, lastUpdate, status := c.store, c.data, c.lastUpdate, c.lastStatus
+	c.mu.Unlock()
 
-	c.LastStatus = CollectorStatus{
-		Status:   "ok",
-		Duration: float64(elapsed.Milliseconds()),
-		LastRun:  c.lastUpdate.UTC().Format(time.RFC3339),
+	// Only persist once there is a successful result worth restoring
+	if store != nil && !lastUpdate.IsZero() {
+		if err := store.Save(c.Name(), data, lastUpdate, status); err != nil {
+			slog.Warn("Failed to persist collector cache",
+				slog.String("collector", c.Name()),
+				slog.String("error", err.Error()),
+			)
+		}
 	}
+}
 
-	return c.data, nil
+// SetOptions updates Timeout and ServeStale. Unlike assigning the fields directly, it is
+// safe to call while a collection is running.
+func (c *CachedCollector) SetOptions(timeout time.Duration, serveStale bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Timeout = timeout
+	c.ServeStale = serveStale
 }
+
+// AttachCache persists this collector's results to store and restores the last
+// saved result, so a restart within the TTL doesn't trigger a fresh collection.
+// Restored data is held as raw JSON.
+func (c *CachedCollector) AttachCache(store *DiskCache) {
+	c.mu.Lock()
+	c.store = store
+	c.mu.Unlock()
+
+	entry, err := store.Load(c.Name())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to load collector cache",
+				slog.String("collector", c.Name()),
+				slog.String("error", err.Error()),
+			)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastUpdate.IsZero() {
+		return // already collected in this process; keep the newer result
+	}
+	c.data = entry.Data
+	c.lastUpdate = entry.LastUpdate
+	c.lastStatus = entry.Status
+	slog.Debug("Restored collector cache",
+		slog.String("collector", c.Name()),
+		slog.Time("last_update", entry.LastUpdate),
+	)
+}
+
+// timedOut records a timeout and returns the stale cached value if ServeStale is set
+func (c *CachedCollector) timedOut(timeout time.Duration) (any, CollectorStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := ErrCollectorTimeout
+	if timeout > 0 {
+		err = fmt.Errorf("%w after %s", ErrCollectorTimeout, timeout)
+	}
+	c.lastStatus = CollectorStatus{
+		Status:   "timeout",
+		Error:    err.Error(),
+		Duration: float64(timeout.Milliseconds()),
+	}
+
+	var data any
+	if c.ServeStale && !c.lastUpdate.IsZero() {
+		data = c.data
+		c.lastStatus.Cached = true
+		c.lastStatus.Stale = true
+		c.lastStatus.LastRun = c.lastUpdate.UTC().Format(time.RFC3339)
+	}
+
+	slog.Warn("Collector timed out",
+		slog.String("collector", c.Name()),
+		slog.Duration("timeout", timeout),
+		slog.Bool("stale", c.lastStatus.Stale),
+	)
+	return data, c.lastStatus, err
+}
+
+// cancelled records that the caller gave up before the collection finished
+func (c *CachedCollector) cancelled(cause error) (any, CollectorStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastStatus = CollectorStatus{
+		Status: "error",
+		Error:  "collection cancelled",
+	}
+	return nil, c.lastStatus, cause
+}
+
+// withOptionalTimeout applies timeout to ctx if it is positive
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// commandRunner runs a shell command; it matches common.RunCommandContext so tests can substitute it
+type commandRunner func(ctx context.Context, command string, options *common.CommandOptions) (string, string, int, error)
@@ -2,7 +2,9 @@ package collectors
 
 import (
 	"cartographer-go-agent/configuration"
+	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 )
@@ -13,24 +15,24 @@ func TestCollect_Success(t *testing.T) {
 		return map[string]string{"key": "value"}, nil
 	})
 
-	data, err := c.Collect()
+	data, err := c.Collect(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	if data == nil {
 		t.Fatal("expected data, got nil")
 	}
-	if c.LastStatus.Status != "ok" {
-		t.Errorf("expected status 'ok', got %q", c.LastStatus.Status)
+	if c.Status().Status != "ok" {
+		t.Errorf("expected status 'ok', got %q", c.Status().Status)
 	}
-	if c.LastStatus.Cached {
+	if c.Status().Cached {
 		t.Error("expected Cached=false on first run")
 	}
-	if c.LastStatus.LastRun == "" {
+	if c.Status().LastRun == "" {
 		t.Error("expected LastRun to be set")
 	}
-	if c.LastStatus.Error != "" {
-		t.Errorf("expected no error in status, got %q", c.LastStatus.Error)
+	if c.Status().Error != "" {
+		t.Errorf("expected no error in status, got %q", c.Status().Error)
 	}
 }
 
@@ -43,13 +45,13 @@ func TestCollect_Cached(t *testing.T) {
 	})
 
 	// First call
-	_, _ = c.Collect()
+	_, _ = c.Collect(context.Background())
 	if calls != 1 {
 		t.Fatalf("expected 1 call, got %d", calls)
 	}
 
 	// Second call should use cache
-	data, err := c.Collect()
+	data, err := c.Collect(context.Background())
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -59,32 +61,57 @@ func TestCollect_Cached(t *testing.T) {
 	if data != "data" {
 		t.Errorf("expected cached data, got %v", data)
 	}
-	if c.LastStatus.Status != "ok" {
-		t.Errorf("expected status 'ok', got %q", c.LastStatus.Status)
+	if c.Status().Status != "ok" {
+		t.Errorf("expected status 'ok', got %q", c.Status().Status)
 	}
-	if !c.LastStatus.Cached {
+	if !c.Status().Cached {
 		t.Error("expected Cached=true on second run")
 	}
 }
 
+func TestCachedCollector_RefreshBypassesTTL(t *testing.T) {
+	calls := 0
+	c := NewCachedCollector(FuncCollector("test", time.Hour, func(ctx context.Context) (any, error) {
+		calls++
+		return calls, nil
+	}))
+
+	_, _ = c.Collect(context.Background())
+	data, status, err := c.Refresh(context.Background())
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if calls != 2 || data != 2 {
+		t.Errorf("expected Refresh to run the source again, got %d calls and data %v", calls, data)
+	}
+	if status.Cached {
+		t.Error("expected refreshed status not to be cached")
+	}
+
+	// The refreshed result is what later cached calls return
+	if data, _ := c.Collect(context.Background()); data != 2 || calls != 2 {
+		t.Errorf("expected cached refreshed data, got %v after %d calls", data, calls)
+	}
+}
+
 func TestCollect_Error(t *testing.T) {
 	cfg := &configuration.Config{}
 	c := NewCollector("test", 1*time.Minute, cfg, func(config *configuration.Config) (interface{}, error) {
 		return nil, errors.New("something broke")
 	})
 
-	data, err := c.Collect()
+	data, err := c.Collect(context.Background())
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
 	if data != nil {
 		t.Errorf("expected nil data, got %v", data)
 	}
-	if c.LastStatus.Status != "error" {
-		t.Errorf("expected status 'error', got %q", c.LastStatus.Status)
+	if c.Status().Status != "error" {
+		t.Errorf("expected status 'error', got %q", c.Status().Status)
 	}
-	if c.LastStatus.Error != "something broke" {
-		t.Errorf("expected error message 'something broke', got %q", c.LastStatus.Error)
+	if c.Status().Error != "something broke" {
+		t.Errorf("expected error message 'something broke', got %q", c.Status().Error)
 	}
 }
 
@@ -94,15 +121,15 @@ func TestCollect_Skipped(t *testing.T) {
 		return nil, ErrCollectorSkipped
 	})
 
-	data, err := c.Collect()
+	data, err := c.Collect(context.Background())
 	if !errors.Is(err, ErrCollectorSkipped) {
 		t.Fatalf("expected ErrCollectorSkipped, got %v", err)
 	}
 	if data != nil {
 		t.Errorf("expected nil data, got %v", data)
 	}
-	if c.LastStatus.Status != "skipped" {
-		t.Errorf("expected status 'skipped', got %q", c.LastStatus.Status)
+	if c.Status().Status != "skipped" {
+		t.Errorf("expected status 'skipped', got %q", c.Status().Status)
 	}
 }
 
@@ -112,19 +139,19 @@ func TestCollect_PanicRecovery(t *testing.T) {
 		panic("unexpected nil pointer")
 	})
 
-	data, err := c.Collect()
+	data, err := c.Collect(context.Background())
 	if err == nil {
 		t.Fatal("expected error from panic recovery, got nil")
 	}
 	if data != nil {
 		t.Errorf("expected nil data after panic, got %v", data)
 	}
-	if c.LastStatus.Status != "error" {
-		t.Errorf("expected status 'error' after panic, got %q", c.LastStatus.Status)
+	if c.Status().Status != "error" {
+		t.Errorf("expected status 'error' after panic, got %q", c.Status().Status)
 	}
 	expected := "collector panicked: unexpected nil pointer"
-	if c.LastStatus.Error != expected {
-		t.Errorf("expected error %q, got %q", expected, c.LastStatus.Error)
+	if c.Status().Error != expected {
+		t.Errorf("expected error %q, got %q", expected, c.Status().Error)
 	}
 }
 
@@ -135,8 +162,235 @@ func TestCollect_DurationTracked(t *testing.T) {
 		return "data", nil
 	})
 
-	_, _ = c.Collect()
-	if c.LastStatus.Duration < 10 {
-		t.Errorf("expected duration >= 10ms, got %.2fms", c.LastStatus.Duration)
+	_, _ = c.Collect(context.Background())
+	if c.Status().Duration < 10 {
+		t.Errorf("expected duration >= 10ms, got %.2fms", c.Status().Duration)
+	}
+}
+
+func TestCollect_Timeout(t *testing.T) {
+	cfg := &configuration.Config{}
+	release := make(chan struct{})
+	c := NewCollector("test_slow", 1*time.Minute, cfg, func(config *configuration.Config) (interface{}, error) {
+		<-release
+		return "late", nil
+	})
+	c.Timeout = 20 * time.Millisecond
+
+	data, status, err := c.CollectStatus(context.Background())
+	if !errors.Is(err, ErrCollectorTimeout) {
+		t.Fatalf("expected ErrCollectorTimeout, got %v", err)
+	}
+	if data != nil {
+		t.Errorf("expected nil data without ServeStale, got %v", data)
+	}
+	if status.Status != "timeout" {
+		t.Errorf("expected status 'timeout', got %q", status.Status)
+	}
+
+	// The background run should still populate the cache once it finishes
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for c.Status().Status != "ok" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	data, err = c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error after background run completed, got %v", err)
+	}
+	if data != "late" {
+		t.Errorf("expected cached data 'late', got %v", data)
+	}
+}
+
+func TestCollect_TimeoutServesStale(t *testing.T) {
+	cfg := &configuration.Config{}
+	calls := 0
+	c := NewCollector("test_stale", 0, cfg, func(config *configuration.Config) (interface{}, error) {
+		calls++
+		if calls > 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return "fresh", nil
+	})
+	c.Timeout = 50 * time.Millisecond
+	c.ServeStale = true
+
+	if _, err := c.Collect(context.Background()); err != nil {
+		t.Fatalf("expected first collection to succeed, got %v", err)
+	}
+
+	data, status, err := c.CollectStatus(context.Background())
+	if !errors.Is(err, ErrCollectorTimeout) {
+		t.Fatalf("expected ErrCollectorTimeout, got %v", err)
+	}
+	if data != "fresh" {
+		t.Errorf("expected stale data 'fresh', got %v", data)
+	}
+	if !status.Stale || !status.Cached {
+		t.Errorf("expected stale cached status, got %+v", status)
+	}
+	if status.LastRun == "" {
+		t.Error("expected LastRun to be set for stale data")
+	}
+}
+
+func TestCollect_ConcurrentCallersShareRun(t *testing.T) {
+	cfg := &configuration.Config{}
+	var mu sync.Mutex
+	calls := 0
+	c := NewCollector("test_shared", 1*time.Minute, cfg, func(config *configuration.Config) (interface{}, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		return "data", nil
+	})
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Collect(context.Background()); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected 1 call shared by concurrent callers, got %d", calls)
+	}
+}
+
+func TestCachedCollector_CancelsSourceOnTimeout(t *testing.T) {
+	sawCancel := make(chan error, 1)
+	c := NewCachedCollector(FuncCollector("test_ctx", time.Minute, func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		sawCancel <- ctx.Err()
+		return nil, ctx.Err()
+	}))
+	c.Timeout = 20 * time.Millisecond
+
+	_, status, err := c.CollectStatus(context.Background())
+	if !errors.Is(err, ErrCollectorTimeout) {
+		t.Fatalf("expected ErrCollectorTimeout, got %v", err)
+	}
+	if status.Status != "timeout" {
+		t.Errorf("expected status 'timeout', got %q", status.Status)
+	}
+
+	select {
+	case cause := <-sawCancel:
+		if !errors.Is(cause, context.DeadlineExceeded) {
+			t.Errorf("expected source to see DeadlineExceeded, got %v", cause)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("source collector was not cancelled")
+	}
+
+	// The context error from the source must not overwrite the recorded timeout
+	if got := c.Status().Status; got != "timeout" {
+		t.Errorf("expected status to remain 'timeout', got %q", got)
+	}
+}
+
+func TestCachedCollector_CallerCancelled(t *testing.T) {
+	c := NewCachedCollector(FuncCollector("test_cancel", time.Minute, func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	c.Timeout = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, status, err := c.CollectStatus(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if status.Status != "error" {
+		t.Errorf("expected status 'error', got %q", status.Status)
+	}
+}
+
+func TestCachedCollector_CancelledCallerDoesNotFailOthers(t *testing.T) {
+	release := make(chan struct{})
+	c := NewCachedCollector(FuncCollector("test_shared", time.Minute, func(ctx context.Context) (any, error) {
+		select {
+		case <-release:
+			return "data", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}))
+
+	// The first caller starts the run and gives up on it
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, _, err := c.CollectStatus(ctx)
+		first <- err
+	}()
+	running := func() bool {
+		select {
+		case <-c.Idle():
+			return false
+		default:
+			return true
+		}
+	}
+	for !running() {
+		time.Sleep(time.Millisecond)
+	}
+
+	second := make(chan struct{})
+	var data any
+	var status CollectorStatus
+	var err error
+	go func() {
+		defer close(second)
+		data, status, err = c.CollectStatus(context.Background())
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the first caller to see context.Canceled, got %v", err)
+	}
+	close(release)
+	<-second
+
+	if err != nil || data != "data" {
+		t.Fatalf("expected the second caller to get the shared result, got %v, %v", data, err)
+	}
+	if status.Status != "ok" {
+		t.Errorf("expected status 'ok', got %q", status.Status)
+	}
+}
+
+func TestCachedCollector_InjectedClock(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	c := NewCachedCollector(FuncCollector("test_clock", 5*time.Minute, func(ctx context.Context) (any, error) {
+		calls++
+		return calls, nil
+	}))
+	c.now = func() time.Time { return now }
+
+	_, _ = c.Collect(context.Background())
+	now = now.Add(4 * time.Minute)
+	_, _ = c.Collect(context.Background())
+	if calls != 1 {
+		t.Errorf("expected cached result within TTL, got %d calls", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	data, _ := c.Collect(context.Background())
+	if calls != 2 || data != 2 {
+		t.Errorf("expected refresh after TTL expiry, got calls=%d data=%v", calls, data)
 	}
 }
@@ -0,0 +1,138 @@
+package collectors
+
+import (
+	"cartographer-go-agent/common"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// diskCacheVersion is bumped whenever the on-disk entry format changes; entries
+// with a different version are discarded on load.
+const diskCacheVersion = 1
+
+// ErrCacheCorrupt is returned when a cache entry fails to parse or its checksum doesn't match
+var ErrCacheCorrupt = errors.New("cache entry is corrupt")
+
+// CacheEntry is a collector result as persisted on disk
+type CacheEntry struct {
+	Version    int             `json:"version"`
+	Name       string          `json:"name"`
+	LastUpdate time.Time       `json:"last_update"`
+	Status     CollectorStatus `json:"status"`
+	Data       json.RawMessage `json:"data"`
+	Checksum   string          `json:"checksum"` // hex sha256 of Data
+}
+
+// DiskCache persists collector results in a directory so they survive agent restarts.
+// Each collector is stored in its own file, written atomically via rename.
+type DiskCache struct {
+	dir string
+}
+
+var unsafeCacheChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// NewDiskCache returns a DiskCache rooted at dir, creating the directory if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// path returns the file used for the named collector
+func (d *DiskCache) path(name string) string {
+	return filepath.Join(d.dir, unsafeCacheChars.ReplaceAllString(name, "_")+".json")
+}
+
+// Load reads the entry for the named collector. It returns os.ErrNotExist if there
+// is none, and ErrCacheCorrupt (after removing the file) if it can't be trusted.
+func (d *DiskCache) Load(name string) (*CacheEntry, error) {
+	path := d.path(name)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		d.discard(path)
+		return nil, fmt.Errorf("%w: %v", ErrCacheCorrupt, err)
+	}
+	if entry.Version != diskCacheVersion || entry.Name != name || entry.Checksum != checksum(entry.Data) {
+		d.discard(path)
+		return nil, fmt.Errorf("%w: %s", ErrCacheCorrupt, filepath.Base(path))
+	}
+
+	return &entry, nil
+}
+
+// Save writes the entry for the named collector, replacing any previous one atomically
+func (d *DiskCache) Save(name string, data any, lastUpdate time.Time, status CollectorStatus) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache data: %w", err)
+	}
+
+	content, err := json.Marshal(CacheEntry{
+		Version:    diskCacheVersion,
+		Name:       name,
+		LastUpdate: lastUpdate.UTC(),
+		Status:     status,
+		Data:       raw,
+		Checksum:   checksum(raw),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	if err := common.WriteFileAtomic(d.path(name), content, 0600); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// Clear removes every entry from the cache
+func (d *DiskCache) Clear() error {
+	files, err := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// Remove deletes the entry for name, e.g. when the collector's definition changed
+func (d *DiskCache) Remove(name string) error {
+	if err := os.Remove(d.path(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cache entry for %s: %w", name, err)
+	}
+	return nil
+}
+
+// discard removes an entry that failed validation
+func (d *DiskCache) discard(path string) {
+	slog.Warn("Discarding corrupt collector cache entry", slog.String("path", path))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Error("Failed to remove corrupt cache entry",
+			slog.String("path", path),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
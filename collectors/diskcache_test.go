@@ -0,0 +1,167 @@
+package collectors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCache_SaveLoadRoundTrip(t *testing.T) {
+	store, err := NewDiskCache(filepath.Join(t.TempDir(), "cache"))
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	lastUpdate := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	status := CollectorStatus{Status: "ok", Duration: 12, LastRun: lastUpdate.Format(time.RFC3339)}
+	if err := store.Save("json/cmd", map[string]int{"a": 1}, lastUpdate, status); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	entry, err := store.Load("json/cmd")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !entry.LastUpdate.Equal(lastUpdate) {
+		t.Errorf("LastUpdate = %v, want %v", entry.LastUpdate, lastUpdate)
+	}
+	if entry.Status != status {
+		t.Errorf("Status = %+v, want %+v", entry.Status, status)
+	}
+	if string(entry.Data) != `{"a":1}` {
+		t.Errorf("Data = %s, want {\"a\":1}", entry.Data)
+	}
+
+	// No temp files should be left behind
+	leftovers, _ := filepath.Glob(filepath.Join(store.dir, ".tmp-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("expected no temp files, found %v", leftovers)
+	}
+}
+
+func TestDiskCache_LoadMissing(t *testing.T) {
+	store, _ := NewDiskCache(t.TempDir())
+	if _, err := store.Load("nope"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestDiskCache_CorruptEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		content func(valid []byte) []byte
+	}{
+		{
+			name:    "truncated json",
+			content: func(valid []byte) []byte { return valid[:len(valid)/2] },
+		},
+		{
+			name: "checksum mismatch",
+			content: func(valid []byte) []byte {
+				var entry CacheEntry
+				_ = json.Unmarshal(valid, &entry)
+				entry.Data = json.RawMessage(`"tampered"`)
+				out, _ := json.Marshal(entry)
+				return out
+			},
+		},
+		{
+			name: "wrong version",
+			content: func(valid []byte) []byte {
+				var entry CacheEntry
+				_ = json.Unmarshal(valid, &entry)
+				entry.Version = diskCacheVersion + 1
+				out, _ := json.Marshal(entry)
+				return out
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := NewDiskCache(t.TempDir())
+			if err := store.Save("users", []string{"root"}, time.Now(), CollectorStatus{Status: "ok"}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			path := store.path("users")
+			valid, _ := os.ReadFile(path)
+			if err := os.WriteFile(path, tt.content(valid), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := store.Load("users"); !errors.Is(err, ErrCacheCorrupt) {
+				t.Fatalf("expected ErrCacheCorrupt, got %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Error("expected corrupt entry to be removed")
+			}
+		})
+	}
+}
+
+func TestDiskCache_Clear(t *testing.T) {
+	store, _ := NewDiskCache(t.TempDir())
+	_ = store.Save("a", 1, time.Now(), CollectorStatus{Status: "ok"})
+	_ = store.Save("b", 2, time.Now(), CollectorStatus{Status: "ok"})
+
+	if err := store.Clear(); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(store.dir, "*.json"))
+	if len(files) != 0 {
+		t.Errorf("expected empty cache, found %v", files)
+	}
+}
+
+func TestCachedCollector_RestoresFromDiskWithinTTL(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewDiskCache(dir)
+
+	calls := 0
+	newCollector := func() *CachedCollector {
+		return NewCachedCollector(FuncCollector("apt", 15*time.Minute, func(ctx context.Context) (any, error) {
+			calls++
+			return map[string]string{"run": "fresh"}, nil
+		}))
+	}
+
+	// First "process" collects and persists
+	first := newCollector()
+	first.AttachCache(store)
+	if _, err := first.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	// Second "process" should be served from disk without collecting
+	second := newCollector()
+	second.AttachCache(store)
+	data, status, err := second.CollectStatus(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected restored cache to avoid a second collection, got %d calls", calls)
+	}
+	if !status.Cached {
+		t.Error("expected restored result to be reported as cached")
+	}
+	raw, ok := data.(json.RawMessage)
+	if !ok || string(raw) != `{"run":"fresh"}` {
+		t.Errorf("unexpected restored data: %#v", data)
+	}
+
+	// Once the TTL has passed, the collector runs again
+	third := newCollector()
+	third.now = func() time.Time { return time.Now().Add(time.Hour) }
+	third.AttachCache(store)
+	if _, err := third.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected expired cache to trigger collection, got %d calls", calls)
+	}
+}
@@ -2,10 +2,10 @@ package collectors
 
 import (
 	"bufio"
-	"bytes"
+	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"log/slog"
-	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
@@ -23,77 +23,94 @@ type DiskUsageInfo struct {
 	UsagePercentage int    `json:"usage_percentage"` // Store as an integer, no "%"
 }
 
+// diskUsageCollector gathers per-mount disk usage from df
+type diskUsageCollector struct {
+	ttl time.Duration
+	run commandRunner
+}
+
+func (d *diskUsageCollector) Name() string              { return "disk_usage" }
+func (d *diskUsageCollector) DefaultTTL() time.Duration { return d.ttl }
+
+// Collect runs df and parses each non-virtual filesystem
+func (d *diskUsageCollector) Collect(ctx context.Context) (any, error) {
+	if runtime.GOOS != "linux" {
+		return nil, ErrCollectorSkipped
+	}
+
+	// Run the `df -hT` command to gather disk usage information
+	output, _, _, err := d.run(ctx, "df -hT", &common.CommandOptions{
+		Timeout:        30,
+		SuppressStderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDiskUsage(output)
+}
+
 // DiskUsageCollector returns a collector that gathers information about disk usage
-func DiskUsageCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("disk_usage", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
-		if runtime.GOOS != "linux" {
-			return nil, ErrCollectorSkipped
-		}
+func DiskUsageCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(&diskUsageCollector{ttl: ttl, run: common.RunCommandContext})
+}
 
-		// Run the `df -hT` command to gather disk usage information
-		cmd := exec.Command("df", "-hT")
-		var cmdOut bytes.Buffer
-		cmd.Stdout = &cmdOut
-		err := cmd.Run()
-		if err != nil {
-			return nil, err
-		}
+// parseDiskUsage parses `df -hT` output, skipping the header and virtual filesystems
+func parseDiskUsage(output string) ([]DiskUsageInfo, error) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	var diskUsages []DiskUsageInfo
 
-		scanner := bufio.NewScanner(&cmdOut)
-		var diskUsages []DiskUsageInfo
+	// Skip the header line
+	scanner.Scan()
 
-		// Skip the header line
-		scanner.Scan()
+	// Define filesystems to skip
+	skipFileSystems := map[string]bool{
+		"tmpfs":    true,
+		"devtmpfs": true,
+		"overlay":  true,
+		"aufs":     true,
+		"squashfs": true,
+		"ramfs":    true,
+	}
 
-		// Define filesystems to skip
-		skipFileSystems := map[string]bool{
-			"tmpfs":    true,
-			"devtmpfs": true,
-			"overlay":  true,
-			"aufs":     true,
-			"squashfs": true,
-			"ramfs":    true,
+	// Parse each line of the df output
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue // Ensure there are enough fields to avoid index errors
 		}
 
-		// Parse each line of the df output
-		for scanner.Scan() {
-			line := scanner.Text()
-			fields := strings.Fields(line)
-			if len(fields) < 7 {
-				continue // Ensure there are enough fields to avoid index errors
-			}
-
-			fsType := fields[1]
-			if _, skip := skipFileSystems[fsType]; skip {
-				continue
-			}
-
-			// Parse usage percentage as an integer
-			usageStr := fields[5]
-			usagePercentage, err := strconv.Atoi(strings.TrimSuffix(usageStr, "%"))
-			if err != nil {
-				slog.Error("Error parsing usage percentage", slog.Any("error", err))
-				continue
-			}
-
-			// Create a DiskUsageInfo object for each entry
-			diskUsage := DiskUsageInfo{
-				Filesystem:      fields[0],
-				Type:            fsType,
-				Total:           fields[2],
-				Used:            fields[3],
-				Available:       fields[4],
-				UsagePercentage: usagePercentage,
-				MountPoint:      fields[6],
-			}
-
-			diskUsages = append(diskUsages, diskUsage)
+		fsType := fields[1]
+		if _, skip := skipFileSystems[fsType]; skip {
+			continue
 		}
 
-		if err := scanner.Err(); err != nil {
-			return nil, err
+		// Parse usage percentage as an integer
+		usageStr := fields[5]
+		usagePercentage, err := strconv.Atoi(strings.TrimSuffix(usageStr, "%"))
+		if err != nil {
+			slog.Error("Error parsing usage percentage", slog.Any("error", err))
+			continue
 		}
 
-		return diskUsages, nil
-	})
+		// Create a DiskUsageInfo object for each entry
+		diskUsage := DiskUsageInfo{
+			Filesystem:      fields[0],
+			Type:            fsType,
+			Total:           fields[2],
+			Used:            fields[3],
+			Available:       fields[4],
+			UsagePercentage: usagePercentage,
+			MountPoint:      fields[6],
+		}
+
+		diskUsages = append(diskUsages, diskUsage)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return diskUsages, nil
 }
@@ -4,3 +4,9 @@ import "errors"
 
 // ErrCollectorSkipped is returned when a collector is skipped due to unsupported OS
 var ErrCollectorSkipped = errors.New("collector skipped due to unsupported OS")
+
+// ErrCollectorTimeout is returned when a collector does not finish within its timeout
+var ErrCollectorTimeout = errors.New("collector timed out")
+
+// errNoCertificate is returned for PEM files that hold no certificate, such as private keys
+var errNoCertificate = errors.New("no certificate in file")
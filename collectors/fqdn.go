@@ -3,14 +3,20 @@ package collectors
 import (
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"fmt"
 	"time"
 )
 
 // GetFQDN collects the Fully Qualified Domain Name of the system
 func GetFQDN() (string, error) {
+	return GetFQDNContext(context.Background())
+}
+
+// GetFQDNContext is like GetFQDN but gives up when ctx is done
+func GetFQDNContext(ctx context.Context) (string, error) {
 	// Use the internal RunCommandLegacy to get the FQDN
-	output, err := common.RunCommandLegacy("/bin/hostname -f", 5) // Adjust timeout as needed
+	output, err := common.RunCommandLegacyContext(ctx, "/bin/hostname -f", 5) // Adjust timeout as needed
 	if err != nil {
 		return "", fmt.Errorf("error when getting FQDN: %v", err)
 	}
@@ -24,20 +30,20 @@ func GetFQDN() (string, error) {
 }
 
 // FQDNCollector collects the Fully Qualified Domain Name of the system
-func FQDNCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("fqdn", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+func FQDNCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector("fqdn", ttl, func(ctx context.Context) (any, error) {
 		// Check if config has FQDN set
 		if config.FQDN != "" {
 			return config.FQDN, nil
 		}
 
 		// Otherwise, collect FQDN dynamically
-		fqdn, err := GetFQDN()
+		fqdn, err := GetFQDNContext(ctx)
 		if err != nil {
 			return nil, err
 		}
 
 		// Return the FQDN directly
 		return fqdn, nil
-	})
+	}))
 }
@@ -3,15 +3,16 @@ package collectors
 import (
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"encoding/json"
 	"time"
 )
 
 // JSONCommandCollector creates a collector that runs a given command and returns JSON data
-func JSONCommandCollector(name string, command string, timeout int, ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector(name, ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+func JSONCommandCollector(name string, command string, timeout int, ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector(name, ttl, func(ctx context.Context) (any, error) {
 		// Run the command
-		results, err := common.RunCommandLegacy(command, timeout)
+		results, err := common.RunCommandLegacyContext(ctx, command, timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -24,5 +25,5 @@ func JSONCommandCollector(name string, command string, timeout int, ttl time.Dur
 		}
 
 		return jsonData, nil
-	})
+	}))
 }
@@ -1,7 +1,9 @@
 package collectors
 
 import (
+	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -81,11 +83,6 @@ func findNessuscliWithFS(fs fileSystem) (string, error) {
 	return "", fmt.Errorf("nessuscli not found in PATH or common locations")
 }
 
-// The original findNessuscli function now just calls findNessuscliWithFS with the real implementation
-func findNessuscli() (string, error) {
-	return findNessuscliWithFS(&realFileSystem{})
-}
-
 // The original isExecutable can now just call isExecutableWithFS
 func isExecutable(path string) bool {
 	return isExecutableWithFS(path, &realFileSystem{})
@@ -156,28 +153,47 @@ func parseNessusOutput(output []byte, agentPath string) (*NessusStatus, error) {
 	return status, nil
 }
 
-// NessusCollector returns a collector that runs the nessuscli agent status command
-func NessusCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("nessus_agent", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
-		// Find nessuscli executable
-		nessusPath, err := findNessuscli()
-		if err != nil {
-			return nil, err
-		}
+// nessusCollector reports the local Nessus agent status via nessuscli
+type nessusCollector struct {
+	ttl time.Duration
+	fs  fileSystem
+	run commandRunner
+}
 
-		// Run nessuscli command
-		cmd := exec.Command(nessusPath, "agent", "status", "--local")
-		output, err := cmd.Output()
-		if err != nil {
-			return nil, fmt.Errorf("failed to execute nessuscli: %w", err)
-		}
+func (n *nessusCollector) Name() string              { return "nessus_agent" }
+func (n *nessusCollector) DefaultTTL() time.Duration { return n.ttl }
 
-		// Parse the output
-		status, err := parseNessusOutput(output, nessusPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse nessus status: %w", err)
-		}
+// Collect finds nessuscli and parses its local agent status
+func (n *nessusCollector) Collect(ctx context.Context) (any, error) {
+	// Find nessuscli executable
+	nessusPath, err := findNessuscliWithFS(n.fs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Run nessuscli command
+	output, _, _, err := n.run(ctx, nessusPath+" agent status --local", &common.CommandOptions{
+		Timeout:        30,
+		SuppressStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute nessuscli: %w", err)
+	}
+
+	// Parse the output
+	status, err := parseNessusOutput([]byte(output), nessusPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nessus status: %w", err)
+	}
 
-		return status, nil
+	return status, nil
+}
+
+// NessusCollector returns a collector that runs the nessuscli agent status command
+func NessusCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(&nessusCollector{
+		ttl: ttl,
+		fs:  &realFileSystem{},
+		run: common.RunCommandContext,
 	})
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -30,6 +31,10 @@ type NginxSite struct {
 	ProxyPasses []ProxyPassEntry  `json:"proxy_passes,omitempty"`
 	ConfigFile  string            `json:"config_file"`
 	setVars     map[string]string // unexported: used during parsing for $variable resolution
+
+	// SSLCertificates are the ssl_certificate paths, relative ones resolved against the
+	// nginx config directory
+	SSLCertificates []string `json:"ssl_certificates,omitempty"`
 }
 
 // NginxInfo represents the collected nginx information
@@ -43,23 +48,38 @@ type NginxInfo struct {
 	CollectedAt string      `json:"collected_at"`
 }
 
-// NginxCollector returns a collector that gathers nginx configuration and site info
-func NginxCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("nginx", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
-		if runtime.GOOS != "linux" {
-			return nil, ErrCollectorSkipped
-		}
+// nginxCollector gathers nginx configuration and site info
+type nginxCollector struct {
+	ttl time.Duration
+	run commandRunner
+}
 
-		info := collectNginx()
-		if !info.Installed {
-			return nil, ErrCollectorSkipped
-		}
+func (n *nginxCollector) Name() string              { return "nginx" }
+func (n *nginxCollector) DefaultTTL() time.Duration { return n.ttl }
 
-		return info, nil
-	})
+// Collect inspects the nginx binary and, if it is running, parses its sites
+func (n *nginxCollector) Collect(ctx context.Context) (any, error) {
+	if runtime.GOOS != "linux" {
+		return nil, ErrCollectorSkipped
+	}
+
+	info := n.collectNginx(ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !info.Installed {
+		return nil, ErrCollectorSkipped
+	}
+
+	return info, nil
 }
 
-func collectNginx() *NginxInfo {
+// NginxCollector returns a collector that gathers nginx configuration and site info
+func NginxCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(&nginxCollector{ttl: ttl, run: common.RunCommandContext})
+}
+
+func (n *nginxCollector) collectNginx(ctx context.Context) *NginxInfo {
 	info := &NginxInfo{
 		CollectedAt: time.Now().UTC().Format(time.RFC3339),
 	}
@@ -73,18 +93,18 @@ func collectNginx() *NginxInfo {
 	info.BinaryPath = nginxPath
 
 	// Get version
-	if version, err := getNginxVersion(nginxPath); err == nil {
+	if version, err := n.getNginxVersion(ctx, nginxPath); err == nil {
 		info.Version = version
 	}
 
 	// Check if running
-	info.Running = isNginxRunning()
+	info.Running = n.isNginxRunning(ctx)
 	if !info.Running {
 		return info
 	}
 
 	// Get config path from nginx -V
-	info.ConfigPath = getNginxConfigPath(nginxPath)
+	info.ConfigPath = n.getNginxConfigPath(ctx, nginxPath)
 
 	// Parse sites from config
 	if info.ConfigPath != "" {
@@ -115,8 +135,8 @@ func findNginxBinary() string {
 	return ""
 }
 
-func getNginxVersion(nginxPath string) (string, error) {
-	stdout, stderr, exitCode, err := common.RunCommand(nginxPath+" -v", &common.CommandOptions{
+func (n *nginxCollector) getNginxVersion(ctx context.Context, nginxPath string) (string, error) {
+	stdout, stderr, exitCode, err := n.run(ctx, nginxPath+" -v", &common.CommandOptions{
 		Timeout: 5,
 	})
 	if err != nil || exitCode != 0 {
@@ -131,15 +151,15 @@ func getNginxVersion(nginxPath string) (string, error) {
 	return "", fmt.Errorf("could not parse nginx version")
 }
 
-func isNginxRunning() bool {
-	_, _, exitCode, err := common.RunCommand("pgrep -x nginx", &common.CommandOptions{
+func (n *nginxCollector) isNginxRunning(ctx context.Context) bool {
+	_, _, exitCode, err := n.run(ctx, "pgrep -x nginx", &common.CommandOptions{
 		Timeout: 5,
 	})
 	return err == nil && exitCode == 0
 }
 
-func getNginxConfigPath(nginxPath string) string {
-	stdout, stderr, exitCode, err := common.RunCommand(nginxPath+" -V", &common.CommandOptions{
+func (n *nginxCollector) getNginxConfigPath(ctx context.Context, nginxPath string) string {
+	stdout, stderr, exitCode, err := n.run(ctx, nginxPath+" -V", &common.CommandOptions{
 		Timeout: 5,
 	})
 	if err != nil || exitCode != 0 {
@@ -429,7 +449,7 @@ func parseServerBlocks(filePath string, nginxConfigDir string) ([]NginxSite, err
 	serverNameRe := regexp.MustCompile(`^\s*server_name\s+(.+);`)
 	rootRe := regexp.MustCompile(`^\s*root\s+(.+);`)
 	proxyPassRe := regexp.MustCompile(`^\s*proxy_pass\s+(.+);`)
-	sslCertRe := regexp.MustCompile(`^\s*ssl_certificate\s+`)
+	sslCertRe := regexp.MustCompile(`^\s*ssl_certificate\s+([^;]+);`)
 	locationRe := regexp.MustCompile(`^\s*location\s+(?:=\s+|\^~\s+)?(/\S+)\s*\{`)
 	includeRe := regexp.MustCompile(`^\s*include\s+([^;]+);`)
 	setRe := regexp.MustCompile(`^\s*set\s+\$(\w+)\s+"?([^";]+)"?\s*;`)
@@ -546,8 +566,13 @@ func parseServerBlocks(filePath string, nginxConfigDir string) ([]NginxSite, err
 			}
 
 			// Detect SSL from ssl_certificate directive
-			if sslCertRe.MatchString(line) {
+			if matches := sslCertRe.FindStringSubmatch(line); matches != nil {
 				current.SSL = true
+				certPath := strings.Trim(strings.TrimSpace(matches[1]), `"'`)
+				if !filepath.IsAbs(certPath) && !strings.HasPrefix(certPath, "$") && !strings.HasPrefix(certPath, "data:") {
+					certPath = filepath.Join(nginxConfigDir, certPath)
+				}
+				current.SSLCertificates = append(current.SSLCertificates, certPath)
 			}
 		}
 
@@ -41,10 +41,11 @@ func TestParseServerBlocks(t *testing.T) {
 }`,
 			expected: []NginxSite{
 				{
-					ServerNames: []string{"secure.example.com"},
-					ListenPorts: []string{"443 ssl"},
-					Root:        "/var/www/secure",
-					SSL:         true,
+					ServerNames:     []string{"secure.example.com"},
+					ListenPorts:     []string{"443 ssl"},
+					Root:            "/var/www/secure",
+					SSL:             true,
+					SSLCertificates: []string{"/etc/ssl/certs/example.crt"},
 				},
 			},
 		},
@@ -92,10 +93,11 @@ server {
 					SSL:         false,
 				},
 				{
-					ServerNames: []string{"site2.com"},
-					ListenPorts: []string{"80", "443 ssl"},
-					Root:        "/var/www/site2",
-					SSL:         true,
+					ServerNames:     []string{"site2.com"},
+					ListenPorts:     []string{"80", "443 ssl"},
+					Root:            "/var/www/site2",
+					SSL:             true,
+					SSLCertificates: []string{"/etc/ssl/certs/site2.crt"},
 				},
 			},
 		},
@@ -150,10 +152,11 @@ server {
 }`,
 			expected: []NginxSite{
 				{
-					ServerNames: []string{"ssl-cert.example.com"},
-					ListenPorts: []string{"443"},
-					Root:        "/var/www/ssl",
-					SSL:         true,
+					ServerNames:     []string{"ssl-cert.example.com"},
+					ListenPorts:     []string{"443"},
+					Root:            "/var/www/ssl",
+					SSL:             true,
+					SSLCertificates: []string{"/etc/ssl/cert.pem"},
 				},
 			},
 		},
@@ -274,6 +277,30 @@ server {
 	}
 }
 
+func TestParseServerBlocksSSLCertificates(t *testing.T) {
+	tmpDir := t.TempDir()
+	configFile := filepath.Join(tmpDir, "test.conf")
+	config := `server {
+    listen 443 ssl;
+    server_name dual.example.com;
+    ssl_certificate "certs/rsa.pem";
+    ssl_certificate /etc/ssl/ecdsa.pem;
+    ssl_certificate $ssl_server_name.crt;
+}`
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sites, err := parseServerBlocks(configFile, tmpDir)
+	if err != nil {
+		t.Fatalf("parseServerBlocks returned error: %v", err)
+	}
+	expected := []string{filepath.Join(tmpDir, "certs/rsa.pem"), "/etc/ssl/ecdsa.pem", "$ssl_server_name.crt"}
+	if len(sites) != 1 || !reflect.DeepEqual(sites[0].SSLCertificates, expected) {
+		t.Errorf("parseServerBlocks() = %+v, want ssl_certificates %v", sites, expected)
+	}
+}
+
 func TestParseServerBlocksInlineIncludes(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -774,8 +801,8 @@ func TestNginxCollectorCreation(t *testing.T) {
 		t.Fatal("NginxCollector returned nil")
 	}
 
-	if collector.Name != "nginx" {
-		t.Errorf("collector.Name = %v, want nginx", collector.Name)
+	if collector.Name() != "nginx" {
+		t.Errorf("collector.Name = %v, want nginx", collector.Name())
 	}
 
 	if collector.ttl != 5*time.Minute {
@@ -2,6 +2,7 @@ package collectors
 
 import (
 	"cartographer-go-agent/configuration"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -25,9 +26,13 @@ const (
 
 // fetchPublicIPOnce makes a single HTTP GET request to the given URL and
 // returns the response body as a trimmed string.
-func fetchPublicIPOnce(url string) (string, error) {
+func fetchPublicIPOnce(ctx context.Context, url string) (string, error) {
 	client := &http.Client{Timeout: ipifyTimeout}
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("building request to %s: %w", url, err)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("request to %s failed: %w", url, err)
 	}
@@ -52,13 +57,13 @@ func fetchPublicIPOnce(url string) (string, error) {
 
 // fetchPublicIP attempts to fetch a public IP with up to 2 retries,
 // waiting 3 seconds between attempts.
-func fetchPublicIP(url string) (string, error) {
+func fetchPublicIP(ctx context.Context, url string) (string, error) {
 	const maxAttempts = 3
 	const retryDelay = 3 * time.Second
 
 	var lastErr error
 	for attempt := range maxAttempts {
-		ip, err := fetchPublicIPOnce(url)
+		ip, err := fetchPublicIPOnce(ctx, url)
 		if err == nil {
 			return ip, nil
 		}
@@ -69,7 +74,11 @@ func fetchPublicIP(url string) (string, error) {
 				slog.Int("attempt", attempt+1),
 				slog.String("error", err.Error()),
 			)
-			time.Sleep(retryDelay)
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(retryDelay):
+			}
 		}
 	}
 	return "", lastErr
@@ -78,23 +87,26 @@ func fetchPublicIP(url string) (string, error) {
 // collectPublicIPs fetches the public IPv4 and IPv6 addresses using ipify.org.
 // Either address may be empty if the machine lacks public connectivity for that
 // IP version. Returns an error only if both lookups fail.
-func collectPublicIPs() (*PublicIPs, error) {
+func collectPublicIPs(ctx context.Context) (*PublicIPs, error) {
 	result := &PublicIPs{}
 
-	ipv4, err := fetchPublicIP(ipifyV4URL)
+	ipv4, err := fetchPublicIP(ctx, ipifyV4URL)
 	if err != nil {
 		slog.Debug("Could not determine public IPv4", slog.String("error", err.Error()))
 	} else {
 		result.IPv4 = ipv4
 	}
 
-	ipv6, err := fetchPublicIP(ipifyV6URL)
+	ipv6, err := fetchPublicIP(ctx, ipifyV6URL)
 	if err != nil {
 		slog.Debug("Could not determine public IPv6", slog.String("error", err.Error()))
 	} else {
 		result.IPv6 = ipv6
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if result.IPv4 == "" && result.IPv6 == "" {
 		return nil, fmt.Errorf("failed to determine any public IP address")
 	}
@@ -103,8 +115,8 @@ func collectPublicIPs() (*PublicIPs, error) {
 }
 
 // PublicIPCollector returns a collector that fetches public IP addresses.
-func PublicIPCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("public_ips", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
-		return collectPublicIPs()
-	})
+func PublicIPCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector("public_ips", ttl, func(ctx context.Context) (any, error) {
+		return collectPublicIPs(ctx)
+	}))
 }
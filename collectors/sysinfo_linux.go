@@ -4,15 +4,18 @@ package collectors
 
 import (
 	"cartographer-go-agent/configuration"
+	"context"
 	"time"
 
 	"github.com/zcalusic/sysinfo"
 )
 
-func SysInfoCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("sys_info", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+// SysInfoCollector collects system information
+func SysInfoCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector("sys_info", ttl, func(ctx context.Context) (any, error) {
+		// sysinfo has no cancellation support; CachedCollector enforces the deadline
 		var si sysinfo.SysInfo
 		si.GetSysInfo()
 		return si, nil
-	})
+	}))
 }
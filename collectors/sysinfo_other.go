@@ -4,12 +4,13 @@ package collectors
 
 import (
 	"cartographer-go-agent/configuration"
+	"context"
 	"time"
 )
 
 // SysInfoCollector collects system information
-func SysInfoCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("sys_info", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+func SysInfoCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector("sys_info", ttl, func(ctx context.Context) (any, error) {
 		return nil, ErrCollectorSkipped
-	})
+	}))
 }
@@ -3,6 +3,7 @@ package collectors
 import (
 	"bufio"
 	"cartographer-go-agent/configuration"
+	"context"
 	"log/slog"
 	"os"
 	"strings"
@@ -64,12 +65,12 @@ func getUsers() ([]User, error) {
 }
 
 // UsersCollector returns a collector that gathers information about system users
-func UsersCollector(ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector("users", ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+func UsersCollector(ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector("users", ttl, func(ctx context.Context) (any, error) {
 		users, err := getUsers()
 		if err != nil {
 			return nil, err
 		}
 		return users, nil
-	})
+	}))
 }
@@ -2,6 +2,7 @@ package collectors
 
 import (
 	"cartographer-go-agent/configuration"
+	"context"
 	"os"
 	"path/filepath"
 	"time"
@@ -10,8 +11,8 @@ import (
 )
 
 // YamlFileCollector creates a collector that processes a given YAML file
-func YamlFileCollector(name string, path string, ttl time.Duration, config *configuration.Config) *Collector {
-	return NewCollector(name, ttl, config, func(cfg *configuration.Config) (interface{}, error) {
+func YamlFileCollector(name string, path string, ttl time.Duration, config *configuration.Config) *CachedCollector {
+	return NewCachedCollector(FuncCollector(name, ttl, func(ctx context.Context) (any, error) {
 		// Load the YAML file
 		filename, _ := filepath.Abs(path)
 		yamlFile, err := os.ReadFile(filename)
@@ -27,5 +28,5 @@ func YamlFileCollector(name string, path string, ttl time.Duration, config *conf
 		}
 
 		return parsedData, nil
-	})
+	}))
 }
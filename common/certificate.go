@@ -0,0 +1,29 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// PublicKeyInfo returns the algorithm and size in bits of a certificate's public key
+func PublicKeyInfo(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA.String(), key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return x509.ECDSA.String(), key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return x509.Ed25519.String(), 256
+	}
+	return cert.PublicKeyAlgorithm.String(), 0
+}
+
+// CertificateFingerprint returns the hex SHA-256 digest of a certificate's DER encoding
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
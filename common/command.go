@@ -13,7 +13,12 @@ import (
 
 // RunCommandLegacy runs a shell command with a timeout, capturing its output.
 func RunCommandLegacy(command string, timeout int) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	return RunCommandLegacyContext(context.Background(), command, timeout)
+}
+
+// RunCommandLegacyContext is like RunCommandLegacy but is also cancelled when ctx is done.
+func RunCommandLegacyContext(ctx context.Context, command string, timeout int) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
@@ -50,6 +55,12 @@ var (
 // If no timeout is provided, it defaults to 30 seconds.
 // Environment variables and working directory can also be customized via CommandOptions.
 func RunCommand(command string, options *CommandOptions) (string, string, int, error) {
+	return RunCommandContext(context.Background(), command, options)
+}
+
+// RunCommandContext is like RunCommand but is also cancelled when ctx is done,
+// in which case the returned error wraps ctx.Err().
+func RunCommandContext(ctx context.Context, command string, options *CommandOptions) (string, string, int, error) {
 	// Set default options if not provided
 	if options == nil {
 		options = &CommandOptions{}
@@ -59,11 +70,14 @@ func RunCommand(command string, options *CommandOptions) (string, string, int, e
 	}
 
 	// Prepare command context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(options.Timeout)*time.Second)
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(options.Timeout)*time.Second)
 	defer cancel()
 
 	// Prepare the command
 	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	// Don't wait on pipes held open by orphaned grandchildren once the shell is killed
+	cmd.WaitDelay = time.Second
 
 	// Set working directory if provided
 	if options.WorkingDir != "" {
@@ -96,6 +110,9 @@ func RunCommand(command string, options *CommandOptions) (string, string, int, e
 	}
 
 	// Check for specific error cases
+	if parent.Err() != nil {
+		return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), exitCode, fmt.Errorf("command cancelled: %s: %w", command, parent.Err())
+	}
 	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		return strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), exitCode, fmt.Errorf("%w: %s", ErrCommandTimeout, command)
 	}
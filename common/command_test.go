@@ -1,8 +1,11 @@
 package common
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRunCommand(t *testing.T) {
@@ -60,3 +63,23 @@ func TestRunCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCommandContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, _, err := RunCommandContext(ctx, "sleep 10", &CommandOptions{Timeout: 5})
+	if err == nil {
+		t.Fatal("expected error from cancelled command, got nil")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	if errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("expected caller cancellation, not command timeout: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected command to stop promptly, took %s", elapsed)
+	}
+}
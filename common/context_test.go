@@ -0,0 +1,34 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithGracePeriod(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := WithGracePeriod(parent, 50*time.Millisecond)
+	defer cancel()
+
+	cancelParent()
+	select {
+	case <-ctx.Done():
+		t.Fatal("expected the context to outlive its parent for the grace period")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the context to be cancelled after the grace period")
+	}
+}
+
+func TestWithGracePeriod_Cancel(t *testing.T) {
+	ctx, cancel := WithGracePeriod(context.Background(), time.Hour)
+	cancel()
+	if ctx.Err() == nil {
+		t.Error("expected cancel to end the context immediately")
+	}
+}
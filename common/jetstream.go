@@ -0,0 +1,149 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// JetStreamOptions controls how durable messages are published to JetStream
+type JetStreamOptions struct {
+	// AgentID identifies this agent in Nats-Msg-Id headers, normally the agent UUID
+	AgentID string
+	// AckTimeout is how long to wait for a PubAck before retrying
+	AckTimeout time.Duration
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+	// RetryWait is the initial delay between retries; it doubles up to maxJetStreamRetryWait
+	RetryWait time.Duration
+}
+
+const maxJetStreamRetryWait = 30 * time.Second
+
+// Sequence numbers messages. It starts from the time it was created, in milliseconds,
+// so values keep increasing across restarts without being persisted and a new run
+// never reuses a message ID that a previous run may still have spooled.
+type Sequence struct {
+	n atomic.Uint64
+}
+
+// NewSequence returns a Sequence starting after the current time in milliseconds
+func NewSequence() *Sequence {
+	s := &Sequence{}
+	s.n.Store(uint64(time.Now().UnixMilli()))
+	return s
+}
+
+// Next returns the next value in the sequence
+func (s *Sequence) Next() uint64 {
+	return s.n.Add(1)
+}
+
+// jetStreamPublisher publishes messages with a deterministic Nats-Msg-Id and waits for acks
+type jetStreamPublisher struct {
+	js   jetstream.JetStream
+	opts JetStreamOptions
+
+	// sequence numbers messages whose publisher didn't supply a sequence
+	sequence *Sequence
+}
+
+// EnableJetStream switches the publisher to JetStream mode: every message published
+// with PublishJSON waits for a PubAck and carries a Nats-Msg-Id for server-side dedupe.
+func (p *Publisher) EnableJetStream(opts JetStreamOptions) error {
+	if opts.AgentID == "" {
+		return errors.New("JetStream publishing requires an agent ID")
+	}
+	js, err := jetstream.New(p.nc)
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.js = &jetStreamPublisher{
+		js:       js,
+		opts:     opts,
+		sequence: NewSequence(),
+	}
+	return nil
+}
+
+// msgID returns the Nats-Msg-Id for the message with the given sequence on subject.
+// A zero sequence takes the next one from the publisher's own sequence.
+func (j *jetStreamPublisher) msgID(subject string, sequence uint64) string {
+	if sequence == 0 {
+		sequence = j.sequence.Next()
+	}
+	return fmt.Sprintf("%s-%s-%d", j.opts.AgentID, subject, sequence)
+}
+
+// publishOnce sends msg and waits up to AckTimeout for the PubAck
+func (j *jetStreamPublisher) publishOnce(ctx context.Context, msg *nats.Msg) error {
+	ctx, cancel := context.WithTimeout(ctx, j.opts.AckTimeout)
+	defer cancel()
+	// Retries are handled by the caller so the backoff applies to every failure
+	ack, err := j.js.PublishMsg(ctx, msg, jetstream.WithRetryAttempts(0))
+	if err != nil {
+		return err
+	}
+	slog.Debug("Published message to JetStream",
+		slog.String("subject", msg.Subject),
+		slog.String("stream", ack.Stream),
+		slog.Uint64("stream_sequence", ack.Sequence),
+		slog.Bool("duplicate", ack.Duplicate),
+	)
+	return nil
+}
+
+// publishJetStreamLocked sends msg and waits for the PubAck, retrying with exponential
+// backoff. Retries reuse the message's Nats-Msg-Id, so a retry after a lost ack is
+// deduplicated. p.mu must be held; it is released while waiting between attempts so a
+// slow or unavailable stream doesn't hold up other publishes, and the wait ends early
+// once ctx is done.
+func (p *Publisher) publishJetStreamLocked(ctx context.Context, msg *nats.Msg) error {
+	wait := p.js.opts.RetryWait
+	var err error
+
+	for attempt := 0; attempt <= p.js.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			slog.Warn("Retrying JetStream publish",
+				slog.String("subject", msg.Subject),
+				slog.String("msg_id", msg.Header.Get(nats.MsgIdHdr)),
+				slog.Int("attempt", attempt),
+				slog.String("error", err.Error()),
+			)
+			if !p.waitUnlocked(ctx, wait) {
+				return fmt.Errorf("gave up publishing %s: %w", msg.Subject, ctx.Err())
+			}
+			wait = min(wait*2, maxJetStreamRetryWait)
+		}
+
+		if err = p.js.publishOnce(ctx, msg); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no JetStream ack for %s after %d attempts: %w", msg.Subject, p.js.opts.MaxRetries+1, err)
+}
+
+// waitUnlocked releases p.mu for d, or until ctx is done, and reacquires it.
+// It returns false if ctx ended the wait.
+func (p *Publisher) waitUnlocked(ctx context.Context, d time.Duration) bool {
+	p.mu.Unlock()
+	defer p.mu.Lock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,218 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// runJetStreamServer starts an in-process NATS server with JetStream enabled
+func runJetStreamServer(t *testing.T) (*nats.Conn, jetstream.JetStream) {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create NATS server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("failed to create JetStream context: %v", err)
+	}
+	return nc, js
+}
+
+func createReportStream(t *testing.T, js jetstream.JetStream) jetstream.Stream {
+	t.Helper()
+	stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "REPORTS",
+		Subjects: []string{"agent.report", "agent.report.delta", "agent.monitoring"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create stream: %v", err)
+	}
+	return stream
+}
+
+func newJetStreamPublisher(t *testing.T, nc *nats.Conn, outbox *Outbox) *Publisher {
+	t.Helper()
+	pub := NewPublisher(nc, outbox)
+	err := pub.EnableJetStream(JetStreamOptions{
+		AgentID:    "agent-1",
+		AckTimeout: 200 * time.Millisecond,
+		MaxRetries: 2,
+		RetryWait:  10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("EnableJetStream() error = %v", err)
+	}
+	return pub
+}
+
+func TestPublisher_JetStreamAckAndMsgID(t *testing.T) {
+	nc, js := runJetStreamServer(t)
+	stream := createReportStream(t, js)
+	pub := newJetStreamPublisher(t, nc, nil)
+
+	for range 2 {
+		if err := pub.PublishJSON("agent.report", map[string]string{"fqdn": "host1"}, false); err != nil {
+			t.Fatalf("PublishJSON() error = %v", err)
+		}
+	}
+
+	info, _ := stream.Info(context.Background())
+	if info.State.Msgs != 2 {
+		t.Fatalf("stream has %d messages, want 2", info.State.Msgs)
+	}
+
+	var ids []string
+	for seq := uint64(1); seq <= 2; seq++ {
+		msg, err := stream.GetMsg(context.Background(), seq)
+		if err != nil {
+			t.Fatalf("GetMsg(%d) error = %v", seq, err)
+		}
+		ids = append(ids, msg.Header.Get(nats.MsgIdHdr))
+	}
+	if !strings.HasPrefix(ids[0], "agent-1-agent.report-") || ids[0] == ids[1] {
+		t.Errorf("unexpected message IDs %v, want distinct agent-1-agent.report-<sequence>", ids)
+	}
+}
+
+func TestPublisher_JetStreamMsgIDFromSequence(t *testing.T) {
+	nc, js := runJetStreamServer(t)
+	stream := createReportStream(t, js)
+	pub := newJetStreamPublisher(t, nc, nil)
+
+	// Sending the same report again, e.g. after a restart, is deduplicated
+	for range 2 {
+		if err := pub.PublishJSONContext(context.Background(), "agent.report", 7, map[string]string{"fqdn": "host1"}, false); err != nil {
+			t.Fatalf("PublishJSONContext() error = %v", err)
+		}
+	}
+
+	info, _ := stream.Info(context.Background())
+	if info.State.Msgs != 1 {
+		t.Fatalf("stream has %d messages, want 1", info.State.Msgs)
+	}
+	msg, _ := stream.GetMsg(context.Background(), 1)
+	if got := msg.Header.Get(nats.MsgIdHdr); got != "agent-1-agent.report-7" {
+		t.Errorf("Nats-Msg-Id = %q, want agent-1-agent.report-7", got)
+	}
+}
+
+func TestPublisher_JetStreamBackoffReleasesLock(t *testing.T) {
+	nc, _ := runJetStreamServer(t)
+	pub := NewPublisher(nc, nil)
+	err := pub.EnableJetStream(JetStreamOptions{
+		AgentID:    "agent-1",
+		AckTimeout: 50 * time.Millisecond,
+		MaxRetries: 5,
+		RetryWait:  time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("EnableJetStream() error = %v", err)
+	}
+
+	// No stream exists, so the publish waits to retry
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- pub.PublishJSONContext(ctx, "agent.report", 1, map[string]string{}, false)
+	}()
+
+	// Past the first attempt's ack timeout, into the backoff
+	time.Sleep(300 * time.Millisecond)
+	if !pub.mu.TryLock() {
+		t.Fatal("publisher lock was held during backoff")
+	}
+	pub.mu.Unlock()
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish did not stop when ctx was cancelled")
+	}
+}
+
+func TestPublisher_JetStreamDedupesRetries(t *testing.T) {
+	nc, js := runJetStreamServer(t)
+	stream := createReportStream(t, js)
+	pub := newJetStreamPublisher(t, nc, nil)
+
+	// Simulate an ack lost after the server stored the message: the retry
+	// carries the same Nats-Msg-Id and must not be stored twice.
+	msg := &nats.Msg{Subject: "agent.report", Data: []byte(`{}`), Header: nats.Header{}}
+	msg.Header.Set(nats.MsgIdHdr, pub.js.msgID(msg.Subject, 0))
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+	for range 2 {
+		if err := pub.publishJetStreamLocked(context.Background(), msg); err != nil {
+			t.Fatalf("publishJetStreamLocked() error = %v", err)
+		}
+	}
+
+	info, _ := stream.Info(context.Background())
+	if info.State.Msgs != 1 {
+		t.Errorf("stream has %d messages, want 1", info.State.Msgs)
+	}
+}
+
+func TestPublisher_JetStreamNoAckSpoolsAndReplays(t *testing.T) {
+	nc, js := runJetStreamServer(t)
+	outbox, err := OpenOutbox(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("OpenOutbox() error = %v", err)
+	}
+	pub := newJetStreamPublisher(t, nc, outbox)
+
+	// No stream exists yet, so there is nobody to ack the publish
+	if err := pub.PublishJSONContext(context.Background(), "agent.monitoring", 42, map[string]string{"fqdn": "host1"}, false); err != nil {
+		t.Fatalf("PublishJSONContext() error = %v", err)
+	}
+	if outbox.Pending() != 1 {
+		t.Fatalf("Pending() = %d, want the unacked message spooled", outbox.Pending())
+	}
+
+	stream := createReportStream(t, js)
+	pub.mu.Lock()
+	pub.replayLocked(context.Background())
+	pub.mu.Unlock()
+
+	if outbox.Pending() != 0 {
+		t.Errorf("Pending() = %d after replay, want 0", outbox.Pending())
+	}
+	msg, err := stream.GetMsg(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetMsg() error = %v", err)
+	}
+	if msg.Header.Get(nats.MsgIdHdr) != "agent-1-agent.monitoring-42" {
+		t.Errorf("replayed message lost its original ID: %q", msg.Header.Get(nats.MsgIdHdr))
+	}
+}
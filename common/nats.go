@@ -56,22 +56,9 @@ func ConnectNATS(url string, seed string) (*nats.Conn, error) {
 // PublishJSON marshals data to JSON and publishes it to the given NATS subject.
 // If useGzip is true, the payload is gzip-compressed before publishing.
 func PublishJSON(nc *nats.Conn, subject string, data any, useGzip bool) error {
-	jsonBytes, err := json.Marshal(data)
+	payload, err := encodeJSON(data, useGzip)
 	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
-	}
-
-	payload := jsonBytes
-	if useGzip {
-		var buf bytes.Buffer
-		w := gzip.NewWriter(&buf)
-		if _, err := w.Write(jsonBytes); err != nil {
-			return fmt.Errorf("failed to gzip payload: %w", err)
-		}
-		if err := w.Close(); err != nil {
-			return fmt.Errorf("failed to close gzip writer: %w", err)
-		}
-		payload = buf.Bytes()
+		return err
 	}
 
 	if err := nc.Publish(subject, payload); err != nil {
@@ -82,6 +69,28 @@ func PublishJSON(nc *nats.Conn, subject string, data any, useGzip bool) error {
 	return nil
 }
 
+// encodeJSON marshals data to JSON, gzip-compressing it if useGzip is true
+func encodeJSON(data any, useGzip bool) ([]byte, error) {
+	jsonBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	if !useGzip {
+		return jsonBytes, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(jsonBytes); err != nil {
+		return nil, fmt.Errorf("failed to gzip payload: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
 // ReverseFQDN reverses the parts of an FQDN for use in NATS subject hierarchies.
 // e.g., "server1.example.com" → "com.example.server1"
 func ReverseFQDN(fqdn string) string {
@@ -0,0 +1,278 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrMessageTooLarge is returned by Enqueue for a message that is larger than the outbox size bound
+var ErrMessageTooLarge = errors.New("message exceeds the outbox size bound")
+
+// OutboxMessage is a message spooled to disk while NATS is unavailable
+type OutboxMessage struct {
+	Subject    string    `json:"subject"`
+	MsgID      string    `json:"msg_id,omitempty"` // JetStream Nats-Msg-Id, reused on replay
+	Data       []byte    `json:"data"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+// OutboxStats reports the state of the outbox, e.g. for the heartbeat
+type OutboxStats struct {
+	Queued      int    `json:"queued"`
+	QueuedBytes int64  `json:"queued_bytes"`
+	Spooled     uint64 `json:"spooled_total"`
+	Replayed    uint64 `json:"replayed_total"`
+	Dropped     uint64 `json:"dropped_total"`
+}
+
+// outboxEntry is the in-memory index of a spooled message file
+type outboxEntry struct {
+	seq        uint64
+	path       string
+	size       int64
+	enqueuedAt time.Time
+}
+
+// Outbox is a durable FIFO of messages stored one file per message in a directory.
+// It is bounded by total size and message age; the oldest messages are dropped first.
+// It is safe for concurrent use.
+type Outbox struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu      sync.Mutex
+	entries []outboxEntry
+	bytes   int64
+	nextSeq uint64
+	stats   OutboxStats
+}
+
+const outboxFileSuffix = ".msg"
+
+// OpenOutbox opens (creating if needed) an outbox in dir, loading any messages
+// left over from a previous run. maxBytes and maxAge of zero disable that bound.
+func OpenOutbox(dir string, maxBytes int64, maxAge time.Duration) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	o := &Outbox{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		nextSeq:  1,
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+outboxFileSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox: %w", err)
+	}
+
+	for _, path := range files {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), outboxFileSuffix), 10, 64)
+		if err != nil {
+			continue // not ours
+		}
+		msg, size, err := readOutboxFile(path)
+		if err != nil {
+			slog.Warn("Discarding unreadable outbox message", slog.String("path", path), slog.String("error", err.Error()))
+			_ = os.Remove(path)
+			o.stats.Dropped++
+			continue
+		}
+		o.entries = append(o.entries, outboxEntry{seq: seq, path: path, size: size, enqueuedAt: msg.EnqueuedAt})
+		o.bytes += size
+		if seq >= o.nextSeq {
+			o.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(o.entries, func(i, j int) bool { return o.entries[i].seq < o.entries[j].seq })
+
+	o.mu.Lock()
+	o.enforceBoundsLocked(time.Now())
+	o.mu.Unlock()
+
+	if len(o.entries) > 0 {
+		slog.Info("Loaded outbox", slog.Int("queued", len(o.entries)), slog.Int64("bytes", o.bytes))
+	}
+	return o, nil
+}
+
+// Enqueue appends msg to the outbox, dropping the oldest messages if it is over its size bound.
+// A message that wouldn't fit in an empty outbox is counted as dropped and ErrMessageTooLarge
+// is returned, rather than evicting everything queued before it.
+func (o *Outbox) Enqueue(msg OutboxMessage) error {
+	if msg.EnqueuedAt.IsZero() {
+		msg.EnqueuedAt = time.Now().UTC()
+	}
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.maxBytes > 0 && int64(len(content)) > o.maxBytes {
+		o.stats.Dropped++
+		slog.Warn("Dropped message too large for outbox",
+			slog.String("subject", msg.Subject),
+			slog.Int("bytes", len(content)),
+			slog.Int64("max_bytes", o.maxBytes),
+		)
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrMessageTooLarge, len(content), o.maxBytes)
+	}
+
+	seq := o.nextSeq
+	o.nextSeq++
+	path := filepath.Join(o.dir, fmt.Sprintf("%020d%s", seq, outboxFileSuffix))
+	if err := WriteFileAtomic(path, content, 0600); err != nil {
+		return fmt.Errorf("failed to spool message: %w", err)
+	}
+
+	o.entries = append(o.entries, outboxEntry{seq: seq, path: path, size: int64(len(content)), enqueuedAt: msg.EnqueuedAt})
+	o.bytes += int64(len(content))
+	o.stats.Spooled++
+	o.enforceBoundsLocked(time.Now())
+
+	slog.Debug("Spooled message to outbox", slog.String("subject", msg.Subject), slog.Int("queued", len(o.entries)))
+	return nil
+}
+
+// Pending returns the number of queued messages
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Stats returns a snapshot of the outbox counters
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := o.stats
+	stats.Queued = len(o.entries)
+	stats.QueuedBytes = o.bytes
+	return stats
+}
+
+// Replay sends queued messages oldest-first with publish, calling flush after each
+// batch of up to batchSize messages. Messages are removed only once flush succeeds,
+// so a failure mid-batch means they are sent again later (at-least-once).
+// It returns the number of messages replayed and stops at the first error.
+func (o *Outbox) Replay(publish func(OutboxMessage) error, flush func() error, batchSize int) (int, error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	replayed := 0
+
+	for {
+		o.mu.Lock()
+		o.enforceBoundsLocked(time.Now())
+		n := min(batchSize, len(o.entries))
+		batch := make([]outboxEntry, n)
+		copy(batch, o.entries[:n])
+		o.mu.Unlock()
+
+		if len(batch) == 0 {
+			return replayed, nil
+		}
+
+		unreadable := make(map[uint64]bool)
+		for _, entry := range batch {
+			msg, _, err := readOutboxFile(entry.path)
+			if err != nil {
+				// Corrupt or vanished; publish nothing for it and let ack drop it
+				slog.Warn("Dropping unreadable outbox message",
+					slog.String("file", filepath.Base(entry.path)),
+					slog.String("error", err.Error()),
+				)
+				unreadable[entry.seq] = true
+				continue
+			}
+			if err := publish(msg); err != nil {
+				return replayed, err
+			}
+		}
+		if err := flush(); err != nil {
+			return replayed, err
+		}
+
+		o.ack(batch, unreadable)
+		replayed += len(batch) - len(unreadable)
+	}
+}
+
+// ack removes delivered entries from the outbox; those in unreadable count as dropped
+func (o *Outbox) ack(batch []outboxEntry, unreadable map[uint64]bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delivered := make(map[uint64]bool, len(batch))
+	for _, e := range batch {
+		delivered[e.seq] = true
+	}
+	kept := o.entries[:0]
+	for _, e := range o.entries {
+		if delivered[e.seq] {
+			o.removeFileLocked(e)
+			if unreadable[e.seq] {
+				o.stats.Dropped++
+			} else {
+				o.stats.Replayed++
+			}
+			continue
+		}
+		kept = append(kept, e)
+	}
+	o.entries = kept
+}
+
+// enforceBoundsLocked drops expired messages and then the oldest until under maxBytes
+func (o *Outbox) enforceBoundsLocked(now time.Time) {
+	dropped := 0
+	for len(o.entries) > 0 {
+		oldest := o.entries[0]
+		expired := o.maxAge > 0 && now.Sub(oldest.enqueuedAt) > o.maxAge
+		oversize := o.maxBytes > 0 && o.bytes > o.maxBytes
+		if !expired && !oversize {
+			break
+		}
+		o.removeFileLocked(oldest)
+		o.entries = o.entries[1:]
+		o.stats.Dropped++
+		dropped++
+	}
+	if dropped > 0 {
+		slog.Warn("Dropped messages from outbox", slog.Int("dropped", dropped), slog.Int("queued", len(o.entries)))
+	}
+}
+
+func (o *Outbox) removeFileLocked(e outboxEntry) {
+	o.bytes -= e.size
+	if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+		slog.Error("Failed to remove outbox message", slog.String("path", e.path), slog.String("error", err.Error()))
+	}
+}
+
+func readOutboxFile(path string) (OutboxMessage, int64, error) {
+	var msg OutboxMessage
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return msg, 0, err
+	}
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return msg, 0, err
+	}
+	return msg, int64(len(content)), nil
+}
@@ -0,0 +1,196 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func enqueueN(t *testing.T, o *Outbox, n int) {
+	t.Helper()
+	for i := range n {
+		if err := o.Enqueue(OutboxMessage{Subject: "agent.report", Data: []byte(fmt.Sprintf("msg-%d", i))}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+}
+
+func collectReplay(t *testing.T, o *Outbox) []string {
+	t.Helper()
+	var got []string
+	_, err := o.Replay(func(msg OutboxMessage) error {
+		got = append(got, string(msg.Data))
+		return nil
+	}, func() error { return nil }, 2)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	return got
+}
+
+func TestOutbox_ReplaysInOrderAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	o, err := OpenOutbox(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenOutbox() error = %v", err)
+	}
+	enqueueN(t, o, 5)
+
+	// Reopen to simulate an agent restart
+	reopened, err := OpenOutbox(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenOutbox() error = %v", err)
+	}
+	if reopened.Pending() != 5 {
+		t.Fatalf("Pending() = %d, want 5", reopened.Pending())
+	}
+	enqueueN(t, reopened, 1)
+
+	got := collectReplay(t, reopened)
+	want := []string{"msg-0", "msg-1", "msg-2", "msg-3", "msg-4", "msg-0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+	if reopened.Pending() != 0 {
+		t.Errorf("Pending() = %d after replay, want 0", reopened.Pending())
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+outboxFileSuffix))
+	if len(files) != 0 {
+		t.Errorf("expected replayed files to be removed, found %v", files)
+	}
+	if stats := reopened.Stats(); stats.Replayed != 6 {
+		t.Errorf("Replayed = %d, want 6", stats.Replayed)
+	}
+}
+
+func TestOutbox_ReplayErrorKeepsMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		publish   func(n int) error
+		flush     func() error
+		wantCount int
+		wantLeft  int
+	}{
+		{
+			name: "publish fails mid batch",
+			publish: func(n int) error {
+				if n == 3 {
+					return errors.New("disconnected")
+				}
+				return nil
+			},
+			flush:     func() error { return nil },
+			wantCount: 2,
+			wantLeft:  2,
+		},
+		{
+			name:      "flush fails",
+			publish:   func(n int) error { return nil },
+			flush:     func() error { return errors.New("timeout") },
+			wantCount: 0,
+			wantLeft:  4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _ := OpenOutbox(t.TempDir(), 0, 0)
+			enqueueN(t, o, 4)
+
+			calls := 0
+			replayed, err := o.Replay(func(OutboxMessage) error {
+				calls++
+				return tt.publish(calls)
+			}, tt.flush, 2)
+			if err == nil {
+				t.Fatal("expected Replay() to return an error")
+			}
+			if replayed != tt.wantCount {
+				t.Errorf("replayed = %d, want %d", replayed, tt.wantCount)
+			}
+			if o.Pending() != tt.wantLeft {
+				t.Errorf("Pending() = %d, want %d", o.Pending(), tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestOutbox_SizeBoundDropsOldest(t *testing.T) {
+	o, _ := OpenOutbox(t.TempDir(), 0, 0)
+	enqueueN(t, o, 1)
+	size := o.Stats().QueuedBytes
+
+	// Room for three messages
+	bounded, _ := OpenOutbox(t.TempDir(), size*3, 0)
+	enqueueN(t, bounded, 5)
+
+	if bounded.Pending() != 3 {
+		t.Fatalf("Pending() = %d, want 3", bounded.Pending())
+	}
+	if got := collectReplay(t, bounded); !reflect.DeepEqual(got, []string{"msg-2", "msg-3", "msg-4"}) {
+		t.Errorf("replayed %v, want the newest three", got)
+	}
+	if stats := bounded.Stats(); stats.Dropped != 2 || stats.Spooled != 5 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestOutbox_MessageLargerThanBound(t *testing.T) {
+	o, _ := OpenOutbox(t.TempDir(), 0, 0)
+	enqueueN(t, o, 1)
+	size := o.Stats().QueuedBytes
+
+	bounded, _ := OpenOutbox(t.TempDir(), size*2, 0)
+	enqueueN(t, bounded, 2)
+	err := bounded.Enqueue(OutboxMessage{Subject: "agent.report", Data: make([]byte, size*2)})
+	if !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+
+	// The queued messages are kept
+	if got := collectReplay(t, bounded); !reflect.DeepEqual(got, []string{"msg-0", "msg-1"}) {
+		t.Errorf("replayed %v, want the messages queued before", got)
+	}
+	if stats := bounded.Stats(); stats.Dropped != 1 || stats.Spooled != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestOutbox_AgeBoundDropsExpired(t *testing.T) {
+	dir := t.TempDir()
+	o, _ := OpenOutbox(dir, 0, time.Hour)
+	_ = o.Enqueue(OutboxMessage{Subject: "agent.report", Data: []byte("old"), EnqueuedAt: time.Now().Add(-2 * time.Hour)})
+	_ = o.Enqueue(OutboxMessage{Subject: "agent.report", Data: []byte("new")})
+
+	if got := collectReplay(t, o); !reflect.DeepEqual(got, []string{"new"}) {
+		t.Errorf("replayed %v, want only the unexpired message", got)
+	}
+	if stats := o.Stats(); stats.Dropped != 1 {
+		t.Errorf("Dropped = %d, want 1", stats.Dropped)
+	}
+}
+
+func TestOutbox_UnreadableMessagesCountAsDropped(t *testing.T) {
+	o, _ := OpenOutbox(t.TempDir(), 0, 0)
+	enqueueN(t, o, 3)
+
+	// Corrupt the middle message after it was indexed
+	if err := os.WriteFile(o.entries[1].path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := o.Replay(func(OutboxMessage) error { return nil }, func() error { return nil }, 10)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 2 {
+		t.Errorf("Replay() = %d, want 2", replayed)
+	}
+	if stats := o.Stats(); stats.Replayed != 2 || stats.Dropped != 1 || stats.Queued != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
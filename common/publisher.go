@@ -0,0 +1,198 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	outboxReplayInterval = 5 * time.Second
+	outboxReplayBatch    = 50
+	outboxFlushTimeout   = 10 * time.Second
+)
+
+// Publisher publishes durable messages (reports, monitoring results) to NATS.
+// If an outbox is attached, messages that can't be published are spooled to disk
+// and replayed in order once the connection is back. With JetStream enabled,
+// messages are only considered delivered once the server acks them.
+type Publisher struct {
+	nc     *nats.Conn
+	outbox *Outbox
+	js     *jetStreamPublisher
+
+	// mu serializes direct publishes with outbox replay so ordering is preserved
+	mu sync.Mutex
+}
+
+// NewPublisher returns a Publisher for nc. outbox may be nil to disable spooling.
+func NewPublisher(nc *nats.Conn, outbox *Outbox) *Publisher {
+	return &Publisher{nc: nc, outbox: outbox}
+}
+
+// Conn returns the underlying NATS connection
+func (p *Publisher) Conn() *nats.Conn {
+	return p.nc
+}
+
+// OutboxStats returns the outbox counters, or nil if no outbox is attached
+func (p *Publisher) OutboxStats() *OutboxStats {
+	if p.outbox == nil {
+		return nil
+	}
+	stats := p.outbox.Stats()
+	return &stats
+}
+
+// PublishJSON encodes data like PublishJSON and publishes it, spooling it to the
+// outbox if NATS is disconnected, the publish fails, or older messages are still queued.
+func (p *Publisher) PublishJSON(subject string, data any, useGzip bool) error {
+	return p.PublishJSONContext(context.Background(), subject, 0, data, useGzip)
+}
+
+// PublishJSONContext is like PublishJSON but stops retrying once ctx is done. With
+// JetStream enabled, the Nats-Msg-Id is derived from sequence, so callers that number
+// their messages (e.g. reports) get the same ID every time that message is sent; a zero
+// sequence uses the publisher's own.
+//
+// Without an outbox, a missing JetStream ack is retried with backoff. With an outbox the
+// message is spooled instead and retried by the outbox replay, so it can't be overtaken.
+func (p *Publisher) PublishJSONContext(ctx context.Context, subject string, sequence uint64, data any, useGzip bool) error {
+	payload, err := encodeJSON(data, useGzip)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	msg := &nats.Msg{Subject: subject, Data: payload}
+	if p.js != nil {
+		msg.Header = nats.Header{}
+		msg.Header.Set(nats.MsgIdHdr, p.js.msgID(subject, sequence))
+	}
+
+	if p.outbox == nil {
+		return p.publishLocked(ctx, msg, true)
+	}
+
+	// Don't overtake messages that are already queued
+	if p.outbox.Pending() > 0 && p.nc.IsConnected() {
+		p.replayLocked(ctx)
+	}
+	if p.outbox.Pending() > 0 || !p.nc.IsConnected() {
+		return p.spool(msg)
+	}
+
+	if err := p.publishLocked(ctx, msg, false); err != nil {
+		slog.Warn("Publish failed, spooling to outbox", slog.String("subject", subject), slog.String("error", err.Error()))
+		return p.spool(msg)
+	}
+	return nil
+}
+
+// RunOutbox replays spooled messages whenever NATS is connected, until ctx is done
+func (p *Publisher) RunOutbox(ctx context.Context) {
+	if p.outbox == nil {
+		return
+	}
+
+	ticker := time.NewTicker(outboxReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if p.outbox.Pending() == 0 || !p.nc.IsConnected() {
+				continue
+			}
+			p.mu.Lock()
+			p.replayLocked(ctx)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Drain unsubscribes, flushes pending publishes and closes the connection, waiting up to
+// timeout for that to finish. Messages still in the outbox stay there for the next start.
+func (p *Publisher) Drain(timeout time.Duration) error {
+	if err := p.nc.Drain(); err != nil {
+		return fmt.Errorf("failed to drain NATS connection: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for !p.nc.IsClosed() {
+		if time.Now().After(deadline) {
+			p.nc.Close()
+			return fmt.Errorf("timed out after %s draining NATS connection", timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+// replayLocked sends as much of the outbox as possible; p.mu must be held
+func (p *Publisher) replayLocked(ctx context.Context) {
+	replayed, err := p.outbox.Replay(
+		func(msg OutboxMessage) error {
+			m := &nats.Msg{Subject: msg.Subject, Data: msg.Data}
+			if msg.MsgID != "" {
+				m.Header = nats.Header{}
+				m.Header.Set(nats.MsgIdHdr, msg.MsgID)
+			}
+			// A failure stops the replay; the next one retries
+			return p.publishLocked(ctx, m, false)
+		},
+		func() error {
+			if p.js != nil {
+				return nil // every message has already been acked
+			}
+			return p.nc.FlushTimeout(outboxFlushTimeout)
+		},
+		outboxReplayBatch,
+	)
+	if replayed > 0 {
+		slog.Info("Replayed messages from outbox", slog.Int("replayed", replayed), slog.Int("remaining", p.outbox.Pending()))
+	}
+	if err != nil {
+		slog.Warn("Outbox replay interrupted", slog.String("error", err.Error()))
+	}
+}
+
+// publishLocked sends msg. With JetStream, retry selects whether a missing ack is
+// retried with backoff; p.mu must be held.
+func (p *Publisher) publishLocked(ctx context.Context, msg *nats.Msg, retry bool) error {
+	if p.js != nil {
+		if retry {
+			return p.publishJetStreamLocked(ctx, msg)
+		}
+		if err := p.js.publishOnce(ctx, msg); err != nil {
+			return fmt.Errorf("no JetStream ack for %s: %w", msg.Subject, err)
+		}
+		return nil
+	}
+	if err := p.nc.PublishMsg(msg); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", msg.Subject, err)
+	}
+	slog.Debug("Published message", slog.String("subject", msg.Subject), slog.Int("bytes", len(msg.Data)))
+	return nil
+}
+
+// spool queues msg in the outbox with its Nats-Msg-Id, so a JetStream replay is
+// deduplicated against any earlier attempt that did reach the stream
+func (p *Publisher) spool(msg *nats.Msg) error {
+	entry := OutboxMessage{Subject: msg.Subject, Data: msg.Data}
+	if msg.Header != nil {
+		entry.MsgID = msg.Header.Get(nats.MsgIdHdr)
+	}
+	if err := p.outbox.Enqueue(entry); err != nil {
+		return fmt.Errorf("failed to publish to %s and could not spool: %w", msg.Subject, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestPublisher_DrainDeliversPending(t *testing.T) {
+	nc, _ := runJetStreamServer(t)
+	sub, err := nats.Connect(nc.ConnectedUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	received, err := sub.SubscribeSync("agent.report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := NewPublisher(nc, nil)
+	for i := 0; i < 100; i++ {
+		if err := pub.PublishJSON("agent.report", map[string]int{"seq": i}, false); err != nil {
+			t.Fatalf("PublishJSON() error = %v", err)
+		}
+	}
+	if err := pub.Drain(5 * time.Second); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	if !nc.IsClosed() {
+		t.Error("expected the connection to be closed after draining")
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, err := received.NextMsg(time.Second); err != nil {
+			t.Fatalf("message %d not delivered: %v", i, err)
+		}
+	}
+}
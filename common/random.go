@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"math/rand"
 	"time"
 )
@@ -21,3 +22,8 @@ func RandomSleep(minSeconds, maxSeconds int) {
 	// Sleep for the random duration
 	time.Sleep(time.Duration(randomSeconds) * time.Second)
 }
+
+// RandomSleepContext is like RandomSleep but returns early, with false, once ctx is done
+func RandomSleepContext(ctx context.Context, minSeconds, maxSeconds int) bool {
+	return SleepContext(ctx, time.Duration(RandomInt(minSeconds, maxSeconds))*time.Second)
+}
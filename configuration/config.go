@@ -2,9 +2,14 @@ package configuration
 
 import (
 	"cartographer-go-agent/common"
+	"crypto/ed25519"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -22,6 +27,44 @@ type JSONCommand struct {
 	Timeout int    `yaml:"timeout"`
 }
 
+const (
+	// DefaultCollectorConcurrency is the number of collectors run in parallel when not configured
+	DefaultCollectorConcurrency = 4
+	// DefaultCollectorTimeoutSeconds is the per-collector deadline when not configured
+	DefaultCollectorTimeoutSeconds = 60
+	// DefaultFullReportEvery is how often a full report is sent when delta reporting is enabled
+	DefaultFullReportEvery = 12
+	// DefaultOutboxMaxMB bounds the outbox size when not configured
+	DefaultOutboxMaxMB = 50
+	// DefaultOutboxMaxAgeHours is how long spooled messages are kept when not configured
+	DefaultOutboxMaxAgeHours = 24
+	// DefaultJetStreamAckTimeoutSeconds is how long to wait for a JetStream PubAck when not configured
+	DefaultJetStreamAckTimeoutSeconds = 5
+	// DefaultJetStreamMaxRetries is how often an unacked publish is retried when not configured
+	DefaultJetStreamMaxRetries = 3
+	// DefaultUpdateStateDir holds self-update state and health markers when not configured
+	DefaultUpdateStateDir = "/var/lib/cartographer-agent"
+	// DefaultUpdateHealthTimeoutSeconds is how long an updated agent has to report healthy when not configured
+	DefaultUpdateHealthTimeoutSeconds = 300
+	// DefaultShutdownGraceSeconds is how long running tasks may take to finish on shutdown when not configured
+	DefaultShutdownGraceSeconds = 30
+	// DefaultMonitorConcurrency is the number of monitors run in parallel when not configured
+	DefaultMonitorConcurrency = 8
+	// DefaultCommandMonitorConcurrency limits parallel command monitors when not configured
+	DefaultCommandMonitorConcurrency = 4
+	// DefaultMonitorStateFile persists monitor state across restarts when not configured
+	DefaultMonitorStateFile = "/var/lib/cartographer-agent/monitor-state.json"
+)
+
+// DefaultCertificatePaths are searched for certificates when certificate_paths is not set
+var DefaultCertificatePaths = []string{
+	"/etc/letsencrypt/live/*/fullchain.pem",
+	"/etc/ssl/*.crt",
+	"/etc/ssl/*.pem",
+	"/etc/ssl/private/*.crt",
+	"/etc/ssl/private/*.pem",
+}
+
 // Config represents the configuration for the agent
 type Config struct {
 	NatsURL          string           `yaml:"nats_url"`
@@ -37,7 +80,50 @@ type Config struct {
 	ReleaseURL       string           `yaml:"release_url"`
 	EnableMonitoring *bool            `yaml:"enable_monitoring"`
 	MonitorsDir      string           `yaml:"monitors_dir"`
-	DRYRUN           bool
+
+	// Self-update verification
+	ReleaseChecksumsURL  string `yaml:"release_checksums_url"` // defaults to checksums.txt next to the binary
+	ReleaseSignatureURL  string `yaml:"release_signature_url"` // defaults to the checksums URL + ".sig"
+	UpdatePublicKey      string `yaml:"update_public_key"`     // base64 ed25519 key; overrides the embedded key
+	AllowUnsignedUpdates bool   `yaml:"allow_unsigned_updates"`
+
+	// Self-update rollback: the new version must report healthy within the timeout
+	UpdateStateDir             string `yaml:"update_state_dir"`
+	UpdateHealthTimeoutSeconds int    `yaml:"update_health_timeout_seconds"`
+
+	// Collector execution settings
+	CollectorConcurrency    int            `yaml:"collector_concurrency"`
+	CollectorTimeoutSeconds int            `yaml:"collector_timeout_seconds"`
+	CollectorTimeouts       map[string]int `yaml:"collector_timeouts"` // per-collector overrides, in seconds
+	ServeStaleOnTimeout     bool           `yaml:"serve_stale_on_timeout"`
+	CacheDir                string         `yaml:"cache_dir"` // persist collector results here across restarts; disabled if empty
+
+	// Delta reporting: send only changed sections between full reports
+	DeltaReports    bool `yaml:"delta_reports"`
+	FullReportEvery int  `yaml:"full_report_every"` // send a full report every N reports
+
+	// Outbox: spool reports and monitoring results to disk while NATS is unavailable
+	OutboxDir         string `yaml:"outbox_dir"` // disabled if empty
+	OutboxMaxMB       int    `yaml:"outbox_max_mb"`
+	OutboxMaxAgeHours int    `yaml:"outbox_max_age_hours"`
+
+	// JetStream: publish reports and monitoring results with acks and server-side dedupe
+	JetStream                  bool `yaml:"jetstream"`
+	JetStreamAckTimeoutSeconds int  `yaml:"jetstream_ack_timeout_seconds"`
+	JetStreamMaxRetries        int  `yaml:"jetstream_max_retries"`
+
+	// Shutdown: running collectors, monitors and commands get this long to finish on SIGTERM
+	ShutdownGraceSeconds int `yaml:"shutdown_grace_seconds"`
+
+	// Monitor execution: how many checks may run at once, overall and per monitor type
+	MonitorConcurrency     int            `yaml:"monitor_concurrency"`
+	MonitorTypeConcurrency map[string]int `yaml:"monitor_type_concurrency"` // e.g. command: 2
+	MonitorStateFile       string         `yaml:"monitor_state_file"`       // status history and flap state
+
+	// Certificate inventory: PEM files matching these globs, plus those nginx references
+	CertificatePaths []string `yaml:"certificate_paths"`
+
+	DRYRUN bool
 }
 
 // GetConfig reads the configuration from the provided path
@@ -103,6 +189,51 @@ func ValidateConfig(config Config) error {
 		return fmt.Errorf("log_level must be one of 'info', 'debug', 'warn', or 'error'")
 	}
 
+	if config.CollectorConcurrency < 0 {
+		return fmt.Errorf("collector_concurrency must not be negative")
+	}
+	if config.CollectorTimeoutSeconds < 0 {
+		return fmt.Errorf("collector_timeout_seconds must not be negative")
+	}
+	if config.OutboxMaxMB < 0 || config.OutboxMaxAgeHours < 0 {
+		return fmt.Errorf("outbox_max_mb and outbox_max_age_hours must not be negative")
+	}
+	if config.JetStreamAckTimeoutSeconds < 0 || config.JetStreamMaxRetries < 0 {
+		return fmt.Errorf("jetstream_ack_timeout_seconds and jetstream_max_retries must not be negative")
+	}
+	if config.MonitorConcurrency < 0 {
+		return fmt.Errorf("monitor_concurrency must not be negative")
+	}
+	for monitorType, limit := range config.MonitorTypeConcurrency {
+		if limit < 1 {
+			return fmt.Errorf("monitor_type_concurrency.%s must be greater than 0", monitorType)
+		}
+	}
+	if config.ShutdownGraceSeconds < 0 {
+		return fmt.Errorf("shutdown_grace_seconds must not be negative")
+	}
+	if config.UpdateHealthTimeoutSeconds < 0 {
+		return fmt.Errorf("update_health_timeout_seconds must not be negative")
+	}
+	if config.UpdatePublicKey != "" {
+		if _, err := ParseUpdatePublicKey(config.UpdatePublicKey); err != nil {
+			return err
+		}
+	}
+	if config.FullReportEvery < 0 {
+		return fmt.Errorf("full_report_every must not be negative")
+	}
+	for _, pattern := range config.CertificatePaths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid certificate_paths pattern '%s': %w", pattern, err)
+		}
+	}
+	for name, timeout := range config.CollectorTimeouts {
+		if timeout < 1 {
+			return fmt.Errorf("collector_timeouts.%s must be greater than 0", name)
+		}
+	}
+
 	return nil
 }
 
@@ -110,3 +241,131 @@ func ValidateConfig(config Config) error {
 func (c *Config) IsMonitoringEnabled() bool {
 	return c.EnableMonitoring != nil && *c.EnableMonitoring
 }
+
+// GetCollectorConcurrency returns the number of collectors that may run in parallel
+func (c *Config) GetCollectorConcurrency() int {
+	if c.CollectorConcurrency > 0 {
+		return c.CollectorConcurrency
+	}
+	return DefaultCollectorConcurrency
+}
+
+// GetCollectorTimeout returns the deadline for the named collector, honoring per-collector overrides
+func (c *Config) GetCollectorTimeout(name string) time.Duration {
+	if seconds, ok := c.CollectorTimeouts[name]; ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if c.CollectorTimeoutSeconds > 0 {
+		return time.Duration(c.CollectorTimeoutSeconds) * time.Second
+	}
+	return DefaultCollectorTimeoutSeconds * time.Second
+}
+
+// GetFullReportEvery returns how many reports may pass between full reports in delta mode
+func (c *Config) GetFullReportEvery() int {
+	if c.FullReportEvery > 0 {
+		return c.FullReportEvery
+	}
+	return DefaultFullReportEvery
+}
+
+// GetOutboxLimits returns the maximum outbox size in bytes and the maximum age of spooled messages
+func (c *Config) GetOutboxLimits() (int64, time.Duration) {
+	maxMB := c.OutboxMaxMB
+	if maxMB == 0 {
+		maxMB = DefaultOutboxMaxMB
+	}
+	maxAgeHours := c.OutboxMaxAgeHours
+	if maxAgeHours == 0 {
+		maxAgeHours = DefaultOutboxMaxAgeHours
+	}
+	return int64(maxMB) * 1024 * 1024, time.Duration(maxAgeHours) * time.Hour
+}
+
+// GetJetStreamAckTimeout returns how long to wait for a JetStream PubAck
+func (c *Config) GetJetStreamAckTimeout() time.Duration {
+	if c.JetStreamAckTimeoutSeconds > 0 {
+		return time.Duration(c.JetStreamAckTimeoutSeconds) * time.Second
+	}
+	return DefaultJetStreamAckTimeoutSeconds * time.Second
+}
+
+// GetJetStreamMaxRetries returns how often an unacked JetStream publish is retried
+func (c *Config) GetJetStreamMaxRetries() int {
+	if c.JetStreamMaxRetries > 0 {
+		return c.JetStreamMaxRetries
+	}
+	return DefaultJetStreamMaxRetries
+}
+
+// ParseUpdatePublicKey decodes a base64 ed25519 public key used to verify self-updates
+func ParseUpdatePublicKey(key string) (ed25519.PublicKey, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("update_public_key is not valid base64: %w", err)
+	}
+	if len(decoded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("update_public_key must be a %d byte ed25519 key, got %d bytes", ed25519.PublicKeySize, len(decoded))
+	}
+	return ed25519.PublicKey(decoded), nil
+}
+
+// GetUpdateStateDir returns the directory for self-update state and health markers
+func (c *Config) GetUpdateStateDir() string {
+	if c.UpdateStateDir != "" {
+		return c.UpdateStateDir
+	}
+	return DefaultUpdateStateDir
+}
+
+// GetUpdateHealthTimeout returns how long an updated agent has to report healthy before it is rolled back
+func (c *Config) GetUpdateHealthTimeout() time.Duration {
+	if c.UpdateHealthTimeoutSeconds > 0 {
+		return time.Duration(c.UpdateHealthTimeoutSeconds) * time.Second
+	}
+	return DefaultUpdateHealthTimeoutSeconds * time.Second
+}
+
+// GetShutdownGrace returns how long running tasks may take to finish once the agent is asked to stop
+func (c *Config) GetShutdownGrace() time.Duration {
+	if c.ShutdownGraceSeconds > 0 {
+		return time.Duration(c.ShutdownGraceSeconds) * time.Second
+	}
+	return DefaultShutdownGraceSeconds * time.Second
+}
+
+// GetMonitorConcurrency returns the number of monitors that may run in parallel
+func (c *Config) GetMonitorConcurrency() int {
+	if c.MonitorConcurrency > 0 {
+		return c.MonitorConcurrency
+	}
+	return DefaultMonitorConcurrency
+}
+
+// GetMonitorStateFile returns the file monitor state is persisted to
+func (c *Config) GetMonitorStateFile() string {
+	if c.MonitorStateFile != "" {
+		return c.MonitorStateFile
+	}
+	return DefaultMonitorStateFile
+}
+
+// GetMonitorTypeConcurrency returns the number of monitors of the given type that may run in parallel
+func (c *Config) GetMonitorTypeConcurrency(monitorType string) int {
+	if limit, ok := c.MonitorTypeConcurrency[monitorType]; ok && limit > 0 {
+		return limit
+	}
+	if monitorType == "command" {
+		return DefaultCommandMonitorConcurrency
+	}
+	return c.GetMonitorConcurrency()
+}
+
+// GetCertificatePaths returns the globs searched for certificates. An empty list in the
+// config disables the search, leaving only the certificates nginx references.
+func (c *Config) GetCertificatePaths() []string {
+	if c.CertificatePaths != nil {
+		return c.CertificatePaths
+	}
+	return DefaultCertificatePaths
+}
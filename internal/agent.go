@@ -4,36 +4,51 @@ import (
 	"cartographer-go-agent/collectors"
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
-	"encoding/json"
+	"context"
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
 	"github.com/nats-io/nats.go"
 )
 
-// agentCommand represents a command received via NATS
-type agentCommand struct {
-	Action        string `json:"action"`
-	TargetVersion string `json:"target_version,omitempty"`
-}
+// RunAgent is the main entry point for the agent. In daemon mode the configuration is
+// reloaded as described by reload, and RunAgent returns once ctx is cancelled: running
+// tasks get the shutdown grace period to finish, and a final heartbeat is sent.
+func RunAgent(ctx context.Context, config configuration.Config, collectorsList []*collectors.CachedCollector, version string, pub *common.Publisher, reload ReloadOptions) {
+	// Tasks keep running for the grace period after ctx is cancelled
+	grace := config.GetShutdownGrace()
+	taskCtx, cancelTasks := common.WithGracePeriod(ctx, grace)
+	defer cancelTasks()
 
-// RunAgent is the main entry point for the agent
-func RunAgent(config configuration.Config, collectorsList []*collectors.Collector, version string, nc *nats.Conn) {
 	// Create a new scheduler
-	scheduler, err := gocron.NewScheduler()
+	scheduler, err := gocron.NewScheduler(gocron.WithStopTimeout(grace))
 	if err != nil {
 		slog.Error("Error creating scheduler", slog.String("error", err.Error()))
 		return
 	}
 
+	// Only send changed sections between full reports if enabled
+	var tracker *DeltaTracker
+	if config.DeltaReports {
+		tracker = NewDeltaTracker(config.GetFullReportEvery())
+		slog.Info("Delta reporting enabled", slog.Int("full_report_every", config.GetFullReportEvery()))
+	}
+
+	// Tasks read the configuration and collectors from state, so a reload applies to their next run
+	state := newAgentState(config, collectorsList)
+	var reloader *reloader
+	if config.Daemonize && reload.ConfigPath != "" && reload.Load != nil {
+		reloader = newReloader(reload, state, pub)
+	}
+
 	// Subscribe to commands for this agent
-	if nc != nil {
-		fqdn := getFQDN(config)
-		commandSubject := "agent.commands." + common.ReverseFQDN(fqdn)
-		_, err := nc.Subscribe(commandSubject, func(msg *nats.Msg) {
-			handleCommand(msg, config, version)
+	if pub != nil {
+		commands := newAgentCommands(state, version, pub, tracker, reloader)
+		commandSubject := "agent.commands." + common.ReverseFQDN(commands.registry.fqdn)
+		// Commands in flight at shutdown get the grace period to finish, like scheduled tasks
+		_, err := pub.Conn().Subscribe(commandSubject, func(msg *nats.Msg) {
+			commands.registry.handleCommand(taskCtx, msg)
 		})
 		if err != nil {
 			slog.Error("Failed to subscribe to commands",
@@ -45,24 +60,35 @@ func RunAgent(config configuration.Config, collectorsList []*collectors.Collecto
 		}
 	}
 
+	// Tells the server this was a clean shutdown rather than a crash
+	sendStopping := func() {
+		config, _ := state.snapshot()
+		sendHeartbeat(config, version, pub, heartbeatStatusStopping)
+	}
+
 	// Send a heartbeat immediately
-	HeartbeatTask(config, version, nc)
+	HeartbeatTask(config, version, pub)
 	// skew the first ReportTask by random time between 0 and 60 seconds
-	common.RandomSleep(0, 60)
-	ReportTask(config, collectorsList, version, nc)
+	if !common.RandomSleepContext(ctx, 0, 60) {
+		// Stopped before anything was scheduled
+		slog.Info("Shutting down during startup delay")
+		sendStopping()
+		return
+	}
+	ReportTask(taskCtx, config, collectorsList, version, pub, tracker)
 
 	if !config.Daemonize {
 		slog.Warn("Non-daemon mode, exiting after sending report")
-		os.Exit(0)
-	} else {
-		slog.Info("Starting agent in daemon mode")
+		return
 	}
+	slog.Info("Starting agent in daemon mode")
 
 	// Schedule the heartbeat task
 	_, err = scheduler.NewJob(
 		gocron.DurationRandomJob(50*time.Second, 55*time.Second),
 		gocron.NewTask(func() {
-			HeartbeatTask(config, version, nc)
+			config, _ := state.snapshot()
+			HeartbeatTask(config, version, pub)
 		}),
 	)
 	if err != nil {
@@ -73,50 +99,56 @@ func RunAgent(config configuration.Config, collectorsList []*collectors.Collecto
 	minInterval, maxInterval := getReportIntervals(config)
 
 	// Schedule the report task using DurationRandomJob for jitter
-	_, err = scheduler.NewJob(
+	reportTask := gocron.NewTask(func() {
+		config, collectorsList := state.snapshot()
+		ReportTask(taskCtx, config, collectorsList, version, pub, tracker)
+	})
+	reportJob, err := scheduler.NewJob(
 		gocron.DurationRandomJob(minInterval, maxInterval),
-		gocron.NewTask(func() {
-			ReportTask(config, collectorsList, version, nc)
-		}),
+		reportTask,
 		gocron.WithSingletonMode(gocron.LimitModeReschedule),
 	)
 	if err != nil {
 		slog.Error("Error scheduling report job", slog.String("error", err.Error()))
 	}
 
-	// Start the scheduler asynchronously
-	scheduler.Start()
-
-	// Keep the agent running indefinitely
-	select {}
-}
-
-func handleCommand(msg *nats.Msg, config configuration.Config, version string) {
-	var cmd agentCommand
-	if err := json.Unmarshal(msg.Data, &cmd); err != nil {
-		slog.Error("Failed to parse command", slog.String("error", err.Error()))
-		return
+	if reloader != nil {
+		reloader.setReschedule(func(config configuration.Config) {
+			if reportJob == nil {
+				return
+			}
+			newMin, newMax := getReportIntervals(config)
+			if newMin == minInterval && newMax == maxInterval {
+				return
+			}
+			job, err := scheduler.Update(reportJob.ID(),
+				gocron.DurationRandomJob(newMin, newMax),
+				reportTask,
+				gocron.WithSingletonMode(gocron.LimitModeReschedule),
+			)
+			if err != nil {
+				slog.Error("Error rescheduling report job", slog.String("error", err.Error()))
+				return
+			}
+			reportJob, minInterval, maxInterval = job, newMin, newMax
+			slog.Info("Rescheduled report job",
+				slog.Duration("min_interval", newMin),
+				slog.Duration("max_interval", newMax),
+			)
+		})
+		go reloader.watch(ctx)
 	}
 
-	slog.Info("Received command", slog.String("action", cmd.Action))
+	// Start the scheduler asynchronously
+	scheduler.Start()
 
-	switch cmd.Action {
-	case "update":
-		if cmd.TargetVersion == "" {
-			slog.Warn("Update command missing target_version")
-			return
-		}
-		if cmd.TargetVersion == version {
-			slog.Debug("Already running target version", slog.String("version", version))
-			return
-		}
-		slog.Info("Triggering self-update", slog.String("target_version", cmd.TargetVersion))
-		if err := SelfUpdate(cmd.TargetVersion, config); err != nil {
-			slog.Error("Self-update failed", slog.String("error", err.Error()))
-		}
-	default:
-		slog.Warn("Unknown command action", slog.String("action", cmd.Action))
+	// Run until asked to stop
+	<-ctx.Done()
+	slog.Info("Shutting down, waiting for running tasks", slog.Duration("grace_period", grace))
+	if err := scheduler.Shutdown(); err != nil {
+		slog.Warn("Scheduled tasks did not finish in time", slog.String("error", err.Error()))
 	}
+	sendStopping()
 }
 
 func getFQDN(config configuration.Config) string {
@@ -0,0 +1,416 @@
+package internal
+
+import (
+	"cartographer-go-agent/collectors"
+	"cartographer-go-agent/common"
+	"cartographer-go-agent/monitors"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// commandTimeout bounds how long a single command may run before it is cancelled
+const commandTimeout = 5 * time.Minute
+
+// runAllMonitors is the run_monitor name that executes every monitor
+const runAllMonitors = "all"
+
+var (
+	// errUnknownCommand is returned for actions without a registered handler
+	errUnknownCommand = errors.New("unknown command action")
+	// errInvalidCommand is returned when a command is missing required arguments
+	errInvalidCommand = errors.New("invalid command")
+)
+
+// agentCommand represents a command received via NATS
+type agentCommand struct {
+	Action        string         `json:"action"`
+	TargetVersion string         `json:"target_version,omitempty"`
+	Rollout       *rolloutPolicy `json:"rollout,omitempty"` // staged rollout for update
+	Name          string         `json:"name,omitempty"`    // collector or monitor name
+}
+
+// commandResponse is the structured reply sent to msg.Reply for every command
+type commandResponse struct {
+	Action     string  `json:"action"`
+	Success    bool    `json:"success"`
+	Error      string  `json:"error,omitempty"`
+	Payload    any     `json:"payload,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	FQDN       string  `json:"fqdn"`
+	Timestamp  string  `json:"timestamp"`
+}
+
+// commandHandler executes one command action and returns the reply payload
+type commandHandler func(ctx context.Context, cmd agentCommand) (any, error)
+
+// commandRegistry maps command actions to their handlers
+type commandRegistry struct {
+	handlers map[string]commandHandler
+	fqdn     string
+}
+
+func newCommandRegistry(fqdn string) *commandRegistry {
+	return &commandRegistry{
+		handlers: make(map[string]commandHandler),
+		fqdn:     fqdn,
+	}
+}
+
+// register adds a handler for action, replacing any existing one
+func (r *commandRegistry) register(action string, handler commandHandler) {
+	r.handlers[action] = handler
+}
+
+// actions returns the registered actions in sorted order
+func (r *commandRegistry) actions() []string {
+	actions := make([]string, 0, len(r.handlers))
+	for action := range r.handlers {
+		actions = append(actions, action)
+	}
+	slices.Sort(actions)
+	return actions
+}
+
+// handleCommand runs the command in msg and replies to msg.Reply if one was requested.
+// The command is cancelled once ctx is done or commandTimeout has passed.
+func (r *commandRegistry) handleCommand(ctx context.Context, msg *nats.Msg) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	resp := r.dispatch(ctx, msg.Data)
+	if msg.Reply == "" {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err == nil {
+		err = msg.Respond(data)
+	}
+	if err != nil {
+		slog.Error("Failed to reply to command",
+			slog.String("action", resp.Action),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// dispatch decodes a command, runs its handler and builds the response
+func (r *commandRegistry) dispatch(ctx context.Context, data []byte) commandResponse {
+	start := time.Now()
+
+	var cmd agentCommand
+	payload, err := func() (any, error) {
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse command: %v", errInvalidCommand, err)
+		}
+		handler, ok := r.handlers[cmd.Action]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errUnknownCommand, cmd.Action)
+		}
+		slog.Info("Received command", slog.String("action", cmd.Action))
+		return handler(ctx, cmd)
+	}()
+
+	resp := commandResponse{
+		Action:     cmd.Action,
+		Success:    err == nil,
+		Payload:    payload,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		FQDN:       r.fqdn,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		slog.Warn("Command failed", slog.String("action", cmd.Action), slog.String("error", err.Error()))
+	}
+	return resp
+}
+
+// agentCommands holds the agent state that built-in command handlers act on
+type agentCommands struct {
+	state     *agentState
+	version   string
+	pub       *common.Publisher
+	tracker   *DeltaTracker
+	reloader  *reloader // nil if the configuration can't be reloaded
+	startedAt time.Time
+	registry  *commandRegistry
+	agentID   func() (string, error)
+
+	deferredMu sync.Mutex
+	deferred   *time.Timer // pending update deferred by a rollout policy
+}
+
+// newAgentCommands builds a registry with all built-in agent commands registered.
+// reload_config is only registered if reloader is non-nil.
+func newAgentCommands(state *agentState, version string, pub *common.Publisher, tracker *DeltaTracker, reloader *reloader) *agentCommands {
+	config, _ := state.snapshot()
+	a := &agentCommands{
+		state:     state,
+		version:   version,
+		pub:       pub,
+		tracker:   tracker,
+		reloader:  reloader,
+		startedAt: time.Now(),
+		registry:  newCommandRegistry(getFQDN(config)),
+		agentID:   common.GetOrCreateUUID,
+	}
+	a.registry.register("update", a.update)
+	a.registry.register("resync", a.resync)
+	a.registry.register("run_report_now", a.runReportNow)
+	a.registry.register("get_status", a.getStatus)
+	a.registry.register("collect", a.collect)
+	a.registry.register("run_monitor", a.runMonitor)
+	if reloader != nil {
+		a.registry.register("reload_config", a.reloadConfig)
+	}
+	return a
+}
+
+// update applies the target version, subject to the command's rollout policy if it has one.
+// The download is verified before replying, so verification failures are returned to the
+// caller; installation and the restart happen after the reply is sent.
+func (a *agentCommands) update(ctx context.Context, cmd agentCommand) (any, error) {
+	if cmd.TargetVersion == "" {
+		return nil, fmt.Errorf("%w: update requires target_version", errInvalidCommand)
+	}
+	if cmd.TargetVersion == a.version {
+		slog.Debug("Already running target version", slog.String("version", a.version))
+		return map[string]string{"status": "current", "version": a.version}, nil
+	}
+
+	if cmd.Rollout != nil {
+		if err := cmd.Rollout.validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidCommand, err)
+		}
+		decision, err := a.decideRollout(cmd.Rollout, rolloutJitter)
+		if err != nil {
+			return nil, err
+		}
+		switch decision.Status {
+		case updateStatusSkipped:
+			slog.Info("Skipping update, not part of this rollout",
+				slog.String("target_version", cmd.TargetVersion),
+				slog.String("reason", decision.Reason),
+			)
+			a.cancelDeferredUpdate()
+			return recordRolloutDecision(cmd.TargetVersion, decision), nil
+		case updateStatusDeferred:
+			a.deferUpdate(cmd, decision)
+			return recordRolloutDecision(cmd.TargetVersion, decision), nil
+		}
+	}
+
+	a.cancelDeferredUpdate()
+	return a.applyUpdate(cmd.TargetVersion)
+}
+
+// applyUpdate downloads and verifies version, then installs it in the background
+func (a *agentCommands) applyUpdate(version string) (any, error) {
+	slog.Info("Triggering self-update", slog.String("target_version", version))
+	binaryPath, err := currentBinaryPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current binary path: %w", err)
+	}
+	config, _ := a.state.snapshot()
+	newBinaryPath, err := prepareUpdate(version, config, binaryPath)
+	if err != nil {
+		recordUpdateStatus(version, updateStatusFailed, err)
+		return nil, fmt.Errorf("update to %s failed: %w", version, err)
+	}
+
+	recordUpdateStatus(version, updateStatusInstalling, nil)
+	go func() {
+		if err := installUpdate(config, a.version, version, newBinaryPath, binaryPath); err != nil {
+			slog.Error("Self-update failed", slog.String("error", err.Error()))
+			recordUpdateStatus(version, updateStatusFailed, err)
+		}
+	}()
+	return map[string]string{"status": updateStatusInstalling, "target_version": version}, nil
+}
+
+// decideRollout evaluates policy for this agent
+func (a *agentCommands) decideRollout(policy *rolloutPolicy, jitter func(time.Duration) time.Duration) (rolloutDecision, error) {
+	agentID := ""
+	if policy.Percent != nil {
+		id, err := a.agentID()
+		if err != nil {
+			return rolloutDecision{}, fmt.Errorf("failed to get agent UUID for rollout bucket: %w", err)
+		}
+		agentID = id
+	}
+	return policy.evaluate(agentID, time.Since(a.startedAt), time.Now(), jitter)
+}
+
+// deferUpdate schedules cmd to be re-evaluated and applied at decision.At, replacing
+// any previously deferred update.
+func (a *agentCommands) deferUpdate(cmd agentCommand, decision rolloutDecision) {
+	slog.Info("Deferring update",
+		slog.String("target_version", cmd.TargetVersion),
+		slog.Time("scheduled_for", decision.At),
+		slog.String("reason", decision.Reason),
+	)
+
+	a.deferredMu.Lock()
+	defer a.deferredMu.Unlock()
+	if a.deferred != nil {
+		a.deferred.Stop()
+	}
+	a.deferred = time.AfterFunc(time.Until(decision.At), func() {
+		// The delay has already been applied; only the window and uptime are checked again
+		decision, err := a.decideRollout(cmd.Rollout, func(time.Duration) time.Duration { return 0 })
+		if err != nil {
+			recordUpdateStatus(cmd.TargetVersion, updateStatusFailed, err)
+			return
+		}
+		if decision.Status == updateStatusDeferred {
+			a.deferUpdate(cmd, decision)
+			recordRolloutDecision(cmd.TargetVersion, decision)
+			return
+		}
+		if _, err := a.applyUpdate(cmd.TargetVersion); err != nil {
+			slog.Error("Deferred update failed", slog.String("error", err.Error()))
+		}
+	})
+}
+
+// cancelDeferredUpdate stops a deferred update, e.g. when a newer update command arrives
+func (a *agentCommands) cancelDeferredUpdate() {
+	a.deferredMu.Lock()
+	defer a.deferredMu.Unlock()
+	if a.deferred != nil {
+		a.deferred.Stop()
+		a.deferred = nil
+	}
+}
+
+// rolloutJitter returns a random delay in [0, max)
+func rolloutJitter(max time.Duration) time.Duration {
+	return rand.N(max)
+}
+
+// resync forces the next report to be a full snapshot
+func (a *agentCommands) resync(ctx context.Context, cmd agentCommand) (any, error) {
+	if a.tracker == nil {
+		return map[string]string{"status": "ignored", "reason": "delta reporting is disabled"}, nil
+	}
+	slog.Info("Resync requested, next report will be full")
+	a.tracker.RequestFull()
+	return map[string]string{"status": "full report requested"}, nil
+}
+
+// runReportNow builds and publishes a report immediately, using cached collector data within its TTL
+func (a *agentCommands) runReportNow(ctx context.Context, cmd agentCommand) (any, error) {
+	config, collectorsList := a.state.snapshot()
+	subject, err := ReportTask(ctx, config, collectorsList, a.version, a.pub, a.tracker)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"subject": subject}, nil
+}
+
+// collectResult is the payload of the collect command
+type collectResult struct {
+	Collectors map[string]collectors.CollectorStatus `json:"collectors"`
+	Subject    string                                `json:"subject"`
+}
+
+// collect re-runs the named collector (or all of them if name is empty or "all"),
+// bypassing the TTL cache, and then publishes a report with the fresh data.
+func (a *agentCommands) collect(ctx context.Context, cmd agentCommand) (any, error) {
+	config, collectorsList := a.state.snapshot()
+	targets := collectorsList
+	if cmd.Name != "" && cmd.Name != "all" {
+		targets = nil
+		for _, collector := range collectorsList {
+			if collector.Name() == cmd.Name {
+				targets = append(targets, collector)
+			}
+		}
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("%w: unknown collector %q", errInvalidCommand, cmd.Name)
+		}
+	}
+
+	result := collectResult{Collectors: make(map[string]collectors.CollectorStatus, len(targets))}
+	for _, r := range runCollectors(ctx, targets, config.GetCollectorConcurrency(), true) {
+		result.Collectors[r.collector.Name()] = r.status
+	}
+
+	// The refreshed collectors are now within their TTL, so the report uses their fresh data
+	subject, err := ReportTask(ctx, config, collectorsList, a.version, a.pub, a.tracker)
+	result.Subject = subject
+	return result, err
+}
+
+// runMonitor executes a single monitor immediately and returns its result, or with the
+// name "all" every monitor, returning the results in definition order.
+// The result is only returned in the command response: it is not published to
+// agent.monitoring and doesn't change the monitor's state, and scheduled runs of the
+// monitor carry on unaffected.
+func (a *agentCommands) runMonitor(ctx context.Context, cmd agentCommand) (any, error) {
+	config, _ := a.state.snapshot()
+	if !config.IsMonitoringEnabled() {
+		return nil, errors.New("monitoring is disabled")
+	}
+	if cmd.Name == "" {
+		return nil, fmt.Errorf("%w: run_monitor requires name", errInvalidCommand)
+	}
+	if cmd.Name == runAllMonitors {
+		return monitors.RunAllMonitors(ctx, config)
+	}
+	return monitors.RunMonitor(ctx, config, cmd.Name)
+}
+
+// reloadConfig reloads the configuration file and returns what changed
+func (a *agentCommands) reloadConfig(ctx context.Context, cmd agentCommand) (any, error) {
+	return a.reloader.reload(reloadTriggerCommand)
+}
+
+// agentStatus is the payload of the get_status command
+type agentStatus struct {
+	AgentVersion string                                `json:"agent_version"`
+	GoVersion    string                                `json:"go_version"`
+	StartedAt    string                                `json:"started_at"`
+	UptimeSec    int64                                 `json:"uptime_seconds"`
+	DeltaReports bool                                  `json:"delta_reports"`
+	Monitoring   bool                                  `json:"monitoring"`
+	Collectors   map[string]collectors.CollectorStatus `json:"collectors"`
+	Outbox       *common.OutboxStats                   `json:"outbox,omitempty"`
+	LastReload   *ReloadResult                         `json:"last_reload,omitempty"`
+	Commands     []string                              `json:"commands"`
+}
+
+// getStatus reports the agent's version, uptime and the last status of each collector
+func (a *agentCommands) getStatus(ctx context.Context, cmd agentCommand) (any, error) {
+	config, collectorsList := a.state.snapshot()
+	status := agentStatus{
+		AgentVersion: a.version,
+		GoVersion:    runtime.Version(),
+		StartedAt:    a.startedAt.UTC().Format(time.RFC3339),
+		UptimeSec:    int64(time.Since(a.startedAt).Seconds()),
+		DeltaReports: a.tracker != nil,
+		Monitoring:   config.IsMonitoringEnabled(),
+		Collectors:   make(map[string]collectors.CollectorStatus, len(collectorsList)),
+		Commands:     a.registry.actions(),
+	}
+	for _, collector := range collectorsList {
+		status.Collectors[collector.Name()] = collector.Status()
+	}
+	if a.pub != nil {
+		status.Outbox = a.pub.OutboxStats()
+	}
+	if a.reloader != nil {
+		status.LastReload = a.reloader.lastResult()
+	}
+	return status, nil
+}
@@ -0,0 +1,246 @@
+package internal
+
+import (
+	"cartographer-go-agent/collectors"
+	"cartographer-go-agent/configuration"
+	"cartographer-go-agent/monitors"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func newTestCommands(tracker *DeltaTracker) *agentCommands {
+	config := configuration.Config{FQDN: "host1.example.com"}
+	list := []*collectors.CachedCollector{
+		collectors.NewCachedCollector(collectors.FuncCollector("users", time.Minute, func(ctx context.Context) (any, error) {
+			return []string{"root"}, nil
+		})),
+	}
+	commands := newAgentCommands(newAgentState(config, list), "1.2.3", nil, tracker, nil)
+	commands.agentID = func() (string, error) { return "test-agent", nil }
+	return commands
+}
+
+func TestCommandRegistry_Dispatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantSuccess bool
+		wantAction  string
+		wantError   string
+	}{
+		{name: "invalid json", data: `{`, wantError: "invalid command"},
+		{name: "unknown action", data: `{"action":"reboot"}`, wantAction: "reboot", wantError: "unknown command action"},
+		{name: "update without version", data: `{"action":"update"}`, wantAction: "update", wantError: "requires target_version"},
+		{name: "update to current version", data: `{"action":"update","target_version":"1.2.3"}`, wantAction: "update", wantSuccess: true},
+		{name: "update outside rollout percent", data: `{"action":"update","target_version":"2.0.0","rollout":{"percent":0}}`, wantAction: "update", wantSuccess: true},
+		{name: "update with invalid rollout", data: `{"action":"update","target_version":"2.0.0","rollout":{"percent":150}}`, wantAction: "update", wantError: "rollout percent must be between 0 and 100"},
+		{name: "resync without delta reports", data: `{"action":"resync"}`, wantAction: "resync", wantSuccess: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := newTestCommands(nil).registry.dispatch(context.Background(), []byte(tt.data))
+			if resp.Success != tt.wantSuccess {
+				t.Errorf("Success = %v, want %v (error %q)", resp.Success, tt.wantSuccess, resp.Error)
+			}
+			if resp.Action != tt.wantAction {
+				t.Errorf("Action = %q, want %q", resp.Action, tt.wantAction)
+			}
+			if !strings.Contains(resp.Error, tt.wantError) {
+				t.Errorf("Error = %q, want it to contain %q", resp.Error, tt.wantError)
+			}
+			if resp.FQDN != "host1.example.com" {
+				t.Errorf("FQDN = %q", resp.FQDN)
+			}
+		})
+	}
+}
+
+func TestCommandRegistry_HandlerError(t *testing.T) {
+	registry := newCommandRegistry("host1")
+	registry.register("fail", func(ctx context.Context, cmd agentCommand) (any, error) {
+		return map[string]int{"partial": 1}, errors.New("boom")
+	})
+
+	resp := registry.dispatch(context.Background(), []byte(`{"action":"fail"}`))
+	if resp.Success || resp.Error != "boom" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp.Payload == nil {
+		t.Error("expected handler payload to be kept on error")
+	}
+}
+
+func TestCommandRegistry_HandleCommandUsesAgentContext(t *testing.T) {
+	registry := newCommandRegistry("host1.example.com")
+	cancelled := make(chan error, 1)
+	registry.register("wait", func(ctx context.Context, cmd agentCommand) (any, error) {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return nil, ctx.Err()
+	})
+
+	// The agent is shutting down and its grace period is over
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	registry.handleCommand(ctx, &nats.Msg{Data: []byte(`{"action":"wait"}`)})
+
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("command was not cancelled with the agent context")
+	}
+}
+
+func TestAgentCommands_Resync(t *testing.T) {
+	tracker := NewDeltaTracker(10)
+	tracker.Next(1, sampleReport([]string{"root"}, 10))
+
+	resp := newTestCommands(tracker).registry.dispatch(context.Background(), []byte(`{"action":"resync"}`))
+	if !resp.Success {
+		t.Fatalf("resync failed: %s", resp.Error)
+	}
+	if payload, _ := tracker.Next(2, sampleReport([]string{"root"}, 10)); payload["report_type"] != reportTypeFull {
+		t.Error("expected a full report after resync")
+	}
+}
+
+func TestAgentCommands_GetStatusReply(t *testing.T) {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("failed to create NATS server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer nc.Close()
+
+	commands := newTestCommands(nil)
+	if _, err := commands.state.collectors[0].Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nc.Subscribe("agent.commands.test", func(msg *nats.Msg) {
+		commands.registry.handleCommand(context.Background(), msg)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := nc.Request("agent.commands.test", []byte(`{"action":"get_status"}`), 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+
+	var resp struct {
+		commandResponse
+		Payload agentStatus `json:"payload"`
+	}
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		t.Fatalf("invalid reply %s: %v", msg.Data, err)
+	}
+	if !resp.Success || resp.Action != "get_status" {
+		t.Fatalf("unexpected reply: %s", msg.Data)
+	}
+	if resp.Payload.AgentVersion != "1.2.3" {
+		t.Errorf("agent_version = %q, want 1.2.3", resp.Payload.AgentVersion)
+	}
+	if resp.Payload.Collectors["users"].Status != "ok" {
+		t.Errorf("expected users collector status ok, got %+v", resp.Payload.Collectors)
+	}
+	if len(resp.Payload.Commands) == 0 {
+		t.Error("expected registered commands in status")
+	}
+}
+
+func TestAgentCommands_CollectBypassesCache(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	newCollector := func(name string) *collectors.CachedCollector {
+		return collectors.NewCachedCollector(collectors.FuncCollector(name, time.Hour, func(ctx context.Context) (any, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[name]++
+			return calls[name], nil
+		}))
+	}
+	list := []*collectors.CachedCollector{newCollector("users"), newCollector("apt")}
+	for _, c := range list {
+		_, _ = c.Collect(context.Background())
+	}
+
+	// DRYRUN prints the report instead of publishing it
+	commands := newAgentCommands(newAgentState(configuration.Config{FQDN: "host1", DRYRUN: true}, list), "1.2.3", nil, nil, nil)
+
+	resp := commands.registry.dispatch(context.Background(), []byte(`{"action":"collect","name":"apt"}`))
+	if !resp.Success {
+		t.Fatalf("collect failed: %s", resp.Error)
+	}
+	if calls["apt"] != 2 || calls["users"] != 1 {
+		t.Errorf("expected only apt to be re-collected, got %v", calls)
+	}
+	result := resp.Payload.(collectResult)
+	if result.Subject != reportSubject || result.Collectors["apt"].Status != "ok" || len(result.Collectors) != 1 {
+		t.Errorf("unexpected payload: %+v", result)
+	}
+
+	resp = commands.registry.dispatch(context.Background(), []byte(`{"action":"collect"}`))
+	if !resp.Success || calls["apt"] != 3 || calls["users"] != 2 {
+		t.Errorf("expected all collectors to be re-collected, got %v (error %q)", calls, resp.Error)
+	}
+
+	resp = commands.registry.dispatch(context.Background(), []byte(`{"action":"collect","name":"nope"}`))
+	if resp.Success || !strings.Contains(resp.Error, "unknown collector") {
+		t.Errorf("expected unknown collector error, got %+v", resp)
+	}
+}
+
+func TestAgentCommands_RunMonitor(t *testing.T) {
+	dir := t.TempDir()
+	content := "monitors:\n  - name: echo_test\n    type: command\n    command: \"echo hello\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	enabled := true
+	config := configuration.Config{FQDN: "host1", MonitorsDir: dir, EnableMonitoring: &enabled}
+	commands := newAgentCommands(newAgentState(config, nil), "1.2.3", nil, nil, nil)
+
+	resp := commands.registry.dispatch(context.Background(), []byte(`{"action":"run_monitor","name":"echo_test"}`))
+	if !resp.Success {
+		t.Fatalf("run_monitor failed: %s", resp.Error)
+	}
+	if result := resp.Payload.(monitors.MonitorResult); result.Name != "echo_test" || result.Status != monitors.StatusOK {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	resp = commands.registry.dispatch(context.Background(), []byte(`{"action":"run_monitor","name":"all"}`))
+	if !resp.Success {
+		t.Fatalf("run_monitor all failed: %s", resp.Error)
+	}
+	if results := resp.Payload.([]monitors.MonitorResult); len(results) != 1 || results[0].Name != "echo_test" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	resp = commands.registry.dispatch(context.Background(), []byte(`{"action":"run_monitor"}`))
+	if resp.Success || !strings.Contains(resp.Error, "requires name") {
+		t.Errorf("expected missing name error, got %+v", resp)
+	}
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Report types sent in the report_type field
+const (
+	reportTypeFull  = "full"
+	reportTypeDelta = "delta"
+)
+
+// Subjects for full and delta reports. Full reports keep the original subject so
+// servers that don't understand deltas continue to work.
+const (
+	reportSubject      = "agent.report"
+	deltaReportSubject = "agent.report.delta"
+)
+
+// reportMetadataKeys are sent in every report and excluded from change detection
+var reportMetadataKeys = []string{"agent_version", "hostname", "fqdn", "collector_status"}
+
+// DeltaTracker remembers the content hash of each report section so that only
+// changed sections need to be sent between periodic full snapshots.
+// It is safe for concurrent use.
+type DeltaTracker struct {
+	fullEvery int
+
+	mu           sync.Mutex
+	baseSequence uint64 // sequence of the last full report
+	sinceFull    int
+	hashes       map[string]string
+	forceFull    bool
+}
+
+// NewDeltaTracker returns a tracker that sends a full report every fullEvery reports.
+// The first report is always full.
+func NewDeltaTracker(fullEvery int) *DeltaTracker {
+	if fullEvery < 1 {
+		fullEvery = 1
+	}
+	return &DeltaTracker{
+		fullEvery: fullEvery,
+		forceFull: true,
+	}
+}
+
+// RequestFull forces the next report to be a full snapshot
+func (d *DeltaTracker) RequestFull() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.forceFull = true
+}
+
+// Next turns a freshly built report, numbered sequence, into either a full or a delta
+// payload and returns it with the subject it should be published on.
+func (d *DeltaTracker) Next(sequence uint64, data map[string]interface{}) (map[string]interface{}, string) {
+	hashes := hashSections(data)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	full := d.forceFull || d.sinceFull+1 >= d.fullEvery
+
+	if full {
+		d.forceFull = false
+		d.sinceFull = 0
+		d.baseSequence = sequence
+		d.hashes = hashes
+
+		payload := make(map[string]interface{}, len(data)+3)
+		for k, v := range data {
+			payload[k] = v
+		}
+		payload["report_type"] = reportTypeFull
+		payload["sequence"] = sequence
+		payload["section_hashes"] = hashes
+		return payload, reportSubject
+	}
+
+	d.sinceFull++
+
+	changed := make(map[string]interface{})
+	for name, hash := range hashes {
+		if hash == "" || d.hashes[name] != hash {
+			changed[name] = data[name]
+		}
+	}
+	removed := []string{}
+	for name := range d.hashes {
+		if _, ok := hashes[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	slices.Sort(removed)
+	d.hashes = hashes
+
+	payload := map[string]interface{}{
+		"report_type":    reportTypeDelta,
+		"sequence":       sequence,
+		"base_sequence":  d.baseSequence,
+		"changed":        changed,
+		"removed":        removed,
+		"section_hashes": hashes,
+	}
+	for _, key := range reportMetadataKeys {
+		if v, ok := data[key]; ok {
+			payload[key] = v
+		}
+	}
+
+	slog.Debug("Built delta report",
+		slog.Uint64("sequence", sequence),
+		slog.Int("changed", len(changed)),
+		slog.Int("removed", len(removed)),
+	)
+	return payload, deltaReportSubject
+}
+
+// hashSections returns the sha256 of each section's JSON encoding, skipping metadata keys
+func hashSections(data map[string]interface{}) map[string]string {
+	hashes := make(map[string]string, len(data))
+	for name, section := range data {
+		if slices.Contains(reportMetadataKeys, name) {
+			continue
+		}
+		encoded, err := json.Marshal(section)
+		if err != nil {
+			// Unhashable sections are always treated as changed
+			slog.Warn("Failed to hash report section", slog.String("section", name), slog.String("error", err.Error()))
+			hashes[name] = ""
+			continue
+		}
+		sum := sha256.Sum256(encoded)
+		hashes[name] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func sampleReport(users []string, disk int) map[string]interface{} {
+	return map[string]interface{}{
+		"agent_version":    "1.0.0",
+		"hostname":         "host1",
+		"fqdn":             "host1.example.com",
+		"collector_status": map[string]string{"users": "ok"},
+		"users":            users,
+		"disk_usage":       disk,
+	}
+}
+
+func TestDeltaTracker_FirstReportIsFull(t *testing.T) {
+	tracker := NewDeltaTracker(3)
+
+	payload, subject := tracker.Next(1, sampleReport([]string{"root"}, 10))
+	if subject != reportSubject {
+		t.Errorf("subject = %q, want %q", subject, reportSubject)
+	}
+	if payload["report_type"] != reportTypeFull {
+		t.Errorf("report_type = %v, want full", payload["report_type"])
+	}
+	if payload["sequence"] != uint64(1) {
+		t.Errorf("sequence = %v, want 1", payload["sequence"])
+	}
+	if _, ok := payload["users"]; !ok {
+		t.Error("expected full report to include all sections")
+	}
+	hashes := payload["section_hashes"].(map[string]string)
+	if _, ok := hashes["collector_status"]; ok {
+		t.Error("metadata keys should not be hashed")
+	}
+	if len(hashes) != 2 {
+		t.Errorf("expected 2 section hashes, got %v", hashes)
+	}
+}
+
+func TestDeltaTracker_OnlyChangedSections(t *testing.T) {
+	tracker := NewDeltaTracker(10)
+	tracker.Next(1, sampleReport([]string{"root"}, 10))
+
+	payload, subject := tracker.Next(2, sampleReport([]string{"root"}, 20))
+	if subject != deltaReportSubject {
+		t.Errorf("subject = %q, want %q", subject, deltaReportSubject)
+	}
+	if payload["report_type"] != reportTypeDelta {
+		t.Errorf("report_type = %v, want delta", payload["report_type"])
+	}
+	if payload["base_sequence"] != uint64(1) || payload["sequence"] != uint64(2) {
+		t.Errorf("unexpected sequences: base=%v seq=%v", payload["base_sequence"], payload["sequence"])
+	}
+	changed := payload["changed"].(map[string]interface{})
+	if !reflect.DeepEqual(changed, map[string]interface{}{"disk_usage": 20}) {
+		t.Errorf("changed = %v, want only disk_usage", changed)
+	}
+	if payload["fqdn"] != "host1.example.com" {
+		t.Error("expected metadata to be included in delta")
+	}
+
+	// Nothing changed: empty delta
+	payload, _ = tracker.Next(3, sampleReport([]string{"root"}, 20))
+	if changed := payload["changed"].(map[string]interface{}); len(changed) != 0 {
+		t.Errorf("expected no changes, got %v", changed)
+	}
+}
+
+func TestDeltaTracker_RemovedSections(t *testing.T) {
+	tracker := NewDeltaTracker(10)
+	tracker.Next(1, sampleReport([]string{"root"}, 10))
+
+	report := sampleReport([]string{"root"}, 10)
+	delete(report, "disk_usage")
+	payload, _ := tracker.Next(2, report)
+
+	removed := payload["removed"].([]string)
+	if !reflect.DeepEqual(removed, []string{"disk_usage"}) {
+		t.Errorf("removed = %v, want [disk_usage]", removed)
+	}
+}
+
+func TestDeltaTracker_PeriodicAndForcedFull(t *testing.T) {
+	tracker := NewDeltaTracker(3)
+
+	var types []string
+	for i := range 7 {
+		payload, _ := tracker.Next(uint64(i+1), sampleReport([]string{"root"}, 10))
+		types = append(types, payload["report_type"].(string))
+	}
+	want := []string{"full", "delta", "delta", "full", "delta", "delta", "full"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("report types = %v, want %v", types, want)
+	}
+
+	tracker.RequestFull()
+	payload, _ := tracker.Next(8, sampleReport([]string{"root"}, 10))
+	if payload["report_type"] != reportTypeFull {
+		t.Errorf("expected full report after RequestFull, got %v", payload["report_type"])
+	}
+}
@@ -3,15 +3,35 @@ package internal
 import (
 	collectors "cartographer-go-agent/collectors"
 	"cartographer-go-agent/configuration"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 )
 
 // GetCollectors returns a list of collectors based on the configuration
-func GetCollectors(config configuration.Config) []*collectors.Collector {
+func GetCollectors(config configuration.Config) []*collectors.CachedCollector {
+	collectorsList := newCollectors(config)
+
+	// Persist results across restarts if a cache directory is configured
+	store := openCollectorCache(config)
+
+	// Apply per-collector deadlines so one slow collector can't stall the report
+	for _, c := range collectorsList {
+		c.SetOptions(config.GetCollectorTimeout(c.Name()), config.ServeStaleOnTimeout)
+		if store != nil {
+			c.AttachCache(store)
+		}
+	}
+	return collectorsList
+}
+
+// newCollectors creates the built-in collectors and those defined in the configuration
+func newCollectors(config configuration.Config) []*collectors.CachedCollector {
 	// set TTLs to a reasonable minimum value, rather than desired update frequency
 	//    otherwise actual update freq could be as high as ttl + agent report interval
 
-	collectorsList := []*collectors.Collector{
+	collectorsList := []*collectors.CachedCollector{
 		collectors.FQDNCollector(1*time.Minute, &config),
 		collectors.UsersCollector(5*time.Minute, &config),
 		collectors.SysInfoCollector(5*time.Minute, &config),
@@ -21,6 +41,7 @@ func GetCollectors(config configuration.Config) []*collectors.Collector {
 		collectors.UUIDCollector(30*time.Minute, &config),
 		collectors.NessusCollector(15*time.Minute, &config),
 		collectors.NginxCollector(15*time.Minute, &config),
+		collectors.CertificatesCollector(1*time.Hour, &config),
 		collectors.PublicIPCollector(1*time.Hour, &config),
 	}
 
@@ -37,3 +58,84 @@ func GetCollectors(config configuration.Config) []*collectors.Collector {
 	}
 	return collectorsList
 }
+
+func openCollectorCache(config configuration.Config) *collectors.DiskCache {
+	if config.CacheDir == "" {
+		return nil
+	}
+	store, err := collectors.NewDiskCache(config.CacheDir)
+	if err != nil {
+		slog.Error("Collector cache disabled", slog.String("error", err.Error()))
+		return nil
+	}
+	return store
+}
+
+// collectorDefinitions describes the collectors defined in the configuration by name, so a
+// reload can tell which of them changed. Built-in collectors have no entry unless they
+// read settings from the configuration.
+func collectorDefinitions(config configuration.Config) map[string]string {
+	defs := make(map[string]string, len(config.YamlFiles)+len(config.JSONCommands)+1)
+	defs["certificates"] = "certificates:" + strings.Join(config.GetCertificatePaths(), ",")
+	for _, y := range config.YamlFiles {
+		defs[y.Name] = "yaml:" + y.Path
+	}
+	for _, jc := range config.JSONCommands {
+		defs[jc.Name] = fmt.Sprintf("json:%d:%s", jc.Timeout, jc.Command)
+	}
+	return defs
+}
+
+// collectorChanges summarises how a reload changed the collector list
+type collectorChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// rebuildCollectors builds the collectors for config, reusing those in previous whose
+// definition is unchanged so their cached data survives the reload.
+func rebuildCollectors(previousConfig configuration.Config, config configuration.Config, previous []*collectors.CachedCollector) ([]*collectors.CachedCollector, collectorChanges) {
+	previousDefs, defs := collectorDefinitions(previousConfig), collectorDefinitions(config)
+	existing := make(map[string]*collectors.CachedCollector, len(previous))
+	for _, c := range previous {
+		existing[c.Name()] = c
+	}
+
+	store := openCollectorCache(config)
+	var changes collectorChanges
+	var collectorsList []*collectors.CachedCollector
+	for _, c := range newCollectors(config) {
+		name := c.Name()
+		old, ok := existing[name]
+		delete(existing, name)
+
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, name)
+		case previousDefs[name] != defs[name]:
+			changes.Changed = append(changes.Changed, name)
+			// The persisted result came from the old definition
+			if store != nil {
+				if err := store.Remove(name); err != nil {
+					slog.Warn("Failed to remove collector cache entry", slog.String("error", err.Error()))
+				}
+			}
+		default:
+			c = old
+		}
+
+		c.SetOptions(config.GetCollectorTimeout(name), config.ServeStaleOnTimeout)
+		if c != old && store != nil {
+			c.AttachCache(store)
+		}
+		collectorsList = append(collectorsList, c)
+	}
+
+	for _, c := range previous {
+		if _, ok := existing[c.Name()]; ok {
+			changes.Removed = append(changes.Removed, c.Name())
+		}
+	}
+	return collectorsList, changes
+}
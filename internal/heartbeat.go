@@ -7,24 +7,39 @@ import (
 	"fmt"
 	"log/slog"
 	"time"
-
-	"github.com/nats-io/nats.go"
 )
 
+// heartbeatStatusStopping marks the last heartbeat sent before the agent exits
+const heartbeatStatusStopping = "stopping"
+
 type heartbeat struct {
-	FQDN         string `json:"fqdn"`
-	AgentVersion string `json:"agent_version"`
-	Timestamp    string `json:"timestamp"`
+	FQDN         string              `json:"fqdn"`
+	AgentVersion string              `json:"agent_version"`
+	Status       string              `json:"status,omitempty"`
+	Timestamp    string              `json:"timestamp"`
+	Outbox       *common.OutboxStats `json:"outbox,omitempty"`
+	Update       *UpdateStatus       `json:"update,omitempty"`
 }
 
 // HeartbeatTask publishes a heartbeat to NATS
-func HeartbeatTask(config configuration.Config, version string, nc *nats.Conn) {
+func HeartbeatTask(config configuration.Config, version string, pub *common.Publisher) {
+	sendHeartbeat(config, version, pub, "")
+}
+
+// sendHeartbeat publishes a heartbeat with the given status ("" while running)
+func sendHeartbeat(config configuration.Config, version string, pub *common.Publisher, status string) {
 	fqdn := getFQDN(config)
 
 	hb := heartbeat{
 		FQDN:         fqdn,
 		AgentVersion: version,
+		Status:       status,
 		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Update:       getUpdateStatus(),
+	}
+
+	if pub != nil {
+		hb.Outbox = pub.OutboxStats()
 	}
 
 	if config.DRYRUN {
@@ -34,8 +49,15 @@ func HeartbeatTask(config configuration.Config, version string, nc *nats.Conn) {
 		return
 	}
 
+	// Heartbeats are only useful live, so they bypass the outbox
 	slog.Info("Sending heartbeat...")
-	if err := common.PublishJSON(nc, "agent.heartbeat", hb, false); err != nil {
+	if err := common.PublishJSON(pub.Conn(), "agent.heartbeat", hb, false); err != nil {
 		slog.Error("Failed to publish heartbeat", slog.String("error", err.Error()))
+		return
+	}
+
+	// Reaching NATS proves a freshly updated version works
+	if status != heartbeatStatusStopping {
+		confirmUpdateHealthy()
 	}
 }
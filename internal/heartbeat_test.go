@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"cartographer-go-agent/common"
+	"cartographer-go-agent/configuration"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSendHeartbeat_Stopping(t *testing.T) {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("failed to create NATS server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("agent.heartbeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A pending update must not be confirmed by an agent that is going away
+	pendingUpdate.stateDir = t.TempDir()
+	pendingUpdate.state = &updateState{TargetVersion: "2.0.0"}
+	t.Cleanup(func() { pendingUpdate.state = nil })
+
+	sendHeartbeat(configuration.Config{FQDN: "host1.example.com"}, "2.0.0", common.NewPublisher(nc, nil), heartbeatStatusStopping)
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatalf("no heartbeat published: %v", err)
+	}
+	var hb heartbeat
+	if err := json.Unmarshal(msg.Data, &hb); err != nil {
+		t.Fatal(err)
+	}
+	if hb.Status != heartbeatStatusStopping || hb.FQDN != "host1.example.com" {
+		t.Errorf("unexpected heartbeat: %s", msg.Data)
+	}
+	if pendingUpdate.state == nil {
+		t.Error("expected the pending update to stay unconfirmed")
+	}
+}
@@ -0,0 +1,352 @@
+package internal
+
+import (
+	"cartographer-go-agent/collectors"
+	"cartographer-go-agent/common"
+	"cartographer-go-agent/configuration"
+	"cartographer-go-agent/monitors"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// reloadSubject receives a ReloadResult for every reload attempt
+	reloadSubject = "agent.reload"
+	// reloadDebounce waits for a burst of file events (e.g. an editor's save) to settle
+	reloadDebounce = 500 * time.Millisecond
+)
+
+// Reload triggers reported in ReloadResult.Trigger
+const (
+	reloadTriggerSignal   = "sighup"
+	reloadTriggerConfig   = "config_changed"
+	reloadTriggerMonitors = "monitors_changed"
+	reloadTriggerCommand  = "command"
+)
+
+// ReloadOptions enable reloading the configuration on SIGHUP, when the config file or
+// monitors directory changes, and via the reload_config command.
+type ReloadOptions struct {
+	// ConfigPath is the file the configuration was loaded from; reloading is disabled if empty
+	ConfigPath string
+	// Load reads and validates the configuration from ConfigPath
+	Load func() (configuration.Config, error)
+	// Monitoring is given the new configuration and re-reads the monitor definitions
+	Monitoring *monitors.Monitoring
+	// OnConfig applies settings owned by the caller, such as the log level
+	OnConfig func(configuration.Config)
+}
+
+// ReloadResult describes a reload attempt; it is published to agent.reload
+type ReloadResult struct {
+	FQDN            string           `json:"fqdn"`
+	Trigger         string           `json:"trigger"`
+	Success         bool             `json:"success"`
+	Error           string           `json:"error,omitempty"`
+	Collectors      collectorChanges `json:"collectors"`
+	Monitors        int              `json:"monitors"`
+	MonitorErrors   []string         `json:"monitor_errors,omitempty"`
+	RestartRequired []string         `json:"restart_required,omitempty"` // changed settings that only apply after a restart
+	Timestamp       string           `json:"timestamp"`
+}
+
+// agentState is the configuration and collectors currently in effect. A reload replaces
+// both together; tasks take a snapshot when they start.
+type agentState struct {
+	mu         sync.RWMutex
+	config     configuration.Config
+	collectors []*collectors.CachedCollector
+}
+
+func newAgentState(config configuration.Config, collectorsList []*collectors.CachedCollector) *agentState {
+	return &agentState{config: config, collectors: collectorsList}
+}
+
+func (s *agentState) snapshot() (configuration.Config, []*collectors.CachedCollector) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config, s.collectors
+}
+
+func (s *agentState) replace(config configuration.Config, collectorsList []*collectors.CachedCollector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+	s.collectors = collectorsList
+}
+
+// keepStartupSettings returns next with the settings that are only read at startup taken
+// from current, and the keys of those that differ and so need a restart to take effect.
+// The NATS connection, command subscription, outbox, cache and delta tracker are not
+// rebuilt by a reload.
+func keepStartupSettings(current configuration.Config, next configuration.Config) (configuration.Config, []string) {
+	var restart []string
+	keepSetting(&restart, "nats_url", current.NatsURL, &next.NatsURL)
+	keepSetting(&restart, "nats_nkey_seed", current.NatsNkeySeed, &next.NatsNkeySeed)
+	keepSetting(&restart, "fqdn", current.FQDN, &next.FQDN)
+	keepSetting(&restart, "daemonize", current.Daemonize, &next.Daemonize)
+	keepSetting(&restart, "cache_dir", current.CacheDir, &next.CacheDir)
+	keepSetting(&restart, "delta_reports", current.DeltaReports, &next.DeltaReports)
+	keepSetting(&restart, "full_report_every", current.FullReportEvery, &next.FullReportEvery)
+	keepSetting(&restart, "outbox_dir", current.OutboxDir, &next.OutboxDir)
+	keepSetting(&restart, "outbox_max_mb", current.OutboxMaxMB, &next.OutboxMaxMB)
+	keepSetting(&restart, "outbox_max_age_hours", current.OutboxMaxAgeHours, &next.OutboxMaxAgeHours)
+	keepSetting(&restart, "jetstream", current.JetStream, &next.JetStream)
+	keepSetting(&restart, "jetstream_ack_timeout_seconds", current.JetStreamAckTimeoutSeconds, &next.JetStreamAckTimeoutSeconds)
+	keepSetting(&restart, "jetstream_max_retries", current.JetStreamMaxRetries, &next.JetStreamMaxRetries)
+	keepSetting(&restart, "update_state_dir", current.UpdateStateDir, &next.UpdateStateDir)
+	keepSetting(&restart, "monitor_state_file", current.MonitorStateFile, &next.MonitorStateFile)
+	return next, restart
+}
+
+func keepSetting[T comparable](restart *[]string, key string, current T, next *T) {
+	if *next != current {
+		*restart = append(*restart, key)
+		*next = current
+	}
+}
+
+// reloader applies configuration changes to a running agent
+type reloader struct {
+	opts  ReloadOptions
+	state *agentState
+	pub   *common.Publisher
+
+	mu sync.Mutex // serializes reloads and guards reschedule
+	// reschedule updates scheduled jobs for a new configuration; nil until they exist
+	reschedule func(configuration.Config)
+
+	lastMu sync.Mutex
+	last   *ReloadResult
+}
+
+func newReloader(opts ReloadOptions, state *agentState, pub *common.Publisher) *reloader {
+	return &reloader{opts: opts, state: state, pub: pub}
+}
+
+// setReschedule installs fn to update scheduled jobs on later reloads and applies the
+// configuration currently in effect, in case a reload already happened before the jobs
+// were scheduled.
+func (r *reloader) setReschedule(fn func(configuration.Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reschedule = fn
+	config, _ := r.state.snapshot()
+	fn(config)
+}
+
+// reload reads the configuration again and, if it is valid, rebuilds the collectors and
+// monitors from it. An invalid configuration is reported and the current one is kept.
+func (r *reloader) reload(trigger string) (ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, previous := r.state.snapshot()
+	result := ReloadResult{FQDN: getFQDN(current), Trigger: trigger}
+
+	next, err := r.opts.Load()
+	if err != nil {
+		result.Error = err.Error()
+		r.finish(current, &result)
+		return result, err
+	}
+	// Not part of the config file
+	next.DRYRUN = current.DRYRUN
+
+	next, result.RestartRequired = keepStartupSettings(current, next)
+	collectorsList, changes := rebuildCollectors(current, next, previous)
+	result.Collectors = changes
+	r.state.replace(next, collectorsList)
+
+	if r.opts.OnConfig != nil {
+		r.opts.OnConfig(next)
+	}
+	if r.reschedule != nil {
+		r.reschedule(next)
+	}
+	if r.opts.Monitoring != nil {
+		r.reloadMonitoring(next, &result)
+	}
+
+	result.Success = true
+	r.finish(next, &result)
+	return result, nil
+}
+
+// reloadMonitors re-reads the monitor definitions without reloading the configuration
+func (r *reloader) reloadMonitors(trigger string) ReloadResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config, _ := r.state.snapshot()
+	result := ReloadResult{FQDN: getFQDN(config), Trigger: trigger, Success: true}
+	if r.opts.Monitoring != nil {
+		r.reloadMonitoring(config, &result)
+	}
+	r.finish(config, &result)
+	return result
+}
+
+func (r *reloader) reloadMonitoring(config configuration.Config, result *ReloadResult) {
+	count, loadErrors := r.opts.Monitoring.Reload(config)
+	result.Monitors = count
+	for _, err := range loadErrors {
+		result.MonitorErrors = append(result.MonitorErrors, err.Error())
+	}
+}
+
+// finish logs and publishes the result and keeps it for get_status
+func (r *reloader) finish(config configuration.Config, result *ReloadResult) {
+	result.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	last := *result
+	r.lastMu.Lock()
+	r.last = &last
+	r.lastMu.Unlock()
+
+	if result.Success {
+		slog.Info("Configuration reloaded",
+			slog.String("trigger", result.Trigger),
+			slog.Any("collectors_added", result.Collectors.Added),
+			slog.Any("collectors_removed", result.Collectors.Removed),
+			slog.Any("collectors_changed", result.Collectors.Changed),
+			slog.Int("monitors", result.Monitors),
+		)
+		if len(result.RestartRequired) > 0 {
+			slog.Warn("Some changed settings only take effect after a restart",
+				slog.Any("settings", result.RestartRequired),
+			)
+		}
+	} else {
+		slog.Error("Configuration reload failed, keeping the current configuration",
+			slog.String("trigger", result.Trigger),
+			slog.String("error", result.Error),
+		)
+	}
+
+	if config.DRYRUN || r.pub == nil {
+		return
+	}
+	if err := r.pub.PublishJSON(reloadSubject, result, false); err != nil {
+		slog.Error("Failed to publish reload result", slog.String("error", err.Error()))
+	}
+}
+
+// lastResult returns the most recent reload attempt, or nil if there was none
+func (r *reloader) lastResult() *ReloadResult {
+	r.lastMu.Lock()
+	defer r.lastMu.Unlock()
+	if r.last == nil {
+		return nil
+	}
+	last := *r.last
+	return &last
+}
+
+// watch reloads on SIGHUP and when the config file or monitors directory changes,
+// until ctx is cancelled.
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Warn("File watching unavailable, reload with SIGHUP instead", slog.String("error", err.Error()))
+	} else {
+		defer watcher.Close()
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	configPath := filepath.Clean(r.opts.ConfigPath)
+	// Watch the directory rather than the file, so editors that replace the file are noticed
+	addWatch(watcher, filepath.Dir(configPath))
+	config, _ := r.state.snapshot()
+	monitorsDir := watchedMonitorsDir(config)
+	addWatch(watcher, monitorsDir)
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	var configChanged, monitorsChanged bool
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("Received SIGHUP, reloading configuration")
+			r.reload(reloadTriggerSignal)
+		case event := <-events:
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			switch {
+			case filepath.Clean(event.Name) == configPath:
+				configChanged = true
+			case monitorsDir != "" && filepath.Dir(event.Name) == monitorsDir:
+				monitorsChanged = true
+			default:
+				continue
+			}
+			debounce.Reset(reloadDebounce)
+		case err := <-watchErrors:
+			slog.Warn("File watcher error", slog.String("error", err.Error()))
+		case <-debounce.C:
+			if configChanged {
+				r.reload(reloadTriggerConfig)
+			} else if monitorsChanged {
+				r.reloadMonitors(reloadTriggerMonitors)
+			}
+			configChanged, monitorsChanged = false, false
+
+			// Follow the monitors directory if the reload moved it
+			config, _ := r.state.snapshot()
+			if dir := watchedMonitorsDir(config); dir != monitorsDir {
+				removeWatch(watcher, monitorsDir)
+				addWatch(watcher, dir)
+				monitorsDir = dir
+			}
+		}
+	}
+}
+
+// watchedMonitorsDir returns the monitors directory to watch, or "" if monitoring is disabled
+func watchedMonitorsDir(config configuration.Config) string {
+	if !config.IsMonitoringEnabled() || config.MonitorsDir == "" {
+		return ""
+	}
+	return filepath.Clean(config.MonitorsDir)
+}
+
+func addWatch(watcher *fsnotify.Watcher, dir string) {
+	if watcher == nil || dir == "" {
+		return
+	}
+	if err := watcher.Add(dir); err != nil {
+		level := slog.LevelWarn
+		if errors.Is(err, os.ErrNotExist) {
+			level = slog.LevelDebug
+		}
+		slog.Log(context.Background(), level, "Failed to watch directory for changes",
+			slog.String("path", dir),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func removeWatch(watcher *fsnotify.Watcher, dir string) {
+	if watcher == nil || dir == "" {
+		return
+	}
+	_ = watcher.Remove(dir)
+}
@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"cartographer-go-agent/collectors"
+	"cartographer-go-agent/configuration"
+	"cartographer-go-agent/monitors"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func findCollector(list []*collectors.CachedCollector, name string) *collectors.CachedCollector {
+	for _, c := range list {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestRebuildCollectors(t *testing.T) {
+	cacheDir := t.TempDir()
+	previousConfig := configuration.Config{
+		CacheDir: cacheDir,
+		YamlFiles: []configuration.ConfigYamlFile{
+			{Name: "kept", Path: "/etc/kept.yaml"},
+			{Name: "moved", Path: "/etc/old.yaml"},
+			{Name: "dropped", Path: "/etc/dropped.yaml"},
+		},
+	}
+	previous := GetCollectors(previousConfig)
+
+	store, err := collectors.NewDiskCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("moved", map[string]string{"from": "old"}, time.Now(), collectors.CollectorStatus{Status: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := configuration.Config{
+		CacheDir:          cacheDir,
+		CollectorTimeouts: map[string]int{"kept": 5},
+		YamlFiles: []configuration.ConfigYamlFile{
+			{Name: "kept", Path: "/etc/kept.yaml"},
+			{Name: "moved", Path: "/etc/new.yaml"},
+			{Name: "added", Path: "/etc/added.yaml"},
+		},
+	}
+	list, changes := rebuildCollectors(previousConfig, config, previous)
+
+	if !slices.Equal(changes.Added, []string{"added"}) {
+		t.Errorf("Added = %v", changes.Added)
+	}
+	if !slices.Equal(changes.Removed, []string{"dropped"}) {
+		t.Errorf("Removed = %v", changes.Removed)
+	}
+	if !slices.Equal(changes.Changed, []string{"moved"}) {
+		t.Errorf("Changed = %v", changes.Changed)
+	}
+
+	// Unchanged collectors keep their instance, and so their cached data
+	for _, name := range []string{"users", "kept"} {
+		if findCollector(list, name) != findCollector(previous, name) {
+			t.Errorf("expected %s to be reused", name)
+		}
+	}
+	if findCollector(list, "moved") == findCollector(previous, "moved") {
+		t.Error("expected a new collector for a changed definition")
+	}
+	if _, err := store.Load("moved"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the cache entry of the old definition to be removed, got %v", err)
+	}
+	if timeout := findCollector(list, "kept").Timeout; timeout != 5*time.Second {
+		t.Errorf("expected the new timeout on a reused collector, got %s", timeout)
+	}
+}
+
+func TestRebuildCollectorsCertificatePaths(t *testing.T) {
+	previousConfig := configuration.Config{}
+	previous := GetCollectors(previousConfig)
+
+	config := configuration.Config{CertificatePaths: []string{"/opt/app/tls/*.crt"}}
+	list, changes := rebuildCollectors(previousConfig, config, previous)
+	if !slices.Equal(changes.Changed, []string{"certificates"}) {
+		t.Errorf("Changed = %v, want [certificates]", changes.Changed)
+	}
+	if findCollector(list, "certificates") == findCollector(previous, "certificates") {
+		t.Error("expected a new certificates collector for changed certificate_paths")
+	}
+}
+
+func TestKeepStartupSettings(t *testing.T) {
+	current := configuration.Config{NatsURL: "nats://a:4222", IntervalMinutes: 15, OutboxDir: "/var/spool/a"}
+	next := configuration.Config{NatsURL: "nats://b:4222", IntervalMinutes: 5, OutboxDir: "/var/spool/a"}
+
+	got, restart := keepStartupSettings(current, next)
+	if !slices.Equal(restart, []string{"nats_url"}) {
+		t.Errorf("restart = %v, want [nats_url]", restart)
+	}
+	if got.NatsURL != current.NatsURL {
+		t.Errorf("NatsURL = %q, want the current value", got.NatsURL)
+	}
+	if got.IntervalMinutes != 5 {
+		t.Errorf("IntervalMinutes = %d, want the reloaded value", got.IntervalMinutes)
+	}
+}
+
+// reloadEnv is a config file and monitors directory loaded into a reloader
+type reloadEnv struct {
+	configPath  string
+	monitorsDir string
+	reloader    *reloader
+	state       *agentState
+	rescheduled []configuration.Config
+}
+
+func newReloadEnv(t *testing.T) *reloadEnv {
+	t.Helper()
+	dir := t.TempDir()
+	env := &reloadEnv{
+		configPath:  filepath.Join(dir, "agent.yaml"),
+		monitorsDir: filepath.Join(dir, "monitors.d"),
+	}
+	if err := os.Mkdir(env.monitorsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	env.writeConfig(t, "interval_minutes: 15\n")
+
+	load := func() (configuration.Config, error) {
+		config, err := configuration.GetConfig(env.configPath)
+		if err != nil {
+			return configuration.Config{}, err
+		}
+		return config, configuration.ValidateConfig(config)
+	}
+	config, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.state = newAgentState(config, GetCollectors(config))
+	env.reloader = newReloader(ReloadOptions{
+		ConfigPath: env.configPath,
+		Load:       load,
+		Monitoring: monitors.NewMonitoring(config, "1.0.0", nil),
+	}, env.state, nil)
+	env.reloader.reschedule = func(config configuration.Config) {
+		env.rescheduled = append(env.rescheduled, config)
+	}
+	return env
+}
+
+func (e *reloadEnv) writeConfig(t *testing.T, extra string) {
+	t.Helper()
+	content := "nats_url: nats://localhost:4222\nnats_nkey_seed: SUAEXAMPLE\ndaemonize: true\nmonitors_dir: " + e.monitorsDir + "\n" + extra
+	if err := os.WriteFile(e.configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	env := newReloadEnv(t)
+	before := findCollector(env.state.collectors, "users")
+
+	env.writeConfig(t, "interval_minutes: 5\nfqdn: renamed.example.com\nyaml_files:\n  - name: extra\n    path: /etc/extra.yaml\n")
+	result, err := env.reloader.reload(reloadTriggerSignal)
+	if err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if !result.Success || result.Trigger != reloadTriggerSignal {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if !slices.Equal(result.Collectors.Added, []string{"extra"}) {
+		t.Errorf("Collectors.Added = %v", result.Collectors.Added)
+	}
+	if !slices.Equal(result.RestartRequired, []string{"fqdn"}) {
+		t.Errorf("RestartRequired = %v", result.RestartRequired)
+	}
+
+	config, collectorsList := env.state.snapshot()
+	if config.IntervalMinutes != 5 || config.FQDN != "" {
+		t.Errorf("expected the new interval and the startup fqdn, got %d and %q", config.IntervalMinutes, config.FQDN)
+	}
+	if findCollector(collectorsList, "users") != before {
+		t.Error("expected unchanged collectors to be kept")
+	}
+	if len(env.rescheduled) != 1 {
+		t.Errorf("expected the jobs to be rescheduled once, got %d", len(env.rescheduled))
+	}
+
+	// An invalid file is reported and the running configuration is kept
+	env.writeConfig(t, "interval_minutes: 5\nlog_level: loud\n")
+	result, err = env.reloader.reload(reloadTriggerCommand)
+	if err == nil || result.Success || result.Error == "" {
+		t.Fatalf("expected the reload to fail, got %+v", result)
+	}
+	if _, after := env.state.snapshot(); len(after) != len(collectorsList) {
+		t.Error("expected the collectors to be unchanged after a failed reload")
+	}
+	if last := env.reloader.lastResult(); last == nil || last.Success {
+		t.Errorf("expected the failure to be recorded, got %+v", last)
+	}
+}
+
+func TestReloader_ReloadBeforeJobsScheduled(t *testing.T) {
+	env := newReloadEnv(t)
+	env.reloader.reschedule = nil
+
+	// A reload_config command can arrive before the report job exists
+	env.writeConfig(t, "interval_minutes: 5\n")
+	if _, err := env.reloader.reload(reloadTriggerCommand); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+
+	var applied []int
+	env.reloader.setReschedule(func(config configuration.Config) {
+		applied = append(applied, config.IntervalMinutes)
+	})
+	if !slices.Equal(applied, []int{5}) {
+		t.Errorf("expected the reloaded interval to be applied once the jobs exist, got %v", applied)
+	}
+}
+
+func TestReloader_WatchesFiles(t *testing.T) {
+	env := newReloadEnv(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go env.reloader.watch(ctx)
+
+	waitForReload := func(trigger string) *ReloadResult {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if last := env.reloader.lastResult(); last != nil && last.Trigger == trigger {
+				return last
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("no %s reload within 5s", trigger)
+		return nil
+	}
+
+	// Give the watcher a moment to register before writing
+	time.Sleep(100 * time.Millisecond)
+	monitor := "monitors:\n  - name: check\n    type: command\n    command: \"true\"\n"
+	if err := os.WriteFile(filepath.Join(env.monitorsDir, "check.yaml"), []byte(monitor), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := waitForReload(reloadTriggerMonitors); result.Monitors != 1 {
+		t.Errorf("expected 1 monitor after the directory changed, got %d", result.Monitors)
+	}
+
+	env.writeConfig(t, "interval_minutes: 30\n")
+	waitForReload(reloadTriggerConfig)
+	if config, _ := env.state.snapshot(); config.IntervalMinutes != 30 {
+		t.Errorf("IntervalMinutes = %d, want 30", config.IntervalMinutes)
+	}
+}
@@ -4,16 +4,16 @@ import (
 	collectors "cartographer-go-agent/collectors"
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-
-	"github.com/nats-io/nats.go"
+	"sync"
 )
 
-func buildDataReport(config configuration.Config, collectorsList []*collectors.Collector, version string) map[string]interface{} {
+func buildDataReport(ctx context.Context, config configuration.Config, collectorsList []*collectors.CachedCollector, version string) map[string]interface{} {
 	hostname, _ := os.Hostname()
 	fqdn := getFQDN(config)
 
@@ -26,32 +26,38 @@ func buildDataReport(config configuration.Config, collectorsList []*collectors.C
 
 	collectorStatus := make(map[string]collectors.CollectorStatus)
 
-	for _, collector := range collectorsList {
-		collectorData, err := collector.Collect()
-		if err != nil {
-			if errors.Is(err, collectors.ErrCollectorSkipped) {
+	for _, result := range runCollectors(ctx, collectorsList, config.GetCollectorConcurrency(), false) {
+		name := result.collector.Name()
+		collectorStatus[name] = result.status
+
+		if result.err != nil {
+			switch {
+			case errors.Is(result.err, collectors.ErrCollectorSkipped):
 				slog.Info("Collector skipped",
-					slog.String("collector_name", collector.Name),
+					slog.String("collector_name", name),
 				)
-			} else {
+			case errors.Is(result.err, collectors.ErrCollectorTimeout):
+				// Timeouts are logged by the collector; serve stale data if it was returned
+				if result.data != nil {
+					data[name] = result.data
+				}
+			default:
 				slog.Error("Error collecting data",
-					slog.String("collector_name", collector.Name),
-					slog.String("error", err.Error()),
-					slog.Float64("duration_ms", collector.LastStatus.Duration),
+					slog.String("collector_name", name),
+					slog.String("error", result.err.Error()),
+					slog.Float64("duration_ms", result.status.Duration),
 				)
 			}
-			collectorStatus[collector.Name] = collector.LastStatus
 			continue
 		}
 
 		slog.Debug("Collector completed",
-			slog.String("collector_name", collector.Name),
-			slog.Float64("duration_ms", collector.LastStatus.Duration),
-			slog.Bool("cached", collector.LastStatus.Cached),
+			slog.String("collector_name", name),
+			slog.Float64("duration_ms", result.status.Duration),
+			slog.Bool("cached", result.status.Cached),
 		)
 
-		data[collector.Name] = collectorData
-		collectorStatus[collector.Name] = collector.LastStatus
+		data[name] = result.data
 	}
 
 	data["collector_status"] = collectorStatus
@@ -59,23 +65,108 @@ func buildDataReport(config configuration.Config, collectorsList []*collectors.C
 	return data
 }
 
-// ReportTask builds a report from collectors and publishes it via NATS.
-func ReportTask(config configuration.Config, collectorsList []*collectors.Collector, version string, nc *nats.Conn) {
+// collectorResult holds the outcome of a single collector run within a report
+type collectorResult struct {
+	collector *collectors.CachedCollector
+	data      interface{}
+	status    collectors.CollectorStatus
+	err       error
+}
+
+// runCollectors executes the collectors in a bounded worker pool and returns
+// their results in the same order as collectorsList. If refresh is set, cached
+// results are ignored and every collector runs.
+//
+// A collector that times out keeps its slot until its source actually returns,
+// so abandoned runs still count against concurrency. Collectors that can't get
+// a slot before ctx is done are reported as cancelled.
+func runCollectors(ctx context.Context, collectorsList []*collectors.CachedCollector, concurrency int, refresh bool) []collectorResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]collectorResult, len(collectorsList))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, collector := range collectorsList {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = collectorResult{
+				collector: collector,
+				status:    collectors.CollectorStatus{Status: "error", Error: "collection cancelled"},
+				err:       ctx.Err(),
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collect := collector.CollectStatus
+			if refresh {
+				collect = collector.Refresh
+			}
+			data, status, err := collect(ctx)
+			results[i] = collectorResult{
+				collector: collector,
+				data:      data,
+				status:    status,
+				err:       err,
+			}
+
+			// Release the slot only once the source has returned
+			idle := collector.Idle()
+			go func() {
+				<-idle
+				<-sem
+			}()
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// reportSequence numbers reports; with JetStream enabled it also provides their Nats-Msg-Id
+var reportSequence = common.NewSequence()
+
+// ReportTask builds a report from collectors and publishes it via NATS, returning the subject used.
+// Collectors still running when ctx is cancelled are abandoned.
+// If tracker is non-nil, only changed sections are sent between full reports.
+func ReportTask(ctx context.Context, config configuration.Config, collectorsList []*collectors.CachedCollector, version string, pub *common.Publisher, tracker *DeltaTracker) (string, error) {
 	slog.Info("Starting agent report task")
-	data := buildDataReport(config, collectorsList, version)
-	SendReport(config, data, nc)
+	data := buildDataReport(ctx, config, collectorsList, version)
+
+	sequence := reportSequence.Next()
+	subject := reportSubject
+	if tracker != nil {
+		data, subject = tracker.Next(sequence, data)
+	}
+
+	if err := SendReport(ctx, config, subject, sequence, data, pub); err != nil {
+		if tracker != nil {
+			// The server may have missed this report, so the next delta would be meaningless
+			tracker.RequestFull()
+		}
+		return subject, err
+	}
+	return subject, nil
 }
 
-// SendReport publishes the report to NATS
-func SendReport(config configuration.Config, data map[string]interface{}, nc *nats.Conn) {
+// SendReport publishes the report with the given sequence to NATS on the given subject
+func SendReport(ctx context.Context, config configuration.Config, subject string, sequence uint64, data map[string]interface{}, pub *common.Publisher) error {
 	if config.DRYRUN {
 		jsonValue, _ := json.MarshalIndent(data, "", "  ")
 		fmt.Println(string(jsonValue))
-		slog.Info("DRYRUN: Not sending report")
-		return
+		slog.Info("DRYRUN: Not sending report", slog.String("subject", subject))
+		return nil
 	}
 
-	if err := common.PublishJSON(nc, "agent.report", data, config.Gzip); err != nil {
+	if err := pub.PublishJSONContext(ctx, subject, sequence, data, config.Gzip); err != nil {
 		slog.Error("Error publishing report", slog.String("error", err.Error()))
+		return err
 	}
+	return nil
 }
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"cartographer-go-agent/collectors"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunCollectors_TimedOutRunsHoldSlots(t *testing.T) {
+	release := make(chan struct{})
+	var running, peak atomic.Int32
+	newSlow := func(name string) *collectors.CachedCollector {
+		c := collectors.NewCachedCollector(collectors.FuncCollector(name, time.Minute, func(ctx context.Context) (any, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			// Ignore ctx so the run outlives its timeout
+			<-release
+			return name, nil
+		}))
+		c.Timeout = 20 * time.Millisecond
+		return c
+	}
+	list := []*collectors.CachedCollector{newSlow("a"), newSlow("b"), newSlow("c")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	results := runCollectors(ctx, list, 1, false)
+
+	if !errors.Is(results[0].err, collectors.ErrCollectorTimeout) {
+		t.Errorf("expected first collector to time out, got %v", results[0].err)
+	}
+	for _, r := range results[1:] {
+		if !errors.Is(r.err, context.DeadlineExceeded) {
+			t.Errorf("expected %s to be cancelled waiting for a slot, got %v", r.collector.Name(), r.err)
+		}
+	}
+	if got := peak.Load(); got != 1 {
+		t.Errorf("expected at most 1 collector running, saw %d", got)
+	}
+	close(release)
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// Rollout outcomes reported in UpdateStatus.Status
+const (
+	updateStatusDeferred = "deferred"
+	updateStatusSkipped  = "skipped"
+)
+
+// rolloutPolicy lets the server broadcast an update to the whole fleet and have
+// each agent decide whether and when to apply it.
+type rolloutPolicy struct {
+	// Percent of agents that apply the update, selected by a stable bucket derived from
+	// the agent UUID, so raising it only adds agents. Nil means all agents.
+	Percent *int `json:"percent,omitempty"`
+	// MaintenanceWindow restricts when the update may be applied
+	MaintenanceWindow *maintenanceWindow `json:"maintenance_window,omitempty"`
+	// MaxDelaySeconds spreads agents out by a random delay of up to this many seconds
+	MaxDelaySeconds int `json:"max_delay_seconds,omitempty"`
+	// MinUptimeSeconds defers the update until the agent has been running this long
+	MinUptimeSeconds int `json:"min_uptime_seconds,omitempty"`
+}
+
+// maintenanceWindow is a daily time range, e.g. 22:00-04:00. An end before the start spans midnight.
+type maintenanceWindow struct {
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM
+	Timezone string `json:"timezone,omitempty"` // IANA name; defaults to the host's local time
+}
+
+// rolloutDecision is the result of evaluating a rolloutPolicy
+type rolloutDecision struct {
+	Status string    // updateStatusInstalling (apply now), updateStatusDeferred or updateStatusSkipped
+	At     time.Time // when a deferred update should be applied
+	Reason string
+}
+
+// rolloutBucket maps an agent ID to a stable bucket in [0, 100)
+func rolloutBucket(agentID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(agentID))
+	return int(h.Sum32() % 100)
+}
+
+// validate checks the policy before it is evaluated
+func (p *rolloutPolicy) validate() error {
+	if p.Percent != nil && (*p.Percent < 0 || *p.Percent > 100) {
+		return fmt.Errorf("rollout percent must be between 0 and 100, got %d", *p.Percent)
+	}
+	if p.MaxDelaySeconds < 0 || p.MinUptimeSeconds < 0 {
+		return fmt.Errorf("rollout max_delay_seconds and min_uptime_seconds must not be negative")
+	}
+	if p.MaintenanceWindow != nil {
+		if _, _, err := p.MaintenanceWindow.occurrence(time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluate decides what this agent should do with an update. jitter returns a random
+// duration in [0, max) and is only called when a delay is configured.
+func (p *rolloutPolicy) evaluate(agentID string, uptime time.Duration, now time.Time, jitter func(max time.Duration) time.Duration) (rolloutDecision, error) {
+	if err := p.validate(); err != nil {
+		return rolloutDecision{}, err
+	}
+
+	if p.Percent != nil {
+		if bucket := rolloutBucket(agentID); bucket >= *p.Percent {
+			return rolloutDecision{
+				Status: updateStatusSkipped,
+				Reason: fmt.Sprintf("agent bucket %d is outside the %d%% rollout", bucket, *p.Percent),
+			}, nil
+		}
+	}
+
+	at := now
+	var reasons []string
+	if minUptime := time.Duration(p.MinUptimeSeconds) * time.Second; uptime < minUptime {
+		at = at.Add(minUptime - uptime)
+		reasons = append(reasons, fmt.Sprintf("uptime %s is below %s", uptime.Truncate(time.Second), minUptime))
+	}
+
+	var windowEnd time.Time
+	if p.MaintenanceWindow != nil {
+		start, end, _ := p.MaintenanceWindow.occurrence(at)
+		if start.After(at) {
+			at = start
+			reasons = append(reasons, "outside maintenance window")
+		}
+		windowEnd = end
+	}
+
+	if p.MaxDelaySeconds > 0 {
+		delay := jitter(time.Duration(p.MaxDelaySeconds) * time.Second)
+		// Don't let the delay push the update out of the window
+		if !windowEnd.IsZero() && at.Add(delay).After(windowEnd) {
+			delay = windowEnd.Sub(at) / 2
+		}
+		if delay > 0 {
+			at = at.Add(delay)
+			reasons = append(reasons, fmt.Sprintf("rollout delay %s", delay.Truncate(time.Second)))
+		}
+	}
+
+	if !at.After(now) {
+		return rolloutDecision{Status: updateStatusInstalling}, nil
+	}
+	return rolloutDecision{
+		Status: updateStatusDeferred,
+		At:     at,
+		Reason: strings.Join(reasons, ", "),
+	}, nil
+}
+
+// occurrence returns the window that contains t, or the next one after t
+func (w *maintenanceWindow) occurrence(t time.Time) (time.Time, time.Time, error) {
+	loc := time.Local
+	if w.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid maintenance window timezone: %w", err)
+		}
+	}
+	startHM, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid maintenance window start %q, want HH:MM", w.Start)
+	}
+	endHM, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid maintenance window end %q, want HH:MM", w.End)
+	}
+
+	length := endHM.Sub(startHM)
+	if length <= 0 {
+		length += 24 * time.Hour // spans midnight
+	}
+
+	local := t.In(loc)
+	// Yesterday's window may still be open if it spans midnight
+	for offset := -1; offset <= 1; offset++ {
+		day := local.AddDate(0, 0, offset)
+		start := time.Date(day.Year(), day.Month(), day.Day(), startHM.Hour(), startHM.Minute(), 0, 0, loc)
+		end := start.Add(length)
+		if t.Before(end) {
+			return start, end, nil
+		}
+	}
+	// Unreachable: tomorrow's window always ends after t
+	return time.Time{}, time.Time{}, fmt.Errorf("no maintenance window found")
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPtr(i int) *int { return &i }
+
+func TestRolloutBucket_Stable(t *testing.T) {
+	bucket := rolloutBucket("3f9a6d2e-agent")
+	for i := 0; i < 10; i++ {
+		if got := rolloutBucket("3f9a6d2e-agent"); got != bucket {
+			t.Fatalf("rolloutBucket() = %d, then %d", bucket, got)
+		}
+	}
+	if bucket < 0 || bucket >= 100 {
+		t.Errorf("rolloutBucket() = %d, want [0, 100)", bucket)
+	}
+}
+
+func TestRolloutPolicy_Evaluate(t *testing.T) {
+	utc := time.UTC
+	// 2026-03-10 14:00 UTC
+	now := time.Date(2026, 3, 10, 14, 0, 0, 0, utc)
+	agentID := "test-agent"
+	bucket := rolloutBucket(agentID)
+	noJitter := func(time.Duration) time.Duration { return 0 }
+	fullJitter := func(max time.Duration) time.Duration { return max - time.Second }
+
+	tests := []struct {
+		name       string
+		policy     rolloutPolicy
+		uptime     time.Duration
+		jitter     func(time.Duration) time.Duration
+		wantStatus string
+		wantAt     time.Time
+		wantReason string
+		wantErr    string
+	}{
+		{
+			name:       "no constraints applies now",
+			policy:     rolloutPolicy{},
+			wantStatus: updateStatusInstalling,
+		},
+		{
+			name:       "agent inside percent",
+			policy:     rolloutPolicy{Percent: intPtr(bucket + 1)},
+			wantStatus: updateStatusInstalling,
+		},
+		{
+			name:       "agent outside percent",
+			policy:     rolloutPolicy{Percent: intPtr(bucket)},
+			wantStatus: updateStatusSkipped,
+			wantReason: "outside the",
+		},
+		{
+			name:       "zero percent skips everyone",
+			policy:     rolloutPolicy{Percent: intPtr(0)},
+			wantStatus: updateStatusSkipped,
+		},
+		{
+			name:       "min uptime defers",
+			policy:     rolloutPolicy{MinUptimeSeconds: 600},
+			uptime:     4 * time.Minute,
+			wantStatus: updateStatusDeferred,
+			wantAt:     now.Add(6 * time.Minute),
+			wantReason: "uptime",
+		},
+		{
+			name:       "min uptime reached",
+			policy:     rolloutPolicy{MinUptimeSeconds: 600},
+			uptime:     time.Hour,
+			wantStatus: updateStatusInstalling,
+		},
+		{
+			name:       "inside window",
+			policy:     rolloutPolicy{MaintenanceWindow: &maintenanceWindow{Start: "13:00", End: "15:00", Timezone: "UTC"}},
+			wantStatus: updateStatusInstalling,
+		},
+		{
+			name:       "before window defers to its start",
+			policy:     rolloutPolicy{MaintenanceWindow: &maintenanceWindow{Start: "22:00", End: "04:00", Timezone: "UTC"}},
+			wantStatus: updateStatusDeferred,
+			wantAt:     time.Date(2026, 3, 10, 22, 0, 0, 0, utc),
+			wantReason: "outside maintenance window",
+		},
+		{
+			name:       "after window defers to tomorrow",
+			policy:     rolloutPolicy{MaintenanceWindow: &maintenanceWindow{Start: "02:00", End: "04:00", Timezone: "UTC"}},
+			wantStatus: updateStatusDeferred,
+			wantAt:     time.Date(2026, 3, 11, 2, 0, 0, 0, utc),
+		},
+		{
+			name:       "window in another timezone",
+			policy:     rolloutPolicy{MaintenanceWindow: &maintenanceWindow{Start: "09:30", End: "11:00", Timezone: "America/New_York"}},
+			wantStatus: updateStatusInstalling, // 14:00 UTC is 10:00 EDT
+		},
+		{
+			name:       "uptime pushes into window",
+			policy:     rolloutPolicy{MinUptimeSeconds: 3600, MaintenanceWindow: &maintenanceWindow{Start: "14:30", End: "16:00", Timezone: "UTC"}},
+			uptime:     0,
+			wantStatus: updateStatusDeferred,
+			wantAt:     now.Add(time.Hour),
+			wantReason: "uptime",
+		},
+		{
+			name:       "jitter delays",
+			policy:     rolloutPolicy{MaxDelaySeconds: 300},
+			jitter:     fullJitter,
+			wantStatus: updateStatusDeferred,
+			wantAt:     now.Add(299 * time.Second),
+			wantReason: "rollout delay",
+		},
+		{
+			name:       "jitter is kept inside window",
+			policy:     rolloutPolicy{MaxDelaySeconds: 7200, MaintenanceWindow: &maintenanceWindow{Start: "13:00", End: "14:20", Timezone: "UTC"}},
+			jitter:     fullJitter,
+			wantStatus: updateStatusDeferred,
+			wantAt:     now.Add(10 * time.Minute),
+		},
+		{
+			name:    "percent out of range",
+			policy:  rolloutPolicy{Percent: intPtr(101)},
+			wantErr: "between 0 and 100",
+		},
+		{
+			name:    "bad window time",
+			policy:  rolloutPolicy{MaintenanceWindow: &maintenanceWindow{Start: "25:00", End: "04:00"}},
+			wantErr: "invalid maintenance window start",
+		},
+		{
+			name:    "bad timezone",
+			policy:  rolloutPolicy{MaintenanceWindow: &maintenanceWindow{Start: "22:00", End: "04:00", Timezone: "Mars/Olympus"}},
+			wantErr: "invalid maintenance window timezone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jitter := tt.jitter
+			if jitter == nil {
+				jitter = noJitter
+			}
+			decision, err := tt.policy.evaluate(agentID, tt.uptime, now, jitter)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("evaluate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evaluate() error = %v", err)
+			}
+			if decision.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q (reason %q)", decision.Status, tt.wantStatus, decision.Reason)
+			}
+			if !tt.wantAt.IsZero() && !decision.At.Equal(tt.wantAt) {
+				t.Errorf("At = %s, want %s", decision.At, tt.wantAt)
+			}
+			if !strings.Contains(decision.Reason, tt.wantReason) {
+				t.Errorf("Reason = %q, want it to contain %q", decision.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindow_SpansMidnight(t *testing.T) {
+	w := maintenanceWindow{Start: "22:00", End: "04:00", Timezone: "UTC"}
+
+	// 01:00 is inside the window that started the previous evening
+	start, end, err := w.occurrence(time.Date(2026, 3, 11, 1, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 3, 10, 22, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("start = %s, want %s", start, want)
+	}
+	if want := time.Date(2026, 3, 11, 4, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("end = %s, want %s", end, want)
+	}
+}
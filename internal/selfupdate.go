@@ -9,63 +9,67 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"text/template"
 )
 
-// SelfUpdate handles downloading a new version of the agent and restarting it.
-func SelfUpdate(version string, config configuration.Config) error {
+// prepareUpdate downloads the new binary next to binaryPath and verifies its checksum,
+// signature and that it runs. It returns the path of the verified download; nothing is
+// installed if any check fails.
+func prepareUpdate(version string, config configuration.Config, binaryPath string) (string, error) {
 	// Step 1: Build the URL for the new release
 	downloadURL, err := buildDownloadURL(version, config.ReleaseURL)
 	if err != nil {
 		slog.Error("Failed to build download URL", slog.String("error", err.Error()))
-		return err
+		return "", err
+	}
+	verifier, err := newReleaseVerifier(version, downloadURL, config)
+	if err != nil {
+		slog.Error("Cannot verify update", slog.String("error", err.Error()))
+		return "", err
 	}
 	slog.Info("Downloading new version", slog.String("version", version), slog.String("url", downloadURL))
 
-	// Step 2: Download the new binary
-	newBinaryPath := "/tmp/cartographer-agent" // Temporary path to download new binary
+	// Step 2: Download the new binary into the same directory so it can be renamed into place
+	tmp, err := os.CreateTemp(filepath.Dir(binaryPath), "."+filepath.Base(binaryPath)+"-update-*")
+	if err != nil {
+		slog.Error("Failed to create download file", slog.String("error", err.Error()))
+		return "", err
+	}
+	newBinaryPath := tmp.Name()
+	tmp.Close()
+
 	err = downloadFile(newBinaryPath, downloadURL)
 	if err != nil {
 		slog.Error("Failed to download new binary", slog.String("error", err.Error()))
-		return err
+		_ = os.Remove(newBinaryPath)
+		return "", err
 	}
 
-	// Step 3: Make the downloaded file executable
+	// Step 3: Verify the checksum and signature before the binary is ever executed
+	if err := verifier.verify(newBinaryPath, downloadURL); err != nil {
+		slog.Error("Downloaded binary failed verification, refusing to install", slog.String("error", err.Error()))
+		_ = os.Remove(newBinaryPath)
+		return "", err
+	}
+
+	// Step 4: Make the downloaded file executable
 	err = os.Chmod(newBinaryPath, 0755)
 	if err != nil {
 		slog.Error("Failed to make the downloaded binary executable", slog.String("error", err.Error()))
-		return err
+		_ = os.Remove(newBinaryPath)
+		return "", err
 	}
 
-	// Step 4: Verify that the new binary runs with "--version"
+	// Step 5: Verify that the new binary runs with "--version"
 	if err := verifyBinary(newBinaryPath); err != nil {
 		slog.Error("Downloaded binary failed verification", slog.String("error", err.Error()))
-		return err
-	}
-
-	// Step 5: Replace the current binary
-	currentBinaryPath, err := os.Executable() // Path to the currently running binary
-	if err != nil {
-		slog.Error("Failed to get current binary path", slog.String("error", err.Error()))
-		return err
-	}
-	err = os.Rename(newBinaryPath, currentBinaryPath) // Overwrite the current binary
-	if err != nil {
-		slog.Error("Failed to replace binary", slog.String("error", err.Error()))
-		return err
-	}
-	slog.Info("Replaced the binary with the new version")
-
-	// Step 6: Restart the daemon using systemd
-	err = restartAgentViaSystemd()
-	if err != nil {
-		slog.Error("Failed to restart agent via systemd", slog.String("error", err.Error()))
-		return err
+		_ = os.Remove(newBinaryPath)
+		return "", err
 	}
-	slog.Info("Agent restarted successfully")
-	return nil
+	return newBinaryPath, nil
 }
 
 // verifyBinary tests the downloaded binary by running it with "--version"
@@ -112,30 +116,25 @@ func buildDownloadURL(version string, templateURL string) (string, error) {
 }
 
 // downloadFile downloads a file from the given URL to the specified path.
-func downloadFile(filepath string, url string) error {
+func downloadFile(filepath string, url string) (err error) {
 	// Create the file
 	out, err := os.Create(filepath)
 	if err != nil {
 		return err
 	}
-	defer func(out *os.File) {
-		err := out.Close()
-		if err != nil {
-
+	defer func() {
+		// A failed close can mean the download never reached the disk
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to write %s: %w", filepath, closeErr)
 		}
-	}(out)
+	}()
 
 	// Get the data from the URL
-	resp, err := http.Get(url)
+	resp, err := updateHTTPClient.Get(url)
 	if err != nil {
 		return err
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-
-		}
-	}(resp.Body)
+	defer resp.Body.Close()
 
 	// Check if the download was successful
 	if resp.StatusCode != http.StatusOK {
@@ -143,9 +142,8 @@ func downloadFile(filepath string, url string) error {
 	}
 
 	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("failed to download file: %s: %w", url, err)
 	}
 	return nil
 }
@@ -156,7 +154,7 @@ func restartAgentViaSystemd() error {
 
 	// Capture stdout and stderr for debugging purposes
 	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("systemctl", "restart", "cartographer") // Correct service name
+	cmd := exec.Command("systemctl", "restart", serviceName)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
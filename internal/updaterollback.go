@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"bytes"
+	"cartographer-go-agent/common"
+	"cartographer-go-agent/configuration"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// updateStateFile records an update in progress so the next start (or the watchdog) can finish or undo it
+	updateStateFile = "update-pending.json"
+	// updateHealthFile is written by the new version once it is healthy; it contains the version
+	updateHealthFile = "update-healthy"
+	// backupSuffix is appended to the binary path for the previous version
+	backupSuffix = ".bak"
+	// serviceName is the systemd unit the agent runs as
+	serviceName = "cartographer"
+)
+
+// Update status values for the post-restart phase
+const (
+	updateStatusPending    = "pending"
+	updateStatusVerifying  = "verifying"
+	updateStatusApplied    = "applied"
+	updateStatusRolledBack = "rolled_back"
+)
+
+// updateState is persisted in the update state directory while an update is being applied
+type updateState struct {
+	PreviousVersion string    `json:"previous_version"`
+	TargetVersion   string    `json:"target_version"`
+	BinaryPath      string    `json:"binary_path"`
+	BackupPath      string    `json:"backup_path"`
+	StartedAt       time.Time `json:"started_at"`
+	Deadline        time.Time `json:"deadline"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Test seams for the parts of an update that touch systemd
+var (
+	restartAgent         = restartAgentViaSystemd
+	scheduleRollbackTask = scheduleUpdateWatchdog
+)
+
+// pendingUpdate is the update this process was started to verify, if any
+var pendingUpdate struct {
+	mu       sync.Mutex
+	stateDir string
+	state    *updateState
+}
+
+// currentBinaryPath returns the resolved path of the running executable
+func currentBinaryPath() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// installUpdate swaps newBinaryPath into binaryPath, keeping the previous binary as a backup,
+// and restarts the agent. A watchdog restores the backup if the new version doesn't report
+// healthy within the configured deadline.
+func installUpdate(config configuration.Config, currentVersion string, targetVersion string, newBinaryPath string, binaryPath string) error {
+	stateDir := config.GetUpdateStateDir()
+	timeout := config.GetUpdateHealthTimeout()
+
+	// Step 6: Keep the current binary as a backup
+	backupPath := binaryPath + backupSuffix
+	if err := backupBinary(binaryPath, backupPath); err != nil {
+		_ = os.Remove(newBinaryPath)
+		return fmt.Errorf("failed to back up current binary: %w", err)
+	}
+
+	state := &updateState{
+		PreviousVersion: currentVersion,
+		TargetVersion:   targetVersion,
+		BinaryPath:      binaryPath,
+		BackupPath:      backupPath,
+		StartedAt:       time.Now().UTC(),
+		Deadline:        time.Now().UTC().Add(timeout),
+		Status:          updateStatusPending,
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		_ = os.Remove(newBinaryPath)
+		return fmt.Errorf("failed to create update state directory: %w", err)
+	}
+	_ = os.Remove(filepath.Join(stateDir, updateHealthFile))
+	if err := writeUpdateState(stateDir, state); err != nil {
+		_ = os.Remove(newBinaryPath)
+		return err
+	}
+
+	// Step 7: Atomically replace the binary; the download lives in the same directory
+	if err := os.Rename(newBinaryPath, binaryPath); err != nil {
+		_ = os.Remove(newBinaryPath)
+		_ = os.Remove(filepath.Join(stateDir, updateStateFile))
+		return fmt.Errorf("failed to replace binary: %w", err)
+	}
+	slog.Info("Replaced the binary with the new version", slog.String("path", binaryPath), slog.String("backup", backupPath))
+
+	// Step 8: Arrange for the backup to be restored if the new version never becomes healthy.
+	// Without the watchdog nothing would undo a bad version, so don't go ahead without it.
+	if err := scheduleRollbackTask(backupPath, stateDir, timeout); err != nil {
+		slog.Error("Failed to schedule update watchdog, restoring previous binary", slog.String("error", err.Error()))
+		err = fmt.Errorf("failed to schedule update watchdog: %w", err)
+		if rbErr := os.Rename(backupPath, binaryPath); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback failed: %w", rbErr))
+		}
+		_ = os.Remove(filepath.Join(stateDir, updateStateFile))
+		return err
+	}
+
+	// Step 9: Restart the daemon using systemd
+	if err := restartAgent(); err != nil {
+		slog.Error("Failed to restart agent, restoring previous binary", slog.String("error", err.Error()))
+		if rbErr := os.Rename(backupPath, binaryPath); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback failed: %w", rbErr))
+		}
+		_ = os.Remove(filepath.Join(stateDir, updateStateFile))
+		return err
+	}
+	return nil
+}
+
+// ResumePendingUpdate is called at startup to pick up the result of an update applied by a
+// previous process: it reports rollbacks and arms the health confirmation for a new version.
+func ResumePendingUpdate(config configuration.Config, version string) {
+	stateDir := config.GetUpdateStateDir()
+	state, err := readUpdateState(stateDir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Discarding unreadable update state", slog.String("error", err.Error()))
+			clearUpdateState(stateDir)
+		}
+		return
+	}
+
+	switch {
+	case state.Status == updateStatusRolledBack:
+		slog.Warn("Previous update was rolled back",
+			slog.String("target_version", state.TargetVersion),
+			slog.String("error", state.Error),
+		)
+		recordUpdateStatus(state.TargetVersion, updateStatusRolledBack, errors.New(state.Error))
+		clearUpdateState(stateDir)
+	case state.Status == updateStatusPending && version == state.TargetVersion:
+		slog.Info("Running updated version, waiting for a successful heartbeat to confirm it",
+			slog.String("previous_version", state.PreviousVersion),
+			slog.Time("deadline", state.Deadline),
+		)
+		recordUpdateStatus(state.TargetVersion, updateStatusVerifying, nil)
+		pendingUpdate.mu.Lock()
+		pendingUpdate.stateDir = stateDir
+		pendingUpdate.state = state
+		pendingUpdate.mu.Unlock()
+	default:
+		err := fmt.Errorf("agent restarted as version %s instead of %s", version, state.TargetVersion)
+		slog.Warn("Previous update did not take effect", slog.String("error", err.Error()))
+		recordUpdateStatus(state.TargetVersion, updateStatusFailed, err)
+		clearUpdateState(stateDir)
+	}
+}
+
+// confirmUpdateHealthy writes the health marker for a pending update once the new
+// version has proven it can reach NATS. It is a no-op if no update is pending.
+func confirmUpdateHealthy() {
+	pendingUpdate.mu.Lock()
+	defer pendingUpdate.mu.Unlock()
+
+	state := pendingUpdate.state
+	if state == nil {
+		return
+	}
+	path := filepath.Join(pendingUpdate.stateDir, updateHealthFile)
+	if err := common.WriteFileAtomic(path, []byte(state.TargetVersion), 0600); err != nil {
+		slog.Error("Failed to write update health marker", slog.String("error", err.Error()))
+		return
+	}
+	pendingUpdate.state = nil
+
+	slog.Info("Update confirmed healthy", slog.String("version", state.TargetVersion))
+	recordUpdateStatus(state.TargetVersion, updateStatusApplied, nil)
+}
+
+// RunUpdateWatchdog runs after the health deadline of an update (started by systemd-run
+// from the backup binary). It cleans up if the new version wrote its health marker and
+// otherwise restores the backup and restarts the agent.
+func RunUpdateWatchdog(stateDir string) error {
+	state, err := readUpdateState(stateDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil // already resolved
+		}
+		return err
+	}
+	if state.Status != updateStatusPending {
+		return nil
+	}
+
+	healthy, _ := os.ReadFile(filepath.Join(stateDir, updateHealthFile))
+	if strings.TrimSpace(string(healthy)) == state.TargetVersion {
+		slog.Info("Update is healthy, removing backup state", slog.String("version", state.TargetVersion))
+		clearUpdateState(stateDir)
+		return nil
+	}
+
+	slog.Warn("Update did not become healthy in time, rolling back",
+		slog.String("target_version", state.TargetVersion),
+		slog.String("previous_version", state.PreviousVersion),
+	)
+	if err := os.Rename(state.BackupPath, state.BinaryPath); err != nil {
+		return fmt.Errorf("failed to restore backup binary: %w", err)
+	}
+
+	state.Status = updateStatusRolledBack
+	state.Error = fmt.Sprintf("version %s did not report healthy by %s", state.TargetVersion, state.Deadline.Format(time.RFC3339))
+	if err := writeUpdateState(stateDir, state); err != nil {
+		slog.Error("Failed to record rollback", slog.String("error", err.Error()))
+	}
+	return restartAgent()
+}
+
+// scheduleUpdateWatchdog starts a transient systemd timer that runs the backup binary
+// with --update-watchdog once the health deadline has passed.
+func scheduleUpdateWatchdog(backupPath string, stateDir string, timeout time.Duration) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("systemd-run",
+		"--unit", fmt.Sprintf("%s-update-watchdog-%d", serviceName, time.Now().Unix()),
+		"--on-active", strconv.Itoa(int(timeout.Seconds()))+"s",
+		"--timer-property", "AccuracySec=1s",
+		backupPath, "--update-watchdog", stateDir,
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemd-run failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// backupBinary hard links binaryPath to backupPath, copying it if linking isn't possible
+func backupBinary(binaryPath string, backupPath string) error {
+	_ = os.Remove(backupPath)
+	if err := os.Link(binaryPath, backupPath); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(binaryPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(backupPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func readUpdateState(stateDir string) (*updateState, error) {
+	data, err := os.ReadFile(filepath.Join(stateDir, updateStateFile))
+	if err != nil {
+		return nil, err
+	}
+	var state updateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid update state: %w", err)
+	}
+	return &state, nil
+}
+
+func writeUpdateState(stateDir string, state *updateState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := common.WriteFileAtomic(filepath.Join(stateDir, updateStateFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write update state: %w", err)
+	}
+	return nil
+}
+
+func clearUpdateState(stateDir string) {
+	_ = os.Remove(filepath.Join(stateDir, updateStateFile))
+	_ = os.Remove(filepath.Join(stateDir, updateHealthFile))
+}
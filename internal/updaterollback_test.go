@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"cartographer-go-agent/configuration"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeUpdateEnv stubs out systemd and lays out a binary, a verified download and a state directory
+type fakeUpdateEnv struct {
+	config     configuration.Config
+	binaryPath string
+	download   string
+	restarts   int
+	watchdogs  int
+	// watchdogErr is returned when the rollback watchdog is scheduled
+	watchdogErr error
+}
+
+func newFakeUpdateEnv(t *testing.T, restartErr error) *fakeUpdateEnv {
+	t.Helper()
+	dir := t.TempDir()
+	env := &fakeUpdateEnv{
+		config:     configuration.Config{UpdateStateDir: filepath.Join(dir, "state"), UpdateHealthTimeoutSeconds: 60},
+		binaryPath: filepath.Join(dir, "cartographer-agent"),
+		download:   filepath.Join(dir, ".cartographer-agent-update-1"),
+	}
+	if err := os.WriteFile(env.binaryPath, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env.download, []byte("new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	origRestart, origSchedule := restartAgent, scheduleRollbackTask
+	restartAgent = func() error {
+		env.restarts++
+		return restartErr
+	}
+	scheduleRollbackTask = func(backupPath, stateDir string, timeout time.Duration) error {
+		env.watchdogs++
+		return env.watchdogErr
+	}
+	t.Cleanup(func() {
+		restartAgent, scheduleRollbackTask = origRestart, origSchedule
+		pendingUpdate.state = nil
+		lastUpdateStatus = nil
+	})
+	return env
+}
+
+func assertFileContent(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", filepath.Base(path), got, want)
+	}
+}
+
+func TestUpdate_HealthyVersionIsKept(t *testing.T) {
+	env := newFakeUpdateEnv(t, nil)
+
+	if err := installUpdate(env.config, "1.0.0", "2.0.0", env.download, env.binaryPath); err != nil {
+		t.Fatalf("installUpdate() error = %v", err)
+	}
+	assertFileContent(t, env.binaryPath, "new")
+	assertFileContent(t, env.binaryPath+backupSuffix, "old")
+	if env.restarts != 1 || env.watchdogs != 1 {
+		t.Errorf("expected one restart and one watchdog, got %d and %d", env.restarts, env.watchdogs)
+	}
+
+	// The new version starts and sends a heartbeat
+	ResumePendingUpdate(env.config, "2.0.0")
+	if status := getUpdateStatus(); status.Status != updateStatusVerifying {
+		t.Errorf("status = %q, want verifying", status.Status)
+	}
+	confirmUpdateHealthy()
+	if status := getUpdateStatus(); status.Status != updateStatusApplied || status.TargetVersion != "2.0.0" {
+		t.Errorf("unexpected status after heartbeat: %+v", status)
+	}
+
+	// The watchdog finds the health marker and only cleans up
+	if err := RunUpdateWatchdog(env.config.GetUpdateStateDir()); err != nil {
+		t.Fatalf("RunUpdateWatchdog() error = %v", err)
+	}
+	assertFileContent(t, env.binaryPath, "new")
+	if env.restarts != 1 {
+		t.Errorf("expected no restart from the watchdog, got %d restarts", env.restarts)
+	}
+	if _, err := os.Stat(filepath.Join(env.config.GetUpdateStateDir(), updateStateFile)); !os.IsNotExist(err) {
+		t.Error("expected update state to be removed")
+	}
+}
+
+func TestUpdate_UnhealthyVersionIsRolledBack(t *testing.T) {
+	env := newFakeUpdateEnv(t, nil)
+
+	if err := installUpdate(env.config, "1.0.0", "2.0.0", env.download, env.binaryPath); err != nil {
+		t.Fatalf("installUpdate() error = %v", err)
+	}
+
+	// The new version never confirms; the watchdog restores the backup
+	if err := RunUpdateWatchdog(env.config.GetUpdateStateDir()); err != nil {
+		t.Fatalf("RunUpdateWatchdog() error = %v", err)
+	}
+	assertFileContent(t, env.binaryPath, "old")
+	if env.restarts != 2 {
+		t.Errorf("expected the watchdog to restart the agent, got %d restarts", env.restarts)
+	}
+
+	// The previous version starts again and reports the rollback
+	ResumePendingUpdate(env.config, "1.0.0")
+	status := getUpdateStatus()
+	if status == nil || status.Status != updateStatusRolledBack || status.Error == "" {
+		t.Fatalf("unexpected status after rollback: %+v", status)
+	}
+	if _, err := os.Stat(filepath.Join(env.config.GetUpdateStateDir(), updateStateFile)); !os.IsNotExist(err) {
+		t.Error("expected update state to be removed once reported")
+	}
+}
+
+func TestUpdate_RestartFailureRestoresBackup(t *testing.T) {
+	env := newFakeUpdateEnv(t, errors.New("systemctl not found"))
+
+	if err := installUpdate(env.config, "1.0.0", "2.0.0", env.download, env.binaryPath); err == nil {
+		t.Fatal("expected installUpdate() to fail")
+	}
+	assertFileContent(t, env.binaryPath, "old")
+	if _, err := os.Stat(filepath.Join(env.config.GetUpdateStateDir(), updateStateFile)); !os.IsNotExist(err) {
+		t.Error("expected update state to be removed")
+	}
+}
+
+func TestUpdate_WatchdogFailureRestoresBackup(t *testing.T) {
+	env := newFakeUpdateEnv(t, nil)
+	env.watchdogErr = errors.New("systemd-run not found")
+
+	if err := installUpdate(env.config, "1.0.0", "2.0.0", env.download, env.binaryPath); err == nil {
+		t.Fatal("expected installUpdate() to fail")
+	}
+	assertFileContent(t, env.binaryPath, "old")
+	if env.restarts != 0 {
+		t.Errorf("expected no restart without a watchdog, got %d", env.restarts)
+	}
+	if _, err := os.Stat(filepath.Join(env.config.GetUpdateStateDir(), updateStateFile)); !os.IsNotExist(err) {
+		t.Error("expected update state to be removed")
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// Update status values reported in UpdateStatus.Status
+const (
+	updateStatusInstalling = "installing"
+	updateStatusFailed     = "failed"
+)
+
+// UpdateStatus describes the most recent self-update attempt; it is sent in the heartbeat
+type UpdateStatus struct {
+	TargetVersion string `json:"target_version"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	Reason        string `json:"reason,omitempty"`        // why a rollout was deferred or skipped
+	ScheduledFor  string `json:"scheduled_for,omitempty"` // when a deferred update will be applied
+	Timestamp     string `json:"timestamp"`
+}
+
+var (
+	updateStatusMu   sync.Mutex
+	lastUpdateStatus *UpdateStatus
+)
+
+// recordUpdateStatus remembers the outcome of an update attempt for the next heartbeat
+func recordUpdateStatus(targetVersion string, status string, err error) {
+	update := &UpdateStatus{
+		TargetVersion: targetVersion,
+		Status:        status,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		update.Error = err.Error()
+	}
+	setUpdateStatus(update)
+}
+
+// recordRolloutDecision remembers that an update was deferred or skipped by its rollout policy
+func recordRolloutDecision(targetVersion string, decision rolloutDecision) *UpdateStatus {
+	update := &UpdateStatus{
+		TargetVersion: targetVersion,
+		Status:        decision.Status,
+		Reason:        decision.Reason,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+	}
+	if !decision.At.IsZero() {
+		update.ScheduledFor = decision.At.UTC().Format(time.RFC3339)
+	}
+	setUpdateStatus(update)
+	return update
+}
+
+func setUpdateStatus(update *UpdateStatus) {
+	updateStatusMu.Lock()
+	defer updateStatusMu.Unlock()
+	lastUpdateStatus = update
+}
+
+// getUpdateStatus returns the most recent update attempt, or nil if there was none
+func getUpdateStatus() *UpdateStatus {
+	updateStatusMu.Lock()
+	defer updateStatusMu.Unlock()
+	if lastUpdateStatus == nil {
+		return nil
+	}
+	update := *lastUpdateStatus
+	return &update
+}
@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"cartographer-go-agent/configuration"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// EmbeddedUpdatePublicKey is the base64 ed25519 key release checksums are signed with.
+// It is set at build time with -ldflags "-X cartographer-go-agent/internal.EmbeddedUpdatePublicKey=...";
+// update_public_key in the config takes precedence.
+var EmbeddedUpdatePublicKey = ""
+
+const (
+	// defaultChecksumsFile is fetched from the same directory as the binary when release_checksums_url is unset
+	defaultChecksumsFile = "checksums.txt"
+	// maxChecksumsSize bounds how much of the checksums and signature files is read
+	maxChecksumsSize  = 1 << 20
+	updateHTTPTimeout = 5 * time.Minute
+)
+
+var (
+	// ErrChecksumMismatch means the downloaded binary doesn't match the published checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrChecksumMissing means the checksums file has no entry for the binary
+	ErrChecksumMissing = errors.New("no checksum for release binary")
+	// ErrSignatureInvalid means the checksums file signature doesn't verify against the public key
+	ErrSignatureInvalid = errors.New("invalid checksums signature")
+	// ErrNoUpdatePublicKey means no key is available to verify signatures and unsigned updates aren't allowed
+	ErrNoUpdatePublicKey = errors.New("no update public key configured")
+)
+
+var updateHTTPClient = &http.Client{Timeout: updateHTTPTimeout}
+
+// releaseVerifier checks a downloaded release binary against the signed checksums file
+type releaseVerifier struct {
+	checksumsURL  string
+	signatureURL  string
+	publicKey     ed25519.PublicKey // nil if unsigned updates are allowed and no key is set
+	allowUnsigned bool
+}
+
+// newReleaseVerifier resolves the checksums and signature URLs for the binary at downloadURL
+func newReleaseVerifier(version string, downloadURL string, config configuration.Config) (*releaseVerifier, error) {
+	v := &releaseVerifier{allowUnsigned: config.AllowUnsignedUpdates}
+
+	if config.ReleaseChecksumsURL != "" {
+		checksumsURL, err := buildDownloadURL(version, config.ReleaseChecksumsURL)
+		if err != nil {
+			return nil, err
+		}
+		v.checksumsURL = checksumsURL
+	} else {
+		base, err := url.Parse(downloadURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download URL: %w", err)
+		}
+		v.checksumsURL = base.ResolveReference(&url.URL{Path: defaultChecksumsFile}).String()
+	}
+
+	if config.ReleaseSignatureURL != "" {
+		signatureURL, err := buildDownloadURL(version, config.ReleaseSignatureURL)
+		if err != nil {
+			return nil, err
+		}
+		v.signatureURL = signatureURL
+	} else {
+		v.signatureURL = v.checksumsURL + ".sig"
+	}
+
+	key := config.UpdatePublicKey
+	if key == "" {
+		key = EmbeddedUpdatePublicKey
+	}
+	if key != "" {
+		publicKey, err := configuration.ParseUpdatePublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		v.publicKey = publicKey
+	} else if !v.allowUnsigned {
+		return nil, ErrNoUpdatePublicKey
+	}
+	return v, nil
+}
+
+// verify checks that the file at binaryPath, downloaded from downloadURL, has the checksum
+// listed for it in the checksums file and that the checksums file is signed by the public key.
+func (v *releaseVerifier) verify(binaryPath string, downloadURL string) error {
+	checksums, err := fetchSmall(v.checksumsURL)
+	if err != nil {
+		return fmt.Errorf("failed to download checksums: %w", err)
+	}
+
+	if v.publicKey != nil {
+		signature, err := fetchSmall(v.signatureURL)
+		if err != nil {
+			return fmt.Errorf("failed to download checksums signature: %w", err)
+		}
+		if err := verifySignature(v.publicKey, checksums, signature); err != nil {
+			return err
+		}
+		slog.Info("Verified checksums signature", slog.String("url", v.checksumsURL))
+	} else {
+		slog.Warn("Skipping signature verification, allow_unsigned_updates is set")
+	}
+
+	fileName := path.Base(downloadURL)
+	if u, err := url.Parse(downloadURL); err == nil {
+		fileName = path.Base(u.Path)
+	}
+	expected, err := findChecksum(checksums, fileName)
+	if err != nil {
+		return err
+	}
+
+	actual, err := sha256File(binaryPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash downloaded binary: %w", err)
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w for %s: expected %s, got %s", ErrChecksumMismatch, fileName, expected, actual)
+	}
+	slog.Info("Verified binary checksum", slog.String("file", fileName), slog.String("sha256", actual))
+	return nil
+}
+
+// verifySignature checks an ed25519 signature over data. The signature may be raw
+// (64 bytes) or base64 encoded, as produced by most signing tools.
+func verifySignature(publicKey ed25519.PublicKey, data []byte, signature []byte) error {
+	sig := signature
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("%w: signature is neither raw nor base64: %v", ErrSignatureInvalid, err)
+		}
+		sig = decoded
+	}
+	if len(sig) != ed25519.SignatureSize || !ed25519.Verify(publicKey, data, sig) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// findChecksum returns the SHA-256 listed for fileName in a sha256sum-style checksums file
+func findChecksum(checksums []byte, fileName string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks binary mode with a leading '*'
+		if strings.TrimPrefix(fields[1], "*") != fileName {
+			continue
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil || len(fields[0]) != sha256.Size*2 {
+			return "", fmt.Errorf("malformed checksum for %s", fileName)
+		}
+		return fields[0], nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrChecksumMissing, fileName)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetchSmall downloads a small release metadata file into memory
+func fetchSmall(url string) ([]byte, error) {
+	resp, err := updateHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s, status code: %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxChecksumsSize))
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"cartographer-go-agent/configuration"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// releaseServer serves a fake release: the binary, a checksums file and its signature
+type releaseServer struct {
+	binary    []byte
+	checksums []byte
+	signature []byte
+}
+
+func (r *releaseServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/v1.2.3/cartographer-agent_linux-amd64":
+		_, _ = w.Write(r.binary)
+	case "/v1.2.3/checksums.txt":
+		_, _ = w.Write(r.checksums)
+	case "/v1.2.3/checksums.txt.sig":
+		_, _ = w.Write(r.signature)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestReleaseVerifier(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	binary := []byte("#!/bin/sh\necho new version\n")
+	sum := sha256.Sum256(binary)
+	checksums := []byte(fmt.Sprintf("%s  cartographer-agent_darwin-arm64\n%s *cartographer-agent_linux-amd64\n",
+		hex.EncodeToString(make([]byte, 32)), hex.EncodeToString(sum[:])))
+	signed := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, checksums))
+
+	tests := []struct {
+		name          string
+		release       releaseServer
+		publicKey     string
+		allowUnsigned bool
+		wantErr       error
+	}{
+		{
+			name:      "valid base64 signature",
+			release:   releaseServer{binary: binary, checksums: checksums, signature: []byte(signed + "\n")},
+			publicKey: base64.StdEncoding.EncodeToString(publicKey),
+		},
+		{
+			name:      "valid raw signature",
+			release:   releaseServer{binary: binary, checksums: checksums, signature: ed25519.Sign(privateKey, checksums)},
+			publicKey: base64.StdEncoding.EncodeToString(publicKey),
+		},
+		{
+			name:      "tampered binary",
+			release:   releaseServer{binary: []byte("malicious"), checksums: checksums, signature: []byte(signed)},
+			publicKey: base64.StdEncoding.EncodeToString(publicKey),
+			wantErr:   ErrChecksumMismatch,
+		},
+		{
+			name:      "signed by another key",
+			release:   releaseServer{binary: binary, checksums: checksums, signature: ed25519.Sign(otherKey, checksums)},
+			publicKey: base64.StdEncoding.EncodeToString(publicKey),
+			wantErr:   ErrSignatureInvalid,
+		},
+		{
+			name:      "binary missing from checksums",
+			release:   releaseServer{binary: binary, checksums: []byte("abc  other\n"), signature: ed25519.Sign(privateKey, []byte("abc  other\n"))},
+			publicKey: base64.StdEncoding.EncodeToString(publicKey),
+			wantErr:   ErrChecksumMissing,
+		},
+		{
+			name:    "no public key",
+			release: releaseServer{binary: binary, checksums: checksums},
+			wantErr: ErrNoUpdatePublicKey,
+		},
+		{
+			name:          "unsigned allowed still checks checksum",
+			release:       releaseServer{binary: []byte("corrupt"), checksums: checksums},
+			allowUnsigned: true,
+			wantErr:       ErrChecksumMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(&tt.release)
+			defer srv.Close()
+
+			config := configuration.Config{
+				ReleaseURL:           srv.URL + "/{{.version}}/cartographer-agent_linux-amd64",
+				UpdatePublicKey:      tt.publicKey,
+				AllowUnsignedUpdates: tt.allowUnsigned,
+			}
+			downloadURL, _ := buildDownloadURL("v1.2.3", config.ReleaseURL)
+
+			err := func() error {
+				verifier, err := newReleaseVerifier("v1.2.3", downloadURL, config)
+				if err != nil {
+					return err
+				}
+				path := filepath.Join(t.TempDir(), "agent")
+				if err := downloadFile(path, downloadURL); err != nil {
+					t.Fatalf("downloadFile() error = %v", err)
+				}
+				return verifier.verify(path, downloadURL)
+			}()
+
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrepareUpdate_RefusesUnverifiedBinary(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	checksums := []byte(hex.EncodeToString(make([]byte, 32)) + "  cartographer-agent_linux-amd64\n")
+	srv := httptest.NewServer(&releaseServer{
+		binary:    []byte("#!/bin/sh\necho tampered\n"),
+		checksums: checksums,
+		signature: ed25519.Sign(privateKey, checksums),
+	})
+	defer srv.Close()
+
+	config := configuration.Config{
+		ReleaseURL:      srv.URL + "/{{.version}}/cartographer-agent_linux-amd64",
+		UpdatePublicKey: base64.StdEncoding.EncodeToString(publicKey),
+	}
+	dir := t.TempDir()
+	if _, err := prepareUpdate("v1.2.3", config, filepath.Join(dir, "cartographer-agent")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("prepareUpdate() error = %v, want ErrChecksumMismatch", err)
+	}
+	if leftovers, _ := os.ReadDir(dir); len(leftovers) != 0 {
+		t.Errorf("expected the rejected download to be removed, found %v", leftovers)
+	}
+}
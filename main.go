@@ -1,17 +1,20 @@
 package main
 
 import (
+	"cartographer-go-agent/collectors"
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
 	"cartographer-go-agent/internal"
 	"cartographer-go-agent/monitors"
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
-
-	"github.com/nats-io/nats.go"
+	"syscall"
+	"time"
 )
 
 var (
@@ -51,6 +54,8 @@ func main() {
 	showVersion := flag.Bool("version", false, "Show cartographer-agent version")
 	dryrun := flag.Bool("dryrun", false, "Run once and print payload")
 	validateConfig := flag.Bool("validate-config", false, "Validate the configuration file and exit")
+	clearCache := flag.Bool("clear-cache", false, "Clear the persistent collector cache (cache_dir) before starting")
+	updateWatchdog := flag.String("update-watchdog", "", "Internal: check the update in the given state directory and roll back if unhealthy")
 
 	flag.Parse()
 
@@ -59,6 +64,15 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Run by systemd-run from the backup binary after an update's health deadline
+	if *updateWatchdog != "" {
+		if err := internal.RunUpdateWatchdog(*updateWatchdog); err != nil {
+			slog.Error("Update watchdog failed", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	var config configuration.Config
 	var err error
 
@@ -89,31 +103,126 @@ func main() {
 		os.Exit(0)
 	}
 
-	logLevel := getLogLevelFromConfig(config.LogLevel)
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+	// A LevelVar lets a config reload change the log level
+	var logLevel slog.LevelVar
+	logLevel.Set(getLogLevelFromConfig(config.LogLevel))
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: &logLevel}))
 	slog.SetDefault(logger)
 	slog.Info("Configuration loaded successfully")
 
+	if *clearCache && config.CacheDir != "" {
+		if store, err := collectors.NewDiskCache(config.CacheDir); err != nil {
+			slog.Error("Failed to open collector cache", slog.String("error", err.Error()))
+		} else if err := store.Clear(); err != nil {
+			slog.Error("Failed to clear collector cache", slog.String("error", err.Error()))
+		} else {
+			slog.Info("Cleared collector cache", slog.String("cache_dir", config.CacheDir))
+		}
+	}
+
+	// Cancelled on SIGINT/SIGTERM to start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	grace := config.GetShutdownGrace()
+	graceCtx, cancelGrace := common.WithGracePeriod(ctx, grace)
+	defer cancelGrace()
+
+	// Report the outcome of an update applied by the previous process
+	if !config.DRYRUN {
+		internal.ResumePendingUpdate(config, Version)
+	}
+
 	collectorsList := internal.GetCollectors(config)
 
 	// Establish NATS connection (skip in dry-run mode)
-	var nc *nats.Conn
+	var pub *common.Publisher
 	if !config.DRYRUN {
-		nc, err = common.ConnectNATS(config.NatsURL, config.NatsNkeySeed)
+		nc, err := common.ConnectNATS(config.NatsURL, config.NatsNkeySeed)
 		if err != nil {
 			slog.Error("Failed to connect to NATS", slog.String("error", err.Error()))
 			os.Exit(1)
 		}
 		defer nc.Close()
+
+		// Spool reports to disk while NATS is unavailable (if enabled)
+		var outbox *common.Outbox
+		if config.OutboxDir != "" {
+			maxBytes, maxAge := config.GetOutboxLimits()
+			outbox, err = common.OpenOutbox(config.OutboxDir, maxBytes, maxAge)
+			if err != nil {
+				slog.Error("Outbox disabled", slog.String("error", err.Error()))
+			}
+		}
+		pub = common.NewPublisher(nc, outbox)
+
+		// Publish durable messages to JetStream with acks (if enabled)
+		if config.JetStream {
+			agentID, err := common.GetOrCreateUUID()
+			if err == nil {
+				err = pub.EnableJetStream(common.JetStreamOptions{
+					AgentID:    agentID,
+					AckTimeout: config.GetJetStreamAckTimeout(),
+					MaxRetries: config.GetJetStreamMaxRetries(),
+					RetryWait:  time.Second,
+				})
+			}
+			if err != nil {
+				slog.Error("Failed to enable JetStream publishing", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			slog.Info("JetStream publishing enabled", slog.String("agent_id", agentID))
+		}
+		go pub.RunOutbox(ctx)
 	}
 
-	// Start monitoring system in background (if enabled)
-	if config.IsMonitoringEnabled() {
-		go monitors.Run(config, Version, nc)
-	} else {
+	// Start monitoring system in background; no monitors are scheduled while it is
+	// disabled, so a reload can enable it
+	monitoring := monitors.NewMonitoring(config, Version, pub)
+	if !config.IsMonitoringEnabled() {
 		slog.Info("Monitoring is disabled")
 	}
+	monitoringDone := make(chan struct{})
+	go func() {
+		monitoring.Run(ctx)
+		close(monitoringDone)
+	}()
+
+	// Reload the config file on SIGHUP or when it changes
+	reload := internal.ReloadOptions{
+		ConfigPath: *configPath,
+		Load: func() (configuration.Config, error) {
+			next, err := configuration.GetConfig(*configPath)
+			if err != nil {
+				return configuration.Config{}, err
+			}
+			next.DRYRUN = config.DRYRUN
+			return next, configuration.ValidateConfig(next)
+		},
+		Monitoring: monitoring,
+		OnConfig: func(next configuration.Config) {
+			logLevel.Set(getLogLevelFromConfig(next.LogLevel))
+		},
+	}
 
-	// Start main agent (existing collectors, heartbeat, updates)
-	internal.RunAgent(config, collectorsList, Version, nc)
+	// Start main agent (existing collectors, heartbeat, updates); returns on shutdown,
+	// or after the first report when not running as a daemon
+	internal.RunAgent(ctx, config, collectorsList, Version, pub, reload)
+	stop()
+
+	// Let a running monitoring cycle publish its results
+	if config.Daemonize {
+		select {
+		case <-monitoringDone:
+		case <-graceCtx.Done():
+			slog.Warn("Monitoring cycle did not finish in time")
+		}
+	}
+
+	// Deliver pending messages and command replies before exiting
+	if pub != nil {
+		if err := pub.Drain(grace); err != nil {
+			slog.Error("Failed to drain NATS connection", slog.String("error", err.Error()))
+		}
+	}
+	slog.Info("Agent stopped")
 }
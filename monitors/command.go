@@ -3,6 +3,7 @@ package monitors
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"regexp"
@@ -20,7 +21,8 @@ func truncateOutput(s string) string {
 	return s
 }
 
-// checkCommand executes a custom command and validates the output
+// checkCommand executes a custom command and validates the output, or in nagios output
+// mode reads the status, message and perfdata from it
 //
 // SECURITY WARNING: This function executes arbitrary shell commands using 'sh -c'
 // without sanitization. Monitor configurations should only be loaded from trusted
@@ -35,13 +37,15 @@ func truncateOutput(s string) string {
 // - Arbitrary file system access with agent permissions
 // - Network operations
 // - Process execution
-func checkCommand(monitor Monitor) (MonitorStatus, string) {
+func checkCommand(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.Timeout)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(monitor.Timeout)*time.Second)
 	defer cancel()
 
 	// Create command with shell execution to support piping and shell features
 	cmd := exec.CommandContext(ctx, "sh", "-c", monitor.Command)
+	// Don't wait on children of the shell that still hold the output pipes once it is killed
+	cmd.WaitDelay = time.Second
 
 	// Set working directory if specified
 	if monitor.WorkingDir != "" {
@@ -73,7 +77,7 @@ func checkCommand(monitor Monitor) (MonitorStatus, string) {
 					msg += fmt.Sprintf(", Stderr: %s", truncateOutput(stderrStr))
 				}
 			}
-			return StatusCritical, msg
+			return StatusCritical, msg, nil
 		} else {
 			msg := fmt.Sprintf("Failed to execute command: %v", err)
 			if stdoutStr != "" || stderrStr != "" {
@@ -82,10 +86,15 @@ func checkCommand(monitor Monitor) (MonitorStatus, string) {
 					msg += fmt.Sprintf(", Stderr: %s", truncateOutput(stderrStr))
 				}
 			}
-			return StatusUnknown, msg
+			return StatusUnknown, msg, nil
 		}
 	}
 
+	// Plugins report their status through the exit code
+	if monitor.OutputMode == OutputModeNagios {
+		return checkPluginResult(exitCode, stdout.String(), stderrStr)
+	}
+
 	// Validate exit code
 	expectedExitCode := 0
 	if monitor.Validations != nil && monitor.Validations.ExitCode != nil {
@@ -97,20 +106,20 @@ func checkCommand(monitor Monitor) (MonitorStatus, string) {
 		if stderrStr != "" {
 			msg += fmt.Sprintf(", Stderr: %s", truncateOutput(stderrStr))
 		}
-		return StatusCritical, msg
+		return StatusCritical, msg, nil
 	}
 
 	// Validate output contains expected string
 	if monitor.Validations != nil && monitor.Validations.OutputContains != "" {
 		if !strings.Contains(stdoutStr, monitor.Validations.OutputContains) {
-			return StatusCritical, fmt.Sprintf("Output does not contain expected string: '%s'. Got: %s", monitor.Validations.OutputContains, truncateOutput(stdoutStr))
+			return StatusCritical, fmt.Sprintf("Output does not contain expected string: '%s'. Got: %s", monitor.Validations.OutputContains, truncateOutput(stdoutStr)), nil
 		}
 	}
 
 	// Validate output does NOT contain specified string
 	if monitor.Validations != nil && monitor.Validations.OutputNotContains != "" {
 		if strings.Contains(stdoutStr, monitor.Validations.OutputNotContains) {
-			return StatusCritical, fmt.Sprintf("Output must not contain: '%s'. Got: %s", monitor.Validations.OutputNotContains, truncateOutput(stdoutStr))
+			return StatusCritical, fmt.Sprintf("Output must not contain: '%s'. Got: %s", monitor.Validations.OutputNotContains, truncateOutput(stdoutStr)), nil
 		}
 	}
 
@@ -118,17 +127,40 @@ func checkCommand(monitor Monitor) (MonitorStatus, string) {
 	if monitor.Validations != nil && monitor.Validations.OutputRegex != "" {
 		matched, err := regexp.MatchString(monitor.Validations.OutputRegex, stdoutStr)
 		if err != nil {
-			return StatusUnknown, fmt.Sprintf("Invalid regex pattern: %v", err)
+			return StatusUnknown, fmt.Sprintf("Invalid regex pattern: %v", err), nil
 		}
 		if !matched {
-			return StatusCritical, fmt.Sprintf("Output does not match regex: '%s'. Got: %s", monitor.Validations.OutputRegex, truncateOutput(stdoutStr))
+			return StatusCritical, fmt.Sprintf("Output does not match regex: '%s'. Got: %s", monitor.Validations.OutputRegex, truncateOutput(stdoutStr)), nil
 		}
 	}
 
 	// Validate stderr contains expected string
 	if monitor.Validations != nil && monitor.Validations.ErrorContains != "" {
 		if !strings.Contains(stderrStr, monitor.Validations.ErrorContains) {
-			return StatusCritical, fmt.Sprintf("Stderr does not contain expected string: '%s'. Got: %s", monitor.Validations.ErrorContains, truncateOutput(stderrStr))
+			return StatusCritical, fmt.Sprintf("Stderr does not contain expected string: '%s'. Got: %s", monitor.Validations.ErrorContains, truncateOutput(stderrStr)), nil
+		}
+	}
+
+	// Validate JSON assertions against the output
+	if monitor.Validations != nil && len(monitor.Validations.JSONPath) > 0 {
+		if err := checkJSONAssertions(stdoutStr, monitor.Validations.JSONPath); errors.Is(err, errInvalidJSON) {
+			return StatusCritical, fmt.Sprintf("Output is %v. Got: %s", err, truncateOutput(stdoutStr)), nil
+		} else if err != nil {
+			return StatusCritical, fmt.Sprintf("Output JSON assertion failed: %v", err), nil
+		}
+	}
+
+	// Compare a numeric value in the output against the warning/critical thresholds
+	var metrics []Metric
+	if monitor.Thresholds != nil && monitor.Thresholds.Value != nil {
+		value, err := monitor.Thresholds.outputValue(stdoutStr)
+		if err != nil {
+			return StatusUnknown, fmt.Sprintf("Failed to read value: %v", err), nil
+		}
+		threshold := monitor.Thresholds.Value
+		metrics = append(metrics, Metric{Name: "value", Value: value}.withThreshold(threshold))
+		if status := threshold.evaluate(value, threshold.lowerIsWorse()); status != StatusOK {
+			return status, fmt.Sprintf("Value %s reached the %s threshold. Output: %s", formatValue(value), status, truncateOutput(stdoutStr)), metrics
 		}
 	}
 
@@ -138,5 +170,5 @@ func checkCommand(monitor Monitor) (MonitorStatus, string) {
 		message = fmt.Sprintf("%s. Output: %s", message, truncateOutput(stdoutStr))
 	}
 
-	return StatusOK, message
+	return StatusOK, message, metrics
 }
@@ -2,12 +2,20 @@ package monitors
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/go-co-op/gocron/v2"
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultInterval is how often a monitor runs, in seconds, if it has neither an interval nor a schedule
+const DefaultInterval = 60
+
 // MonitorFile represents the structure of a monitor configuration file
 type MonitorFile struct {
 	Monitors []Monitor `yaml:"monitors"`
@@ -26,6 +34,20 @@ type Monitor struct {
 	Retries     int      `yaml:"retries" json:"retries"`
 	RetryDelay  int      `yaml:"retry_delay" json:"retry_delay"`
 
+	// Scheduling: run every Interval seconds, or on a cron Schedule (e.g. "*/10 * * * *")
+	Interval int    `yaml:"interval" json:"interval,omitempty"`
+	Schedule string `yaml:"schedule" json:"schedule,omitempty"`
+
+	// Soft/hard states: a failure is soft until it was seen on this many consecutive checks
+	MaxCheckAttempts int `yaml:"max_check_attempts" json:"max_check_attempts,omitempty"`
+
+	// Warning/critical pairs for measured values
+	Thresholds *Thresholds `yaml:"thresholds" json:"thresholds,omitempty"`
+
+	// Flap detection: state change percentages at which flapping stops and starts
+	FlapLowThreshold  float64 `yaml:"flap_low_threshold" json:"flap_low_threshold,omitempty"`
+	FlapHighThreshold float64 `yaml:"flap_high_threshold" json:"flap_high_threshold,omitempty"`
+
 	// HTTP-specific fields
 	URL             string            `yaml:"url" json:"url,omitempty"`
 	Method          string            `yaml:"method" json:"method,omitempty"`
@@ -39,6 +61,9 @@ type Monitor struct {
 	Port     int    `yaml:"port" json:"port,omitempty"`
 	Host     string `yaml:"host" json:"host,omitempty"`
 	Protocol string `yaml:"protocol" json:"protocol,omitempty"`
+	Send     string `yaml:"send" json:"send,omitempty"`         // payload to send once connected
+	SendHex  string `yaml:"send_hex" json:"send_hex,omitempty"` // payload as hex bytes, for binary protocols
+	Probe    string `yaml:"probe" json:"probe,omitempty"`       // built-in check: ssh, smtp, redis or memcached
 
 	// Systemd-specific fields
 	Target string `yaml:"target" json:"target,omitempty"`
@@ -46,6 +71,24 @@ type Monitor struct {
 	// Command-specific fields
 	Command    string `yaml:"command" json:"command,omitempty"`
 	WorkingDir string `yaml:"working_dir" json:"working_dir,omitempty"`
+	OutputMode string `yaml:"output_mode" json:"output_mode,omitempty"` // "nagios" for Nagios/Icinga plugins
+
+	// DNS-specific fields; Protocol is udp (default, retried over tcp when truncated) or tcp
+	Query      string `yaml:"query" json:"query,omitempty"`
+	RecordType string `yaml:"record_type" json:"record_type,omitempty"`
+	Resolver   string `yaml:"resolver" json:"resolver,omitempty"` // host[:port], defaults to the system resolver
+	DNSSEC     bool   `yaml:"dnssec" json:"dnssec,omitempty"`     // require the resolver to set the AD bit
+
+	// TLS-specific fields; Host, Port and VerifyTLS are shared with the types above
+	ServerName string `yaml:"server_name" json:"server_name,omitempty"` // SNI and name to verify, defaults to Host
+	StartTLS   string `yaml:"starttls" json:"starttls,omitempty"`       // smtp, imap, pop3 or postgres
+	CAFile     string `yaml:"ca_file" json:"ca_file,omitempty"`         // PEM roots to verify against instead of the system's
+
+	// Ping-specific fields; Host is shared with the types above
+	Count int `yaml:"count" json:"count,omitempty"` // echo requests per check
+
+	// Traceroute-specific fields; Host is shared with the types above
+	MaxHops int `yaml:"max_hops" json:"max_hops,omitempty"` // highest TTL probed
 }
 
 // Validations represents validation rules for monitors (type-specific fields)
@@ -67,6 +110,23 @@ type Validations struct {
 	OutputRegex       string `yaml:"output_regex" json:"output_regex,omitempty"`
 	OutputNotContains string `yaml:"output_not_contains" json:"output_not_contains,omitempty"`
 	ErrorContains     string `yaml:"error_contains" json:"error_contains,omitempty"`
+
+	// DNS validations
+	Answers []string `yaml:"answers" json:"answers,omitempty"` // each must be in the response
+	Rcode   string   `yaml:"rcode" json:"rcode,omitempty"`     // defaults to NOERROR
+
+	// JSON validations, for http response bodies and command output
+	JSONPath []JSONAssertion `yaml:"json_path" json:"json_path,omitempty"`
+
+	// Port validations, checked against the response to send, send_hex or probe
+	ResponseContains string `yaml:"response_contains" json:"response_contains,omitempty"`
+	ResponseRegex    string `yaml:"response_regex" json:"response_regex,omitempty"`
+	ResponseHex      string `yaml:"response_hex" json:"response_hex,omitempty"` // bytes the response must contain
+
+	// TLS validations
+	MinTLSVersion       string   `yaml:"min_tls_version" json:"min_tls_version,omitempty"`           // 1.0, 1.1, 1.2 or 1.3
+	MinKeyBits          int      `yaml:"min_key_bits" json:"min_key_bits,omitempty"`                 // applies to RSA keys
+	SignatureAlgorithms []string `yaml:"signature_algorithms" json:"signature_algorithms,omitempty"` // e.g. SHA256-RSA, ECDSA-SHA384
 }
 
 // ApplyDefaults applies default values to a monitor configuration
@@ -81,6 +141,12 @@ func (m *Monitor) ApplyDefaults() {
 	if m.Retries == 0 {
 		m.Retries = 1
 	}
+	if m.Interval == 0 && m.Schedule == "" {
+		m.Interval = DefaultInterval
+	}
+	if m.MaxCheckAttempts == 0 {
+		m.MaxCheckAttempts = 1
+	}
 
 	// HTTP defaults
 	if m.Type == "http" {
@@ -133,6 +199,51 @@ func (m *Monitor) ApplyDefaults() {
 		}
 	}
 
+	// DNS defaults
+	if m.Type == "dns" {
+		if m.RecordType == "" {
+			m.RecordType = "A"
+		}
+		m.RecordType = strings.ToUpper(m.RecordType)
+		if m.Protocol == "" {
+			m.Protocol = "udp"
+		}
+	}
+
+	// TLS defaults
+	if m.Type == "tls" {
+		if m.VerifyTLS == nil {
+			defaultVerifyTLS := true
+			m.VerifyTLS = &defaultVerifyTLS
+		}
+		if m.Thresholds == nil {
+			m.Thresholds = &Thresholds{}
+		}
+		if m.Thresholds.CertExpiryDays == nil {
+			warning, critical := float64(DefaultTLSExpiryWarningDays), float64(DefaultTLSExpiryCriticalDays)
+			m.Thresholds.CertExpiryDays = &Threshold{Warning: &warning, Critical: &critical}
+		}
+	}
+
+	// Ping defaults
+	if m.Type == "ping" {
+		if m.Count == 0 {
+			m.Count = DefaultPingCount
+		}
+		if m.Thresholds == nil {
+			m.Thresholds = &Thresholds{}
+		}
+		if m.Thresholds.PacketLossPercent == nil {
+			warning, critical := float64(DefaultPingLossWarning), float64(DefaultPingLossCritical)
+			m.Thresholds.PacketLossPercent = &Threshold{Warning: &warning, Critical: &critical}
+		}
+	}
+
+	// Traceroute defaults
+	if m.Type == "traceroute" && m.MaxHops == 0 {
+		m.MaxHops = DefaultTracerouteMaxHops
+	}
+
 	// Command defaults
 	if m.Type == "command" {
 		if m.Validations == nil {
@@ -158,9 +269,9 @@ func (m *Monitor) Validate() error {
 		return fmt.Errorf("monitor type is required for '%s'", m.Name)
 	}
 
-	validTypes := map[string]bool{"http": true, "port": true, "systemd": true, "command": true}
+	validTypes := map[string]bool{"http": true, "port": true, "systemd": true, "command": true, "dns": true, "tls": true, "ping": true, "traceroute": true}
 	if !validTypes[m.Type] {
-		return fmt.Errorf("invalid monitor type '%s' for '%s', must be http, port, systemd, or command", m.Type, m.Name)
+		return fmt.Errorf("invalid monitor type '%s' for '%s', must be http, port, systemd, command, dns, tls, ping, or traceroute", m.Type, m.Name)
 	}
 
 	validPriorities := map[string]bool{"critical": true, "high": true, "medium": true, "low": true, "info": true}
@@ -168,6 +279,44 @@ func (m *Monitor) Validate() error {
 		return fmt.Errorf("invalid priority '%s' for '%s'", m.Priority, m.Name)
 	}
 
+	if m.Interval < 0 {
+		return fmt.Errorf("interval must not be negative for '%s'", m.Name)
+	}
+	if m.Schedule != "" {
+		if m.Interval > 0 {
+			return fmt.Errorf("interval and schedule are mutually exclusive for '%s'", m.Name)
+		}
+		if err := gocron.NewDefaultCron(false).IsValid(m.Schedule, time.Local, time.Now()); err != nil {
+			return fmt.Errorf("invalid schedule '%s' for '%s': %w", m.Schedule, m.Name, err)
+		}
+	}
+
+	if m.MaxCheckAttempts < 0 {
+		return fmt.Errorf("max_check_attempts must not be negative for '%s'", m.Name)
+	}
+	if m.Thresholds != nil {
+		if err := m.Thresholds.validate(m.Type); err != nil {
+			return fmt.Errorf("invalid thresholds for '%s': %w", m.Name, err)
+		}
+	}
+	if m.FlapLowThreshold < 0 || m.FlapHighThreshold < 0 || m.FlapLowThreshold > 100 || m.FlapHighThreshold > 100 {
+		return fmt.Errorf("flap thresholds must be between 0 and 100 for '%s'", m.Name)
+	}
+	if low, high := m.flapThresholds(); low > high {
+		return fmt.Errorf("flap_low_threshold must not be greater than flap_high_threshold for '%s'", m.Name)
+	}
+
+	if m.Validations != nil && len(m.Validations.JSONPath) > 0 {
+		if m.Type != "http" && m.Type != "command" {
+			return fmt.Errorf("json_path validations only apply to http and command monitors for '%s'", m.Name)
+		}
+		for _, assertion := range m.Validations.JSONPath {
+			if err := assertion.validate(); err != nil {
+				return fmt.Errorf("invalid json_path validation for '%s': %w", m.Name, err)
+			}
+		}
+	}
+
 	// Type-specific validation
 	switch m.Type {
 	case "http":
@@ -181,9 +330,41 @@ func (m *Monitor) Validate() error {
 		if m.Protocol != "tcp" && m.Protocol != "udp" {
 			return fmt.Errorf("invalid protocol '%s' for port monitor '%s', must be tcp or udp", m.Protocol, m.Name)
 		}
-		// UDP only supports localhost
-		if m.Protocol == "udp" && m.Host != "localhost" {
-			return fmt.Errorf("udp protocol only supports localhost for monitor '%s'", m.Name)
+		if m.Send != "" && m.SendHex != "" {
+			return fmt.Errorf("send and send_hex are mutually exclusive for port monitor '%s'", m.Name)
+		}
+		if _, err := decodeHex(m.SendHex); err != nil {
+			return fmt.Errorf("invalid send_hex for port monitor '%s': %w", m.Name, err)
+		}
+		if m.Validations != nil {
+			if _, err := decodeHex(m.Validations.ResponseHex); err != nil {
+				return fmt.Errorf("invalid response_hex for port monitor '%s': %w", m.Name, err)
+			}
+		}
+		if m.Probe != "" {
+			if _, ok := bannerProbes[m.Probe]; !ok {
+				return fmt.Errorf("invalid probe '%s' for port monitor '%s', must be ssh, smtp, redis, or memcached", m.Probe, m.Name)
+			}
+			if m.Protocol != "tcp" {
+				return fmt.Errorf("probe requires tcp protocol for port monitor '%s'", m.Name)
+			}
+			if m.Send != "" || m.SendHex != "" {
+				return fmt.Errorf("probe cannot be combined with send or send_hex for port monitor '%s'", m.Name)
+			}
+		}
+		if m.Thresholds != nil && m.Thresholds.ResponseTimeMs != nil && !m.hasPayloadProbe() {
+			return fmt.Errorf("response_time_ms thresholds require send, send_hex or probe for port monitor '%s'", m.Name)
+		}
+		if m.Protocol == "udp" {
+			if m.hasPayloadProbe() {
+				// A UDP server only answers a request, so there is nothing to validate without one
+				if m.Send == "" && m.SendHex == "" {
+					return fmt.Errorf("send or send_hex is required to check a udp response for monitor '%s'", m.Name)
+				}
+			} else if m.Host != "localhost" {
+				// Without a payload, UDP can only be checked as bound on localhost
+				return fmt.Errorf("udp protocol only supports localhost for monitor '%s' unless send or send_hex is set", m.Name)
+			}
 		}
 	case "systemd":
 		if m.Target == "" {
@@ -193,6 +374,65 @@ func (m *Monitor) Validate() error {
 		if m.Command == "" {
 			return fmt.Errorf("command is required for command monitor '%s'", m.Name)
 		}
+		switch m.OutputMode {
+		case OutputModeDefault:
+		case OutputModeNagios:
+			if v := m.Validations; v != nil && (v.OutputContains != "" || v.OutputNotContains != "" || v.OutputRegex != "" || v.ErrorContains != "" || len(v.JSONPath) > 0) {
+				return fmt.Errorf("output validations don't apply to nagios output mode for '%s', the plugin's exit code is the status", m.Name)
+			}
+			if m.Thresholds != nil && m.Thresholds.Value != nil {
+				return fmt.Errorf("value thresholds don't apply to nagios output mode for '%s'", m.Name)
+			}
+		default:
+			return fmt.Errorf("invalid output_mode '%s' for command monitor '%s', must be nagios or empty", m.OutputMode, m.Name)
+		}
+	case "dns":
+		if m.Query == "" {
+			return fmt.Errorf("query is required for dns monitor '%s'", m.Name)
+		}
+		if _, ok := dnsRecordTypes[strings.ToUpper(m.RecordType)]; !ok && m.RecordType != "" {
+			return fmt.Errorf("invalid record_type '%s' for dns monitor '%s', must be A, AAAA, CNAME, MX, TXT, or SRV", m.RecordType, m.Name)
+		}
+		if m.Protocol != "" && m.Protocol != "udp" && m.Protocol != "tcp" {
+			return fmt.Errorf("invalid protocol '%s' for dns monitor '%s', must be udp or tcp", m.Protocol, m.Name)
+		}
+		if m.Validations != nil && m.Validations.Rcode != "" && !slices.Contains(slices.Collect(maps.Values(dnsRcodes)), strings.ToUpper(m.Validations.Rcode)) {
+			return fmt.Errorf("invalid rcode '%s' for dns monitor '%s'", m.Validations.Rcode, m.Name)
+		}
+	case "tls":
+		if m.Host == "" {
+			return fmt.Errorf("host is required for tls monitor '%s'", m.Name)
+		}
+		if m.Port == 0 {
+			return fmt.Errorf("port is required for tls monitor '%s'", m.Name)
+		}
+		switch m.StartTLS {
+		case "", startTLSSMTP, startTLSIMAP, startTLSPOP3, startTLSPostgres:
+		default:
+			return fmt.Errorf("invalid starttls '%s' for tls monitor '%s', must be smtp, imap, pop3, or postgres", m.StartTLS, m.Name)
+		}
+		if v := m.Validations; v != nil {
+			if _, ok := tlsVersions[v.MinTLSVersion]; !ok && v.MinTLSVersion != "" {
+				return fmt.Errorf("invalid min_tls_version '%s' for tls monitor '%s', must be 1.0, 1.1, 1.2, or 1.3", v.MinTLSVersion, m.Name)
+			}
+			if v.MinKeyBits < 0 {
+				return fmt.Errorf("min_key_bits must not be negative for '%s'", m.Name)
+			}
+		}
+	case "ping":
+		if m.Host == "" {
+			return fmt.Errorf("host is required for ping monitor '%s'", m.Name)
+		}
+		if m.Count < 0 || m.Count > MaxPingCount {
+			return fmt.Errorf("count must be between 1 and %d for ping monitor '%s'", MaxPingCount, m.Name)
+		}
+	case "traceroute":
+		if m.Host == "" {
+			return fmt.Errorf("host is required for traceroute monitor '%s'", m.Name)
+		}
+		if m.MaxHops < 0 || m.MaxHops > MaxTracerouteHops {
+			return fmt.Errorf("max_hops must be between 1 and %d for traceroute monitor '%s'", MaxTracerouteHops, m.Name)
+		}
 	}
 
 	return nil
@@ -225,6 +465,9 @@ func LoadMonitors(monitorsDir string) ([]Monitor, []error) {
 		return allMonitors, nil // No files, no error
 	}
 
+	// Monitors are scheduled and run on demand by name, so names must be unique
+	seen := make(map[string]string)
+
 	// Parse each file
 	for _, file := range files {
 		monitors, err := loadMonitorFile(file)
@@ -240,6 +483,11 @@ func LoadMonitors(monitorsDir string) ([]Monitor, []error) {
 				errors = append(errors, fmt.Errorf("invalid monitor in %s: %w", filepath.Base(file), err))
 				continue
 			}
+			if other, ok := seen[monitors[i].Name]; ok {
+				errors = append(errors, fmt.Errorf("duplicate monitor name '%s' in %s, already defined in %s", monitors[i].Name, filepath.Base(file), other))
+				continue
+			}
+			seen[monitors[i].Name] = filepath.Base(file)
 			allMonitors = append(allMonitors, monitors[i])
 		}
 	}
@@ -1,6 +1,8 @@
 package monitors
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -94,6 +96,215 @@ func TestMonitorValidation(t *testing.T) {
 			wantError: true,
 			errorMsg:  "invalid priority",
 		},
+		{
+			name: "valid cron schedule",
+			monitor: Monitor{
+				Name:     "test-cron",
+				Type:     "port",
+				Port:     22,
+				Schedule: "*/10 * * * *",
+			},
+			wantError: false,
+		},
+		{
+			name: "invalid cron schedule",
+			monitor: Monitor{
+				Name:     "test-cron",
+				Type:     "http",
+				URL:      "http://example.com",
+				Schedule: "every tuesday",
+			},
+			wantError: true,
+			errorMsg:  "invalid schedule",
+		},
+		{
+			name: "interval and schedule",
+			monitor: Monitor{
+				Name:     "test-both",
+				Type:     "http",
+				URL:      "http://example.com",
+				Interval: 15,
+				Schedule: "@hourly",
+			},
+			wantError: true,
+			errorMsg:  "mutually exclusive",
+		},
+		{
+			name: "nagios output mode",
+			monitor: Monitor{
+				Name:       "test-plugin",
+				Type:       "command",
+				Command:    "/usr/lib/nagios/plugins/check_load -w 5 -c 10",
+				OutputMode: "nagios",
+			},
+			wantError: false,
+		},
+		{
+			name: "nagios output mode with output validation",
+			monitor: Monitor{
+				Name:        "test-plugin",
+				Type:        "command",
+				Command:     "/usr/lib/nagios/plugins/check_load -w 5 -c 10",
+				OutputMode:  "nagios",
+				Validations: &Validations{OutputContains: "OK"},
+			},
+			wantError: true,
+			errorMsg:  "don't apply to nagios output mode",
+		},
+		{
+			name: "invalid output mode",
+			monitor: Monitor{
+				Name:       "test-plugin",
+				Type:       "command",
+				Command:    "true",
+				OutputMode: "json",
+			},
+			wantError: true,
+			errorMsg:  "invalid output_mode",
+		},
+		{
+			name: "valid dns monitor",
+			monitor: Monitor{
+				Name:       "test-dns",
+				Type:       "dns",
+				Query:      "example.com",
+				RecordType: "mx",
+			},
+			wantError: false,
+		},
+		{
+			name: "dns monitor missing query",
+			monitor: Monitor{
+				Name: "test-dns",
+				Type: "dns",
+			},
+			wantError: true,
+			errorMsg:  "query is required",
+		},
+		{
+			name: "dns monitor invalid record type",
+			monitor: Monitor{
+				Name:       "test-dns",
+				Type:       "dns",
+				Query:      "example.com",
+				RecordType: "PTR",
+			},
+			wantError: true,
+			errorMsg:  "invalid record_type",
+		},
+		{
+			name: "valid tls monitor",
+			monitor: Monitor{
+				Name:        "test-tls",
+				Type:        "tls",
+				Host:        "mail.example.com",
+				Port:        587,
+				StartTLS:    "smtp",
+				Validations: &Validations{MinTLSVersion: "1.2", MinKeyBits: 2048},
+				Thresholds:  &Thresholds{CertExpiryDays: limits(21, 7)},
+			},
+			wantError: false,
+		},
+		{
+			name: "tls monitor missing port",
+			monitor: Monitor{
+				Name: "test-tls",
+				Type: "tls",
+				Host: "example.com",
+			},
+			wantError: true,
+			errorMsg:  "port is required",
+		},
+		{
+			name: "tls monitor invalid starttls",
+			monitor: Monitor{
+				Name:     "test-tls",
+				Type:     "tls",
+				Host:     "example.com",
+				Port:     389,
+				StartTLS: "ldap",
+			},
+			wantError: true,
+			errorMsg:  "invalid starttls",
+		},
+		{
+			name: "tls monitor invalid min_tls_version",
+			monitor: Monitor{
+				Name:        "test-tls",
+				Type:        "tls",
+				Host:        "example.com",
+				Port:        443,
+				Validations: &Validations{MinTLSVersion: "TLS1.2"},
+			},
+			wantError: true,
+			errorMsg:  "invalid min_tls_version",
+		},
+		{
+			name: "valid ping monitor",
+			monitor: Monitor{
+				Name:       "test-ping",
+				Type:       "ping",
+				Host:       "192.0.2.1",
+				Count:      10,
+				Thresholds: &Thresholds{PacketLossPercent: limits(10, 50), RTTMs: limits(100, 500)},
+			},
+			wantError: false,
+		},
+		{
+			name: "ping monitor count too high",
+			monitor: Monitor{
+				Name:  "test-ping",
+				Type:  "ping",
+				Host:  "192.0.2.1",
+				Count: 1000,
+			},
+			wantError: true,
+			errorMsg:  "count must be between 1 and 100",
+		},
+		{
+			name: "rtt threshold on a port monitor",
+			monitor: Monitor{
+				Name:       "test-port",
+				Type:       "port",
+				Port:       22,
+				Thresholds: &Thresholds{RTTMs: limits(100, 500)},
+			},
+			wantError: true,
+			errorMsg:  "only apply to ping and traceroute monitors",
+		},
+		{
+			name: "flap thresholds",
+			monitor: Monitor{
+				Name:              "test-flap",
+				Type:              "port",
+				Port:              22,
+				FlapLowThreshold:  10,
+				FlapHighThreshold: 30,
+			},
+			wantError: false,
+		},
+		{
+			name: "flap low threshold above high",
+			monitor: Monitor{
+				Name:             "test-flap",
+				Type:             "port",
+				Port:             22,
+				FlapLowThreshold: 25,
+			},
+			wantError: true,
+			errorMsg:  "flap_low_threshold must not be greater",
+		},
+		{
+			name: "negative interval",
+			monitor: Monitor{
+				Name:     "test-negative",
+				Type:     "http",
+				URL:      "http://example.com",
+				Interval: -5,
+			},
+			wantError: true,
+			errorMsg:  "interval must not be negative",
+		},
 		{
 			name: "udp with non-localhost host",
 			monitor: Monitor{
@@ -106,6 +317,101 @@ func TestMonitorValidation(t *testing.T) {
 			wantError: true,
 			errorMsg:  "udp protocol only supports localhost",
 		},
+		{
+			name: "udp with remote host and payload",
+			monitor: Monitor{
+				Name:        "test-udp-probe",
+				Type:        "port",
+				Port:        53,
+				Host:        "192.0.2.1",
+				Protocol:    "udp",
+				SendHex:     "00 00 01 00",
+				Validations: &Validations{ResponseHex: "0000"},
+			},
+			wantError: false,
+		},
+		{
+			name: "udp response validation without payload",
+			monitor: Monitor{
+				Name:        "test-udp-probe",
+				Type:        "port",
+				Port:        53,
+				Protocol:    "udp",
+				Validations: &Validations{ResponseContains: "ok"},
+			},
+			wantError: true,
+			errorMsg:  "send or send_hex is required",
+		},
+		{
+			name:      "send and send_hex",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 7, Protocol: "tcp", Send: "ping", SendHex: "00"},
+			wantError: true,
+			errorMsg:  "mutually exclusive",
+		},
+		{
+			name:      "invalid send_hex",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 7, Protocol: "tcp", SendHex: "0g"},
+			wantError: true,
+			errorMsg:  "invalid send_hex",
+		},
+		{
+			name:      "invalid response_hex",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 7, Protocol: "tcp", Validations: &Validations{ResponseHex: "abc"}},
+			wantError: true,
+			errorMsg:  "invalid response_hex",
+		},
+		{
+			name:      "valid probe",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 6379, Host: "cache.internal", Probe: "redis"},
+			wantError: false,
+		},
+		{
+			name:      "unknown probe",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 5432, Protocol: "tcp", Probe: "postgres"},
+			wantError: true,
+			errorMsg:  "invalid probe 'postgres'",
+		},
+		{
+			name:      "probe over udp",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 11211, Protocol: "udp", Probe: "memcached"},
+			wantError: true,
+			errorMsg:  "probe requires tcp",
+		},
+		{
+			name:      "valid json_path",
+			monitor:   Monitor{Name: "test-json", Type: "http", URL: "http://example.com/health", Validations: &Validations{JSONPath: []JSONAssertion{{Path: "$.status", Equals: "ok"}}}},
+			wantError: false,
+		},
+		{
+			name:      "json_path on dns monitor",
+			monitor:   Monitor{Name: "test-json", Type: "dns", Query: "example.com", Validations: &Validations{JSONPath: []JSONAssertion{{Path: "$.status", Equals: "ok"}}}},
+			wantError: true,
+			errorMsg:  "json_path validations only apply to http and command monitors",
+		},
+		{
+			name:      "invalid json_path",
+			monitor:   Monitor{Name: "test-json", Type: "command", Command: "status --json", Validations: &Validations{JSONPath: []JSONAssertion{{Path: "$.checks[db]", Equals: "ok"}}}},
+			wantError: true,
+			errorMsg:  "invalid index [db]",
+		},
+		{
+			name:      "json_path with nagios output",
+			monitor:   Monitor{Name: "test-json", Type: "command", Command: "check_thing", OutputMode: OutputModeNagios, Validations: &Validations{JSONPath: []JSONAssertion{{Path: "$.status", Equals: "ok"}}}},
+			wantError: true,
+			errorMsg:  "output validations don't apply to nagios output mode",
+		},
+		{
+			name:      "response time threshold without probe",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 22, Protocol: "tcp", Thresholds: &Thresholds{ResponseTimeMs: limits(100, 500)}},
+			wantError: true,
+			errorMsg:  "require send, send_hex or probe",
+		},
+		{
+			name:      "probe with payload",
+			monitor:   Monitor{Name: "test-probe", Type: "port", Port: 22, Protocol: "tcp", Probe: "ssh", Send: "hello"},
+			wantError: true,
+			errorMsg:  "cannot be combined",
+		},
 	}
 
 	for _, tt := range tests {
@@ -154,6 +460,9 @@ func TestApplyDefaults(t *testing.T) {
 				if m.Retries != 1 {
 					t.Errorf("expected retries 1, got %d", m.Retries)
 				}
+				if m.Interval != DefaultInterval {
+					t.Errorf("expected interval %d, got %d", DefaultInterval, m.Interval)
+				}
 				if m.Method != "GET" {
 					t.Errorf("expected method 'GET', got %q", m.Method)
 				}
@@ -168,6 +477,33 @@ func TestApplyDefaults(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "max check attempts default",
+			monitor: Monitor{
+				Name: "test",
+				Type: "port",
+				Port: 22,
+			},
+			validate: func(t *testing.T, m Monitor) {
+				if m.MaxCheckAttempts != 1 {
+					t.Errorf("expected max_check_attempts 1, got %d", m.MaxCheckAttempts)
+				}
+			},
+		},
+		{
+			name: "schedule leaves interval unset",
+			monitor: Monitor{
+				Name:     "test",
+				Type:     "port",
+				Port:     22,
+				Schedule: "@hourly",
+			},
+			validate: func(t *testing.T, m Monitor) {
+				if m.Interval != 0 {
+					t.Errorf("expected no interval with a schedule, got %d", m.Interval)
+				}
+			},
+		},
 		{
 			name: "port monitor defaults",
 			monitor: Monitor{
@@ -203,6 +539,45 @@ func TestApplyDefaults(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "tls monitor defaults",
+			monitor: Monitor{
+				Name: "test",
+				Type: "tls",
+				Host: "example.com",
+				Port: 993,
+			},
+			validate: func(t *testing.T, m Monitor) {
+				if m.VerifyTLS == nil || !*m.VerifyTLS {
+					t.Error("expected verify_tls true")
+				}
+				if m.Thresholds == nil || m.Thresholds.CertExpiryDays == nil {
+					t.Fatal("expected cert_expiry_days thresholds to be set")
+				}
+				if expiry := m.Thresholds.CertExpiryDays; *expiry.Warning != DefaultTLSExpiryWarningDays || *expiry.Critical != DefaultTLSExpiryCriticalDays {
+					t.Errorf("expected cert_expiry_days 30/7, got %v/%v", *expiry.Warning, *expiry.Critical)
+				}
+			},
+		},
+		{
+			name: "ping monitor defaults",
+			monitor: Monitor{
+				Name: "test",
+				Type: "ping",
+				Host: "192.0.2.1",
+			},
+			validate: func(t *testing.T, m Monitor) {
+				if m.Count != DefaultPingCount {
+					t.Errorf("expected count %d, got %d", DefaultPingCount, m.Count)
+				}
+				if m.Thresholds == nil || m.Thresholds.PacketLossPercent == nil {
+					t.Fatal("expected packet_loss_percent thresholds to be set")
+				}
+				if loss := m.Thresholds.PacketLossPercent; *loss.Warning != DefaultPingLossWarning || *loss.Critical != DefaultPingLossCritical {
+					t.Errorf("expected packet_loss_percent 20/60, got %v/%v", *loss.Warning, *loss.Critical)
+				}
+			},
+		},
 		{
 			name: "preserve explicit values",
 			monitor: Monitor{
@@ -253,3 +628,23 @@ func stringContains(s, substr string) bool {
 	}
 	return false
 }
+
+func TestLoadMonitors_DuplicateNames(t *testing.T) {
+	dir := t.TempDir()
+	for file, content := range map[string]string{
+		"a.yaml": "monitors:\n  - name: ssh\n    type: port\n    port: 22\n",
+		"b.yaml": "monitors:\n  - name: ssh\n    type: port\n    port: 2222\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	monitors, loadErrors := LoadMonitors(dir)
+	if len(monitors) != 1 || monitors[0].Port != 22 {
+		t.Errorf("expected the first definition to win, got %+v", monitors)
+	}
+	if len(loadErrors) != 1 || !contains(loadErrors[0].Error(), "duplicate monitor name 'ssh'") {
+		t.Errorf("expected a duplicate name error, got %v", loadErrors)
+	}
+}
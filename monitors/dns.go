@@ -0,0 +1,314 @@
+package monitors
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// resolvConfPath is read for the system resolver when a DNS monitor doesn't set one
+var resolvConfPath = "/etc/resolv.conf"
+
+// dnsUDPSize is the EDNS0 buffer size advertised in queries, the size recommended to
+// avoid fragmentation
+const dnsUDPSize = 1232
+
+// dnsRecordTypes are the record types a DNS monitor can query
+var dnsRecordTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+	"SRV":   dnsmessage.TypeSRV,
+}
+
+// dnsRcodes are the names of response codes, as shown by dig
+var dnsRcodes = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// checkDNS queries a resolver and validates the response code, answers and DNSSEC status
+func checkDNS(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
+	server, err := dnsServer(monitor.Resolver)
+	if err != nil {
+		return StatusUnknown, fmt.Sprintf("No resolver: %v", err), nil
+	}
+	fqdn := monitor.Query
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return StatusUnknown, fmt.Sprintf("Invalid query name '%s': %v", monitor.Query, err), nil
+	}
+	recordType := dnsRecordTypes[monitor.RecordType]
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(monitor.Timeout)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	response, err := queryDNS(ctx, server, monitor.Protocol, name, recordType, monitor.DNSSEC)
+	responseTime := time.Since(start)
+	if err != nil {
+		return StatusCritical, fmt.Sprintf("DNS query to %s failed: %v", server, err), nil
+	}
+
+	answers := dnsAnswers(response, recordType)
+	rtMetric := durationMetric("response_time", responseTime)
+	if monitor.Thresholds != nil {
+		rtMetric = rtMetric.withThreshold(monitor.Thresholds.ResponseTimeMs)
+	}
+	metrics := []Metric{rtMetric, {Name: "answers", Value: float64(len(answers)), Unit: unitCount}}
+	query := fmt.Sprintf("%s %s", monitor.RecordType, monitor.Query)
+
+	// Check the response code
+	rcode := dnsRcodeName(response.Header.RCode)
+	expectedRcode := "NOERROR"
+	if monitor.Validations != nil && monitor.Validations.Rcode != "" {
+		expectedRcode = strings.ToUpper(monitor.Validations.Rcode)
+	}
+	if rcode != expectedRcode {
+		return StatusCritical, fmt.Sprintf("%s returned %s (expected %s)", query, rcode, expectedRcode), metrics
+	}
+
+	// Check DNSSEC validation by the resolver
+	if monitor.DNSSEC && !response.Header.AuthenticData {
+		return StatusCritical, fmt.Sprintf("%s response is not DNSSEC validated (AD bit not set)", query), metrics
+	}
+
+	// Check expected answers, each of which must be in the response
+	if expectedRcode == "NOERROR" {
+		if len(answers) == 0 {
+			return StatusCritical, fmt.Sprintf("%s returned no %s records", query, monitor.RecordType), metrics
+		}
+		if monitor.Validations != nil {
+			for _, expected := range monitor.Validations.Answers {
+				if !slices.ContainsFunc(answers, func(answer dnsAnswer) bool { return answer.matches(expected) }) {
+					return StatusCritical, fmt.Sprintf("%s answer '%s' not found, got %s", query, expected, formatAnswers(answers)), metrics
+				}
+			}
+		}
+	}
+
+	// Check the latency threshold
+	message := fmt.Sprintf("%s returned %s", query, rcode)
+	if len(answers) > 0 {
+		message = fmt.Sprintf("%s resolved to %s", query, formatAnswers(answers))
+	}
+	if monitor.Thresholds != nil && monitor.Thresholds.ResponseTimeMs != nil {
+		ms := responseTime.Milliseconds()
+		if status := monitor.Thresholds.ResponseTimeMs.evaluate(float64(ms), false); status != StatusOK {
+			return status, fmt.Sprintf("%s, but the response took %dms", message, ms), metrics
+		}
+	}
+
+	return StatusOK, truncateOutput(message), metrics
+}
+
+// dnsAnswer is a record from the answer section, in presentation form. For MX and SRV
+// records, target is the host name alone.
+type dnsAnswer struct {
+	value  string
+	target string
+}
+
+// matches reports whether expected names this answer: the whole record, or for MX and
+// SRV records just the target host. Names compare without case or a trailing dot.
+func (a dnsAnswer) matches(expected string) bool {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s), "."))
+	}
+	expected = normalize(expected)
+	if expected == normalize(a.value) {
+		return true
+	}
+	return a.target != "" && expected == normalize(a.target)
+}
+
+func formatAnswers(answers []dnsAnswer) string {
+	values := make([]string, len(answers))
+	for i, answer := range answers {
+		values[i] = answer.value
+	}
+	return strings.Join(values, ", ")
+}
+
+// dnsAnswers returns the records of the queried type from the answer section, skipping
+// the CNAMEs a resolver includes when it follows an alias
+func dnsAnswers(response *dnsmessage.Message, recordType dnsmessage.Type) []dnsAnswer {
+	var answers []dnsAnswer
+	for _, resource := range response.Answers {
+		if resource.Header.Type != recordType {
+			continue
+		}
+		switch body := resource.Body.(type) {
+		case *dnsmessage.AResource:
+			answers = append(answers, dnsAnswer{value: netip.AddrFrom4(body.A).String()})
+		case *dnsmessage.AAAAResource:
+			answers = append(answers, dnsAnswer{value: netip.AddrFrom16(body.AAAA).String()})
+		case *dnsmessage.CNAMEResource:
+			answers = append(answers, dnsAnswer{value: body.CNAME.String()})
+		case *dnsmessage.MXResource:
+			answers = append(answers, dnsAnswer{value: fmt.Sprintf("%d %s", body.Pref, body.MX), target: body.MX.String()})
+		case *dnsmessage.TXTResource:
+			answers = append(answers, dnsAnswer{value: strings.Join(body.TXT, "")})
+		case *dnsmessage.SRVResource:
+			answers = append(answers, dnsAnswer{value: fmt.Sprintf("%d %d %d %s", body.Priority, body.Weight, body.Port, body.Target), target: body.Target.String()})
+		}
+	}
+	return answers
+}
+
+func dnsRcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := dnsRcodes[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// dnsServer returns the resolver address to query: the configured one, with port 53 if
+// it has none, or the first nameserver in resolv.conf
+func dnsServer(resolver string) (string, error) {
+	if resolver != "" {
+		if _, _, err := net.SplitHostPort(resolver); err == nil {
+			return resolver, nil
+		}
+		return net.JoinHostPort(strings.Trim(resolver, "[]"), "53"), nil
+	}
+
+	file, err := os.Open(resolvConfPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no nameserver in %s", resolvConfPath)
+}
+
+// queryDNS sends a recursive query to server and returns the response. UDP responses
+// that are truncated are retried over TCP.
+func queryDNS(ctx context.Context, server, protocol string, name dnsmessage.Name, recordType dnsmessage.Type, dnssec bool) (*dnsmessage.Message, error) {
+	id := uint16(rand.N(1 << 16))
+	query, err := buildDNSQuery(id, name, recordType, dnssec)
+	if err != nil {
+		return nil, err
+	}
+
+	if protocol != "tcp" {
+		response, err := exchangeDNS(ctx, "udp", server, id, query)
+		if err != nil || !response.Header.Truncated {
+			return response, err
+		}
+	}
+	return exchangeDNS(ctx, "tcp", server, id, query)
+}
+
+// buildDNSQuery packs a query with an EDNS0 record; with dnssec the DO and AD bits ask
+// the resolver to validate the answer and say so
+func buildDNSQuery(id uint16, name dnsmessage.Name, recordType dnsmessage.Type, dnssec bool) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true, AuthenticData: dnssec})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: recordType, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(dnsUDPSize, dnsmessage.RCodeSuccess, dnssec); err != nil {
+		return nil, err
+	}
+	if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+func exchangeDNS(ctx context.Context, network, server string, id uint16, query []byte) (*dnsmessage.Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		// Messages over TCP are prefixed with their length
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+			return nil, err
+		}
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		packet := make([]byte, length)
+		if _, err := io.ReadFull(conn, packet); err != nil {
+			return nil, err
+		}
+		return unpackDNSResponse(packet, id)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	// Ignore stray datagrams, such as a late answer to an earlier query, until the deadline
+	packet := make([]byte, dnsUDPSize)
+	for {
+		n, err := conn.Read(packet)
+		if err != nil {
+			return nil, err
+		}
+		response, err := unpackDNSResponse(packet[:n], id)
+		if errors.Is(err, errDNSMismatch) {
+			continue
+		}
+		return response, err
+	}
+}
+
+// errDNSMismatch is returned for a response to a different query
+var errDNSMismatch = errors.New("response does not match the query")
+
+func unpackDNSResponse(packet []byte, id uint16) (*dnsmessage.Message, error) {
+	var response dnsmessage.Message
+	if err := response.Unpack(packet); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if response.Header.ID != id || !response.Header.Response {
+		return nil, errDNSMismatch
+	}
+	return &response, nil
+}
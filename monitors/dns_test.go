@@ -0,0 +1,241 @@
+package monitors
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSServer answers queries over UDP and TCP on the same port from a fixed zone
+type testDNSServer struct {
+	addr    string
+	records map[string][]dnsmessage.Resource // keyed by "name type", e.g. "example.com. A"
+	// authenticated sets the AD bit on answers to queries that ask for DNSSEC
+	authenticated bool
+	// truncateUDP answers every UDP query with only the TC bit, forcing a retry over TCP
+	truncateUDP bool
+	delay       time.Duration
+}
+
+func startDNSServer(t *testing.T, server *testDNSServer) *testDNSServer {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Skipf("TCP port %s unavailable: %v", udp.LocalAddr(), err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+	server.addr = udp.LocalAddr().String()
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := server.answer(buf[:n], server.truncateUDP); response != nil {
+				udp.WriteTo(response, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length uint16
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					return
+				}
+				query := make([]byte, length)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				response := server.answer(query, false)
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+			}()
+		}
+	}()
+	return server
+}
+
+func (s *testDNSServer) answer(query []byte, truncate bool) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		return nil
+	}
+	time.Sleep(s.delay)
+	question := msg.Questions[0]
+	header := dnsmessage.Header{ID: msg.Header.ID, Response: true, RecursionDesired: true, RecursionAvailable: true}
+	response := dnsmessage.Message{Header: header, Questions: msg.Questions}
+	if truncate {
+		response.Header.Truncated = true
+	} else {
+		records, ok := s.records[question.Name.String()+" "+strings.TrimPrefix(question.Type.String(), "Type")]
+		if !ok && !s.hasName(question.Name.String()) {
+			response.Header.RCode = dnsmessage.RCodeNameError
+		}
+		// Pack writes each header's length, so answer from a copy the UDP and TCP
+		// handlers don't share
+		response.Answers = slices.Clone(records)
+		response.Header.AuthenticData = s.authenticated && msg.Header.AuthenticData
+	}
+	packed, err := response.Pack()
+	if err != nil {
+		return nil
+	}
+	return packed
+}
+
+func (s *testDNSServer) hasName(name string) bool {
+	for key := range s.records {
+		if strings.HasPrefix(key, name+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func dnsRecord(name string, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 300},
+		Body:   body,
+	}
+}
+
+func testZone() map[string][]dnsmessage.Resource {
+	return map[string][]dnsmessage.Resource{
+		"example.com. A": {
+			dnsRecord("example.com.", &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}}),
+			dnsRecord("example.com.", &dnsmessage.AResource{A: [4]byte{192, 0, 2, 11}}),
+		},
+		"example.com. AAAA": {
+			dnsRecord("example.com.", &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}),
+		},
+		"example.com. MX": {
+			dnsRecord("example.com.", &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")}),
+		},
+		"example.com. TXT": {
+			dnsRecord("example.com.", &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}}),
+		},
+		"www.example.com. CNAME": {
+			dnsRecord("www.example.com.", &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("example.com.")}),
+		},
+		"_sip._tcp.example.com. SRV": {
+			dnsRecord("_sip._tcp.example.com.", &dnsmessage.SRVResource{Priority: 10, Weight: 5, Port: 5060, Target: dnsmessage.MustNewName("sip.example.com.")}),
+		},
+	}
+}
+
+func TestCheckDNS(t *testing.T) {
+	server := startDNSServer(t, &testDNSServer{records: testZone()})
+
+	tests := []struct {
+		name        string
+		monitor     Monitor
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "A records", monitor: Monitor{Query: "example.com", Validations: &Validations{Answers: []string{"192.0.2.11"}}}, want: StatusOK, wantMessage: "192.0.2.10, 192.0.2.11"},
+		{name: "AAAA record", monitor: Monitor{Query: "example.com", RecordType: "aaaa", Validations: &Validations{Answers: []string{"2001:db8::1"}}}, want: StatusOK},
+		{name: "MX target", monitor: Monitor{Query: "example.com", RecordType: "MX", Validations: &Validations{Answers: []string{"mail.example.com"}}}, want: StatusOK, wantMessage: "10 mail.example.com."},
+		{name: "TXT record", monitor: Monitor{Query: "example.com", RecordType: "TXT", Validations: &Validations{Answers: []string{"v=spf1 -all"}}}, want: StatusOK},
+		{name: "CNAME record", monitor: Monitor{Query: "www.example.com.", RecordType: "CNAME", Validations: &Validations{Answers: []string{"EXAMPLE.COM."}}}, want: StatusOK},
+		{name: "SRV record", monitor: Monitor{Query: "_sip._tcp.example.com", RecordType: "SRV", Validations: &Validations{Answers: []string{"10 5 5060 sip.example.com"}}}, want: StatusOK},
+		{name: "unexpected answer", monitor: Monitor{Query: "example.com", Validations: &Validations{Answers: []string{"192.0.2.99"}}}, want: StatusCritical, wantMessage: "answer '192.0.2.99' not found"},
+		{name: "no records of type", monitor: Monitor{Query: "www.example.com", RecordType: "MX"}, want: StatusCritical, wantMessage: "no MX records"},
+		{name: "nxdomain", monitor: Monitor{Query: "missing.example.com"}, want: StatusCritical, wantMessage: "returned NXDOMAIN (expected NOERROR)"},
+		{name: "expected nxdomain", monitor: Monitor{Query: "missing.example.com", Validations: &Validations{Rcode: "nxdomain"}}, want: StatusOK},
+		{name: "dnssec not validated", monitor: Monitor{Query: "example.com", DNSSEC: true}, want: StatusCritical, wantMessage: "AD bit not set"},
+		{name: "over tcp", monitor: Monitor{Query: "example.com", Protocol: "tcp"}, want: StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := tt.monitor
+			monitor.Name, monitor.Type, monitor.Resolver = "dns", "dns", server.addr
+			monitor.ApplyDefaults()
+			if err := monitor.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			status, message, metrics := checkDNS(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkDNS() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+			if len(metrics) != 2 || metrics[0].Name != "response_time" {
+				t.Errorf("unexpected metrics: %+v", metrics)
+			}
+		})
+	}
+}
+
+func TestCheckDNS_Resolver(t *testing.T) {
+	tests := []struct {
+		name   string
+		server *testDNSServer
+		thresh *Thresholds
+		dnssec bool
+		want   MonitorStatus
+	}{
+		{name: "dnssec validated", server: &testDNSServer{records: testZone(), authenticated: true}, dnssec: true, want: StatusOK},
+		{name: "truncated udp retried over tcp", server: &testDNSServer{records: testZone(), truncateUDP: true}, want: StatusOK},
+		{name: "slow resolver", server: &testDNSServer{records: testZone(), delay: 30 * time.Millisecond}, thresh: &Thresholds{ResponseTimeMs: limits(20, 1000)}, want: StatusWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startDNSServer(t, tt.server)
+			monitor := Monitor{Name: "dns", Type: "dns", Query: "example.com", Resolver: server.addr, DNSSEC: tt.dnssec, Thresholds: tt.thresh}
+			monitor.ApplyDefaults()
+			if status, message, _ := checkDNS(context.Background(), monitor); status != tt.want {
+				t.Errorf("checkDNS() = %s %q, want %s", status, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSServer(t *testing.T) {
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	if err := os.WriteFile(resolvConf, []byte("# generated\nsearch example.com\nnameserver 2001:db8::53\nnameserver 192.0.2.53\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous := resolvConfPath
+	resolvConfPath = resolvConf
+	defer func() { resolvConfPath = previous }()
+
+	tests := []struct {
+		resolver string
+		want     string
+	}{
+		{resolver: "", want: "[2001:db8::53]:53"},
+		{resolver: "1.1.1.1", want: "1.1.1.1:53"},
+		{resolver: "127.0.0.1:5353", want: "127.0.0.1:5353"},
+		{resolver: "[::1]", want: "[::1]:53"},
+		{resolver: "::1", want: "[::1]:53"},
+	}
+	for _, tt := range tests {
+		if got, err := dnsServer(tt.resolver); err != nil || got != tt.want {
+			t.Errorf("dnsServer(%q) = %q, %v, want %q", tt.resolver, got, err, tt.want)
+		}
+	}
+}
@@ -1,17 +1,20 @@
 package monitors
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"regexp"
 	"strings"
 	"time"
 )
 
 // checkHTTP performs an HTTP/HTTPS check
-func checkHTTP(monitor Monitor) (MonitorStatus, string) {
+func checkHTTP(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
 	// Create HTTP client with custom settings
 	client := &http.Client{
 		Timeout: time.Duration(monitor.Timeout) * time.Second,
@@ -23,20 +26,21 @@ func checkHTTP(monitor Monitor) (MonitorStatus, string) {
 		},
 	}
 
+	// A fresh connection for every check, so the connect and TLS timings are measured
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
 	// Configure TLS verification
 	if strings.HasPrefix(strings.ToLower(monitor.URL), "https://") {
-		transport := &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: !*monitor.VerifyTLS,
-			},
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: !*monitor.VerifyTLS,
 		}
-		client.Transport = transport
 	}
+	client.Transport = transport
 
 	// Create request
-	req, err := http.NewRequest(monitor.Method, monitor.URL, strings.NewReader(monitor.Body))
+	req, err := http.NewRequestWithContext(ctx, monitor.Method, monitor.URL, strings.NewReader(monitor.Body))
 	if err != nil {
-		return StatusUnknown, fmt.Sprintf("Failed to create request: %v", err)
+		return StatusUnknown, fmt.Sprintf("Failed to create request: %v", err), nil
 	}
 
 	// Add custom headers
@@ -45,18 +49,32 @@ func checkHTTP(monitor Monitor) (MonitorStatus, string) {
 	}
 
 	// Execute request
+	timings := &httpTimings{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timings.trace()))
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return StatusCritical, fmt.Sprintf("Request failed: %v", err)
+		return StatusCritical, fmt.Sprintf("Request failed: %v", err), nil
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return StatusUnknown, fmt.Sprintf("Failed to read response body: %v", err)
+		return StatusUnknown, fmt.Sprintf("Failed to read response body: %v", err), nil
 	}
 	body := string(bodyBytes)
+	responseTime := time.Since(start)
+	metrics := timings.metrics(responseTime, monitor.Thresholds)
+	metrics = append(metrics, Metric{Name: "response_size", Value: float64(len(bodyBytes)), Unit: unitBytes})
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		days := float64(int(time.Until(resp.TLS.PeerCertificates[0].NotAfter).Hours() / 24))
+		metric := Metric{Name: "cert_days_remaining", Value: days, Unit: unitDays}
+		if monitor.Thresholds != nil {
+			metric = metric.withThreshold(monitor.Thresholds.CertExpiryDays)
+		}
+		metrics = append(metrics, metric)
+	}
 
 	// Check status code
 	validStatus := false
@@ -68,13 +86,13 @@ func checkHTTP(monitor Monitor) (MonitorStatus, string) {
 	}
 
 	if !validStatus {
-		return StatusCritical, fmt.Sprintf("Unexpected status code: %d (expected %v)", resp.StatusCode, monitor.Validations.StatusCodes)
+		return StatusCritical, fmt.Sprintf("Unexpected status code: %d (expected %v)", resp.StatusCode, monitor.Validations.StatusCodes), metrics
 	}
 
 	// Check body content if specified
 	if monitor.Validations.BodyContains != "" {
 		if !strings.Contains(body, monitor.Validations.BodyContains) {
-			return StatusCritical, fmt.Sprintf("Response body does not contain expected string: '%s'", monitor.Validations.BodyContains)
+			return StatusCritical, fmt.Sprintf("Response body does not contain expected string: '%s'", monitor.Validations.BodyContains), metrics
 		}
 	}
 
@@ -82,29 +100,105 @@ func checkHTTP(monitor Monitor) (MonitorStatus, string) {
 	if monitor.Validations.BodyRegex != "" {
 		matched, err := regexp.MatchString(monitor.Validations.BodyRegex, body)
 		if err != nil {
-			return StatusUnknown, fmt.Sprintf("Invalid regex pattern: %v", err)
+			return StatusUnknown, fmt.Sprintf("Invalid regex pattern: %v", err), metrics
 		}
 		if !matched {
-			return StatusCritical, fmt.Sprintf("Response body does not match regex: '%s'", monitor.Validations.BodyRegex)
+			return StatusCritical, fmt.Sprintf("Response body does not match regex: '%s'", monitor.Validations.BodyRegex), metrics
+		}
+	}
+
+	// Check JSON assertions if specified
+	if len(monitor.Validations.JSONPath) > 0 {
+		if err := checkJSONAssertions(body, monitor.Validations.JSONPath); errors.Is(err, errInvalidJSON) {
+			return StatusCritical, fmt.Sprintf("Response body is %v", err), metrics
+		} else if err != nil {
+			return StatusCritical, fmt.Sprintf("Response body JSON assertion failed: %v", err), metrics
 		}
 	}
 
-	// Check certificate expiry if HTTPS and verification enabled
-	if strings.HasPrefix(strings.ToLower(monitor.URL), "https://") && *monitor.VerifyTLS && monitor.Validations.CertExpiryDays > 0 {
+	// Check certificate expiry if HTTPS and verification enabled, unless thresholds replace it
+	thresholds := monitor.Thresholds
+	if thresholds == nil {
+		thresholds = &Thresholds{}
+	}
+	if strings.HasPrefix(strings.ToLower(monitor.URL), "https://") && *monitor.VerifyTLS && monitor.Validations.CertExpiryDays > 0 && thresholds.CertExpiryDays == nil {
 		if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
 			cert := resp.TLS.PeerCertificates[0]
 			daysUntilExpiry := int(time.Until(cert.NotAfter).Hours() / 24)
 
 			if daysUntilExpiry < 0 {
-				return StatusCritical, fmt.Sprintf("Certificate expired %d days ago", -daysUntilExpiry)
+				return StatusCritical, fmt.Sprintf("Certificate expired %d days ago", -daysUntilExpiry), metrics
 			}
 
 			if daysUntilExpiry <= monitor.Validations.CertExpiryDays {
-				return StatusWarning, fmt.Sprintf("Certificate expires in %d days", daysUntilExpiry)
+				return StatusWarning, fmt.Sprintf("Certificate expires in %d days", daysUntilExpiry), metrics
 			}
 		}
 	}
 
-	// All checks passed
-	return StatusOK, fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	// Check warning/critical thresholds
+	status := StatusOK
+	var exceeded []string
+	if thresholds.CertExpiryDays != nil && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		daysUntilExpiry := int(time.Until(resp.TLS.PeerCertificates[0].NotAfter).Hours() / 24)
+		if certStatus := thresholds.CertExpiryDays.evaluate(float64(daysUntilExpiry), true); certStatus != StatusOK {
+			status = worseStatus(status, certStatus)
+			exceeded = append(exceeded, fmt.Sprintf("certificate expires in %d days", daysUntilExpiry))
+		}
+	}
+	if thresholds.ResponseTimeMs != nil {
+		ms := responseTime.Milliseconds()
+		if timeStatus := thresholds.ResponseTimeMs.evaluate(float64(ms), false); timeStatus != StatusOK {
+			status = worseStatus(status, timeStatus)
+			exceeded = append(exceeded, fmt.Sprintf("response took %dms", ms))
+		}
+	}
+
+	message := fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	if len(exceeded) > 0 {
+		message = fmt.Sprintf("%s, but %s", message, strings.Join(exceeded, " and "))
+	}
+	return status, message, metrics
+}
+
+// httpTimings records when each phase of a request started and finished
+type httpTimings struct {
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+}
+
+func (t *httpTimings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { t.connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { t.connectDone = time.Now() },
+		TLSHandshakeStart:    func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.tlsDone = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { t.firstByte = time.Now() },
+	}
+}
+
+// metrics returns the duration of each phase that happened, and the total response time.
+// With redirects followed, the phases are those of the last request.
+func (t *httpTimings) metrics(total time.Duration, thresholds *Thresholds) []Metric {
+	var metrics []Metric
+	phase := func(name string, start, end time.Time) {
+		if !start.IsZero() && !end.IsZero() {
+			metrics = append(metrics, durationMetric(name, end.Sub(start)))
+		}
+	}
+	phase("dns_time", t.dnsStart, t.dnsDone)
+	phase("connect_time", t.connectStart, t.connectDone)
+	phase("tls_time", t.tlsStart, t.tlsDone)
+	phase("ttfb", t.wroteRequest, t.firstByte)
+
+	responseTime := durationMetric("response_time", total)
+	if thresholds != nil {
+		responseTime = responseTime.withThreshold(thresholds.ResponseTimeMs)
+	}
+	return append(metrics, responseTime)
 }
@@ -0,0 +1,222 @@
+package monitors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSONAssertion checks one value in a JSON document, selected by a path such as
+// $.checks.db.status, .items[0].id or $["key.with.dots"]. Every operator set must hold.
+type JSONAssertion struct {
+	Path        string   `yaml:"path" json:"path"`
+	Equals      any      `yaml:"equals" json:"equals,omitempty"`
+	Exists      *bool    `yaml:"exists" json:"exists,omitempty"` // false asserts the path is absent
+	GreaterThan *float64 `yaml:"greater_than" json:"greater_than,omitempty"`
+	LessThan    *float64 `yaml:"less_than" json:"less_than,omitempty"`
+	Matches     string   `yaml:"matches" json:"matches,omitempty"` // regex, against the text of non-string values
+}
+
+// errInvalidJSON is returned by checkJSONAssertions when there is no document to check
+var errInvalidJSON = errors.New("not valid JSON")
+
+// pathSegment is an object key or, if isIndex, an array index (negative counts from the end)
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath splits a path into segments. The leading $ or . is optional, so
+// "status.code", ".status.code" and "$.status.code" are the same path.
+func parseJSONPath(path string) ([]pathSegment, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+	var segments []pathSegment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				if rest == "" && segments == nil {
+					return nil, nil // "." is the whole document
+				}
+				return nil, fmt.Errorf("empty key in path '%s'", path)
+			}
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed [ in path '%s'", path)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index [%s] in path '%s'", inner, path)
+			}
+			segments = append(segments, pathSegment{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("unexpected '%c' in path '%s'", rest[0], path)
+		}
+	}
+	return segments, nil
+}
+
+// lookupJSONPath returns the value at the path, and whether it exists
+func lookupJSONPath(doc any, segments []pathSegment) (any, bool) {
+	value := doc
+	for _, segment := range segments {
+		if segment.isIndex {
+			array, ok := value.([]any)
+			if !ok {
+				return nil, false
+			}
+			index := segment.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index < 0 || index >= len(array) {
+				return nil, false
+			}
+			value = array[index]
+			continue
+		}
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[segment.key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// validate checks that the path parses and that the operators make sense together
+func (a JSONAssertion) validate() error {
+	if _, err := parseJSONPath(a.Path); err != nil {
+		return err
+	}
+	if a.Equals == nil && a.Exists == nil && a.GreaterThan == nil && a.LessThan == nil && a.Matches == "" {
+		return fmt.Errorf("json_path '%s' needs equals, exists, greater_than, less_than, or matches", a.Path)
+	}
+	if a.Exists != nil && !*a.Exists && (a.Equals != nil || a.GreaterThan != nil || a.LessThan != nil || a.Matches != "") {
+		return fmt.Errorf("json_path '%s' can't check the value of a path that must not exist", a.Path)
+	}
+	if a.Matches != "" {
+		if _, err := regexp.Compile(a.Matches); err != nil {
+			return fmt.Errorf("invalid matches regex for json_path '%s': %w", a.Path, err)
+		}
+	}
+	return nil
+}
+
+// check returns an error naming the path if the document fails the assertion
+func (a JSONAssertion) check(doc any) error {
+	segments, err := parseJSONPath(a.Path)
+	if err != nil {
+		return err
+	}
+	value, exists := lookupJSONPath(doc, segments)
+	if a.Exists != nil && !*a.Exists {
+		if exists {
+			return fmt.Errorf("%s is %s, expected it not to exist", a.Path, formatJSON(value))
+		}
+		return nil
+	}
+	if !exists {
+		return fmt.Errorf("%s does not exist", a.Path)
+	}
+
+	if a.Equals != nil {
+		// Compare as JSON, so YAML's ints and maps match the decoded document
+		expected, err := normalizeJSON(a.Equals)
+		if err != nil {
+			return fmt.Errorf("invalid equals value for %s: %w", a.Path, err)
+		}
+		if !reflect.DeepEqual(value, expected) {
+			return fmt.Errorf("%s is %s, expected %s", a.Path, formatJSON(value), formatJSON(expected))
+		}
+	}
+	if a.GreaterThan != nil || a.LessThan != nil {
+		number, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s is %s, expected a number", a.Path, formatJSON(value))
+		}
+		if a.GreaterThan != nil && number <= *a.GreaterThan {
+			return fmt.Errorf("%s is %s, expected greater than %s", a.Path, formatValue(number), formatValue(*a.GreaterThan))
+		}
+		if a.LessThan != nil && number >= *a.LessThan {
+			return fmt.Errorf("%s is %s, expected less than %s", a.Path, formatValue(number), formatValue(*a.LessThan))
+		}
+	}
+	if a.Matches != "" {
+		text, ok := value.(string)
+		if !ok {
+			text = formatJSON(value)
+		}
+		matched, err := regexp.MatchString(a.Matches, text)
+		if err != nil {
+			return fmt.Errorf("invalid matches regex for %s: %w", a.Path, err)
+		}
+		if !matched {
+			return fmt.Errorf("%s is %s, expected to match '%s'", a.Path, formatJSON(value), a.Matches)
+		}
+	}
+	return nil
+}
+
+// checkJSONAssertions parses data as JSON and checks every assertion, reporting all
+// that fail. It returns errInvalidJSON, wrapped, if data doesn't parse.
+func checkJSONAssertions(data string, assertions []JSONAssertion) error {
+	var doc any
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidJSON, err)
+	}
+	var failures []string
+	for _, assertion := range assertions {
+		if err := assertion.check(doc); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// normalizeJSON round trips a value through JSON, giving the types json.Unmarshal produces
+func normalizeJSON(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized any
+	err = json.Unmarshal(data, &normalized)
+	return normalized, err
+}
+
+// formatJSON renders a value for a failure message
+func formatJSON(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return truncateOutput(string(data))
+}
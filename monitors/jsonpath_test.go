@@ -0,0 +1,207 @@
+package monitors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []pathSegment
+		wantErr bool
+	}{
+		{path: "$", want: nil},
+		{path: ".", want: nil},
+		{path: "$.status", want: []pathSegment{{key: "status"}}},
+		{path: ".checks.db", want: []pathSegment{{key: "checks"}, {key: "db"}}},
+		{path: "checks.db", want: []pathSegment{{key: "checks"}, {key: "db"}}},
+		{path: "$.items[0].id", want: []pathSegment{{key: "items"}, {index: 0, isIndex: true}, {key: "id"}}},
+		{path: ".items[-1]", want: []pathSegment{{key: "items"}, {index: -1, isIndex: true}}},
+		{path: `$["key.with.dots"]['x']`, want: []pathSegment{{key: "key.with.dots"}, {key: "x"}}},
+		{path: "[2][0]", want: []pathSegment{{index: 2, isIndex: true}, {index: 0, isIndex: true}}},
+		{path: "$.a..b", wantErr: true},
+		{path: "$.a.", wantErr: true},
+		{path: "$.items[0", wantErr: true},
+		{path: "$.items[first]", wantErr: true},
+		{path: "$.items[0]x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONPath() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// assertionsFromYAML decodes assertions as a monitor file would, so equals gets YAML's types
+func assertionsFromYAML(t *testing.T, data string) []JSONAssertion {
+	t.Helper()
+	var assertions []JSONAssertion
+	if err := yaml.Unmarshal([]byte(data), &assertions); err != nil {
+		t.Fatal(err)
+	}
+	for _, assertion := range assertions {
+		if err := assertion.validate(); err != nil {
+			t.Fatalf("validate() error = %v", err)
+		}
+	}
+	return assertions
+}
+
+func TestCheckJSONAssertions(t *testing.T) {
+	doc := `{
+		"status": "ok",
+		"version": "2.4.1",
+		"uptime": 3600,
+		"ready": true,
+		"checks": {"db": {"status": "ok", "latency_ms": 12.5}, "cache": {"status": "degraded"}},
+		"replicas": [{"name": "a", "lag": 0}, {"name": "b", "lag": 30}],
+		"labels": {"env": "prod", "tier": 1},
+		"maintenance": null
+	}`
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "equals string", yaml: `[{path: $.status, equals: ok}]`},
+		{name: "equals number", yaml: `[{path: .uptime, equals: 3600}]`},
+		{name: "equals bool", yaml: `[{path: .ready, equals: true}]`},
+		{name: "equals object", yaml: `[{path: .labels, equals: {tier: 1, env: prod}}]`},
+		{name: "exists", yaml: `[{path: .checks.db.latency_ms, exists: true}]`},
+		{name: "exists null", yaml: `[{path: .maintenance, exists: true}]`},
+		{name: "not exists", yaml: `[{path: .checks.queue, exists: false}]`},
+		{name: "greater than", yaml: `[{path: .uptime, greater_than: 60}]`},
+		{name: "between", yaml: `[{path: .checks.db.latency_ms, greater_than: 0, less_than: 100}]`},
+		{name: "matches", yaml: `[{path: .version, matches: '^2\.'}]`},
+		{name: "matches number", yaml: `[{path: '.replicas[-1].lag', matches: '^\d+$'}]`},
+		{name: "array index", yaml: `[{path: '.replicas[1].name', equals: b}]`},
+		{name: "wrong value", yaml: `[{path: .checks.cache.status, equals: ok}]`, wantErr: `.checks.cache.status is "degraded", expected "ok"`},
+		{name: "wrong type", yaml: `[{path: .uptime, equals: "3600"}]`, wantErr: `.uptime is 3600, expected "3600"`},
+		{name: "missing", yaml: `[{path: .checks.queue.status, equals: ok}]`, wantErr: ".checks.queue.status does not exist"},
+		{name: "index out of range", yaml: `[{path: '.replicas[2]', exists: true}]`, wantErr: ".replicas[2] does not exist"},
+		{name: "should not exist", yaml: `[{path: .checks.cache, exists: false}]`, wantErr: `.checks.cache is {"status":"degraded"}, expected it not to exist`},
+		{name: "too low", yaml: `[{path: '$.replicas[1].lag', less_than: 10}]`, wantErr: "$.replicas[1].lag is 30, expected less than 10"},
+		{name: "not greater", yaml: `[{path: .uptime, greater_than: 3600}]`, wantErr: ".uptime is 3600, expected greater than 3600"},
+		{name: "not a number", yaml: `[{path: .version, greater_than: 1}]`, wantErr: `.version is "2.4.1", expected a number`},
+		{name: "no match", yaml: `[{path: .version, matches: '^3\.'}]`, wantErr: `.version is "2.4.1", expected to match '^3\.'`},
+		{
+			name:    "reports every failure",
+			yaml:    `[{path: .status, equals: ok}, {path: .checks.cache.status, equals: ok}, {path: .uptime, less_than: 60}]`,
+			wantErr: `.checks.cache.status is "degraded", expected "ok"; .uptime is 3600, expected less than 60`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJSONAssertions(doc, assertionsFromYAML(t, tt.yaml))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkJSONAssertions() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkJSONAssertions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJSONAssertion_Validate(t *testing.T) {
+	notExists := false
+	threshold := 1.0
+	tests := []struct {
+		name      string
+		assertion JSONAssertion
+		wantErr   string
+	}{
+		{name: "no operator", assertion: JSONAssertion{Path: ".status"}, wantErr: "needs equals"},
+		{name: "invalid path", assertion: JSONAssertion{Path: ".items[", Equals: 1}, wantErr: "unclosed ["},
+		{name: "invalid regex", assertion: JSONAssertion{Path: ".status", Matches: "("}, wantErr: "invalid matches regex"},
+		{name: "absent with value", assertion: JSONAssertion{Path: ".status", Exists: &notExists, GreaterThan: &threshold}, wantErr: "must not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.assertion.validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckHTTP_JSONPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/text" {
+			w.Write([]byte("OK"))
+			return
+		}
+		w.Write([]byte(`{"status": "degraded", "checks": {"db": "ok"}}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		assertions  []JSONAssertion
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "passes", path: "/health", assertions: []JSONAssertion{{Path: "$.checks.db", Equals: "ok"}}, want: StatusOK, wantMessage: "200 OK"},
+		{name: "fails", path: "/health", assertions: []JSONAssertion{{Path: "$.status", Equals: "ok"}}, want: StatusCritical, wantMessage: `Response body JSON assertion failed: $.status is "degraded", expected "ok"`},
+		{name: "not json", path: "/text", assertions: []JSONAssertion{{Path: "$.status", Equals: "ok"}}, want: StatusCritical, wantMessage: "Response body is not valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := Monitor{Name: "health", Type: "http", URL: server.URL + tt.path, Validations: &Validations{JSONPath: tt.assertions}}
+			monitor.ApplyDefaults()
+			status, message, _ := checkHTTP(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkHTTP() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestCheckCommand_JSONPath(t *testing.T) {
+	minimum := 100.0
+	tests := []struct {
+		name        string
+		command     string
+		assertions  []JSONAssertion
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "passes", command: `echo '{"queue": {"depth": 250}}'`, assertions: []JSONAssertion{{Path: ".queue.depth", GreaterThan: &minimum}}, want: StatusOK},
+		{name: "fails", command: `echo '{"queue": {"depth": 5}}'`, assertions: []JSONAssertion{{Path: ".queue.depth", GreaterThan: &minimum}}, want: StatusCritical, wantMessage: "Output JSON assertion failed: .queue.depth is 5, expected greater than 100"},
+		{name: "not json", command: "echo done", assertions: []JSONAssertion{{Path: ".queue", Equals: "x"}}, want: StatusCritical, wantMessage: "Output is not valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := Monitor{Name: "queue", Type: "command", Command: tt.command, Validations: &Validations{JSONPath: tt.assertions}}
+			monitor.ApplyDefaults()
+			status, message, _ := checkCommand(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkCommand() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+		})
+	}
+}
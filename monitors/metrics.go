@@ -0,0 +1,37 @@
+package monitors
+
+import "time"
+
+// Metric is a value measured by a check, in the shape of Nagios perfdata, so the server
+// can graph it rather than parse it out of the message
+type Metric struct {
+	Name  string   `json:"name"`
+	Value float64  `json:"value"`
+	Unit  string   `json:"unit,omitempty"`
+	Warn  *float64 `json:"warn,omitempty"`
+	Crit  *float64 `json:"crit,omitempty"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
+
+// Metric units used by the built-in checks
+const (
+	unitMilliseconds = "ms"
+	unitBytes        = "B"
+	unitDays         = "d"
+	unitCount        = "c"
+	unitPercent      = "%"
+)
+
+// durationMetric reports d in milliseconds, keeping sub-millisecond precision
+func durationMetric(name string, d time.Duration) Metric {
+	return Metric{Name: name, Value: float64(d.Microseconds()) / 1000, Unit: unitMilliseconds}
+}
+
+// withThreshold sets the metric's warn and crit from a threshold pair, if there is one
+func (m Metric) withThreshold(threshold *Threshold) Metric {
+	if threshold != nil {
+		m.Warn, m.Crit = threshold.Warning, threshold.Critical
+	}
+	return m
+}
@@ -0,0 +1,71 @@
+package monitors
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func metricsByName(metrics []Metric) map[string]Metric {
+	byName := make(map[string]Metric, len(metrics))
+	for _, metric := range metrics {
+		byName[metric.Name] = metric
+	}
+	return byName
+}
+
+func TestCheckHTTP_Metrics(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+
+	verifyTLS := false
+	monitor := Monitor{Name: "web", Type: "http", URL: server.URL, VerifyTLS: &verifyTLS, Thresholds: &Thresholds{ResponseTimeMs: limits(500, 2000)}}
+	monitor.ApplyDefaults()
+	status, message, metrics := checkHTTP(context.Background(), monitor)
+	if status != StatusOK {
+		t.Fatalf("checkHTTP() = %s %q", status, message)
+	}
+
+	byName := metricsByName(metrics)
+	for _, name := range []string{"connect_time", "tls_time", "ttfb", "response_time"} {
+		if metric, ok := byName[name]; !ok || metric.Unit != unitMilliseconds || metric.Value < 0 {
+			t.Errorf("%s = %+v, want a duration in ms", name, metric)
+		}
+	}
+	if size := byName["response_size"]; size.Value != 11 || size.Unit != unitBytes {
+		t.Errorf("response_size = %+v, want 11 B", size)
+	}
+	if days, ok := byName["cert_days_remaining"]; !ok || days.Value <= 0 {
+		t.Errorf("cert_days_remaining = %+v", days)
+	}
+	if rt := byName["response_time"]; rt.Warn == nil || *rt.Warn != 500 || rt.Crit == nil || *rt.Crit != 2000 {
+		t.Errorf("expected the response time thresholds on the metric, got %+v", rt)
+	}
+}
+
+func TestCheckTCPPort_ConnectTime(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	monitor := Monitor{Name: "tcp", Type: "port", Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port}
+	monitor.ApplyDefaults()
+	status, _, metrics := checkPort(context.Background(), monitor)
+	if status != StatusOK || len(metrics) != 1 || metrics[0].Name != "connect_time" {
+		t.Errorf("checkPort() = %s %+v, want a connect_time metric", status, metrics)
+	}
+}
+
+func TestCheckCommand_ValueMetric(t *testing.T) {
+	monitor := Monitor{Name: "disk", Type: "command", Command: "echo 42", Thresholds: &Thresholds{Value: limits(80, 90)}}
+	monitor.ApplyDefaults()
+	_, _, metrics := checkCommand(context.Background(), monitor)
+	if len(metrics) != 1 || metrics[0].Value != 42 || *metrics[0].Warn != 80 || *metrics[0].Crit != 90 {
+		t.Errorf("metrics = %+v, want the value with its thresholds", metrics)
+	}
+}
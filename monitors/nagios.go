@@ -0,0 +1,182 @@
+package monitors
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Output modes for command monitors
+const (
+	// OutputModeDefault checks the exit code and output against the monitor's validations
+	OutputModeDefault = ""
+	// OutputModeNagios treats the command as a Nagios/Icinga plugin: the exit code is the
+	// status and the output carries a message and perfdata
+	OutputModeNagios = "nagios"
+)
+
+// perfdataValuePattern splits a perfdata value such as "12.5ms" into number and unit
+var perfdataValuePattern = regexp.MustCompile(`^([-+]?(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)(.*)$`)
+
+// pluginStatus maps a plugin exit code to a status: 0 OK, 1 WARNING, 2 CRITICAL, and
+// anything else UNKNOWN
+func pluginStatus(exitCode int) MonitorStatus {
+	switch exitCode {
+	case 0:
+		return StatusOK
+	case 1:
+		return StatusWarning
+	case 2:
+		return StatusCritical
+	default:
+		return StatusUnknown
+	}
+}
+
+// checkPluginResult builds the result of a command monitor in nagios output mode
+func checkPluginResult(exitCode int, stdout, stderr string) (MonitorStatus, string, []Metric) {
+	message, metrics := parsePluginOutput(stdout)
+	if message == "" {
+		message = fmt.Sprintf("Plugin returned no output (exit code %d)", exitCode)
+		if stderr != "" {
+			message = fmt.Sprintf("%s. Stderr: %s", message, truncateOutput(stderr))
+		}
+	}
+	return pluginStatus(exitCode), truncateOutput(message), metrics
+}
+
+// parsePluginOutput splits plugin output into the message of its first line and the
+// perfdata, which may follow a "|" on the first line and on the long output lines:
+//
+//	TEXT OUTPUT | PERFDATA
+//	LONG TEXT LINE 1
+//	LONG TEXT LINE 2 | PERFDATA
+//	PERFDATA
+func parsePluginOutput(output string) (string, []Metric) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	message, perfdata, _ := strings.Cut(lines[0], "|")
+
+	// Everything after the first "|" in the long output is perfdata
+	if len(lines) > 1 {
+		long := strings.Join(lines[1:], "\n")
+		if _, more, found := strings.Cut(long, "|"); found {
+			perfdata += " " + more
+		}
+	}
+	return strings.TrimSpace(message), parsePerfdata(perfdata)
+}
+
+// parsePerfdata parses space separated 'label'=value[UOM];[warn];[crit];[min];[max]
+// entries. Malformed entries and values of "U" (undetermined) are skipped.
+func parsePerfdata(perfdata string) []Metric {
+	var metrics []Metric
+	for _, entry := range splitPerfdata(perfdata) {
+		metric, err := parsePerfdataEntry(entry)
+		if err != nil {
+			slog.Debug("Skipping perfdata", slog.String("entry", entry), slog.String("error", err.Error()))
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// splitPerfdata splits perfdata on whitespace, keeping quoted labels that contain spaces
+// together. A quote inside a quoted label is written as two quotes.
+func splitPerfdata(perfdata string) []string {
+	var entries []string
+	var current strings.Builder
+	quoted := false
+	for i := 0; i < len(perfdata); i++ {
+		c := perfdata[i]
+		switch {
+		case c == '\'' && quoted && i+1 < len(perfdata) && perfdata[i+1] == '\'':
+			current.WriteString("''")
+			i++
+		case c == '\'':
+			quoted = !quoted
+			current.WriteByte(c)
+		case (c == ' ' || c == '\t' || c == '\n') && !quoted:
+			if current.Len() > 0 {
+				entries = append(entries, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if current.Len() > 0 {
+		entries = append(entries, current.String())
+	}
+	return entries
+}
+
+func parsePerfdataEntry(entry string) (Metric, error) {
+	separator := strings.LastIndex(entry, "=")
+	if separator <= 0 {
+		return Metric{}, fmt.Errorf("missing label or value")
+	}
+	label := entry[:separator]
+	if len(label) >= 2 && strings.HasPrefix(label, "'") && strings.HasSuffix(label, "'") {
+		label = strings.ReplaceAll(label[1:len(label)-1], "''", "'")
+	}
+
+	fields := strings.Split(entry[separator+1:], ";")
+	if fields[0] == "U" {
+		return Metric{}, fmt.Errorf("value is undetermined")
+	}
+	match := perfdataValuePattern.FindStringSubmatch(strings.ReplaceAll(fields[0], ",", "."))
+	if match == nil {
+		return Metric{}, fmt.Errorf("invalid value %q", fields[0])
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return Metric{}, fmt.Errorf("invalid value %q", fields[0])
+	}
+
+	metric := Metric{Name: label, Value: value, Unit: match[2]}
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	metric.Warn = perfdataThreshold(field(1))
+	metric.Crit = perfdataThreshold(field(2))
+	metric.Min = perfdataNumber(field(3))
+	metric.Max = perfdataNumber(field(4))
+	return metric, nil
+}
+
+// perfdataThreshold returns the bound of a Nagios threshold range that alerts are raised
+// past: "10" and "~:10" give 10, "10:" gives 10. Ranges with two bounds and inverted
+// ("@") ranges can't be expressed as one number and are left out.
+func perfdataThreshold(threshold string) *float64 {
+	if threshold == "" || strings.HasPrefix(threshold, "@") {
+		return nil
+	}
+	start, end, isRange := strings.Cut(threshold, ":")
+	if !isRange {
+		return perfdataNumber(threshold)
+	}
+	switch {
+	case end == "":
+		return perfdataNumber(start)
+	case start == "" || start == "~" || start == "0":
+		return perfdataNumber(end)
+	}
+	return nil
+}
+
+func perfdataNumber(s string) *float64 {
+	if s == "" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
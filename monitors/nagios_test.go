@@ -0,0 +1,100 @@
+package monitors
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestParsePluginOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantMessage string
+		wantMetrics []Metric
+	}{
+		{
+			name:        "message only",
+			output:      "PING OK - Packet loss = 0%\n",
+			wantMessage: "PING OK - Packet loss = 0%",
+		},
+		{
+			name:        "single line perfdata",
+			output:      "DISK OK - free space: / 3326 MB (56%) | /=2643MB;5948;5958;0;5968",
+			wantMessage: "DISK OK - free space: / 3326 MB (56%)",
+			wantMetrics: []Metric{{Name: "/", Value: 2643, Unit: "MB", Warn: float(5948), Crit: float(5958), Min: float(0), Max: float(5968)}},
+		},
+		{
+			name:        "long output perfdata",
+			output:      "LOAD OK | load1=0.12;;;0\nper-cpu load is fine\nsee details | load5=0.30 load15=0.25\nprocs=212c",
+			wantMessage: "LOAD OK",
+			wantMetrics: []Metric{
+				{Name: "load1", Value: 0.12, Min: float(0)},
+				{Name: "load5", Value: 0.30},
+				{Name: "load15", Value: 0.25},
+				{Name: "procs", Value: 212, Unit: "c"},
+			},
+		},
+		{
+			name:        "quoted labels and ranges",
+			output:      "OK | 'queue ''jobs'' size'=12;~:50;100: 'rta'=0.8ms;@1:2;5:10",
+			wantMessage: "OK",
+			wantMetrics: []Metric{
+				{Name: "queue 'jobs' size", Value: 12, Warn: float(50), Crit: float(100)},
+				{Name: "rta", Value: 0.8, Unit: "ms"},
+			},
+		},
+		{
+			name:        "undetermined and malformed values",
+			output:      "UNKNOWN | a=U;1;2 b=fast c= =3 d=5%",
+			wantMessage: "UNKNOWN",
+			wantMetrics: []Metric{{Name: "d", Value: 5, Unit: "%"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, metrics := parsePluginOutput(tt.output)
+			if message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", message, tt.wantMessage)
+			}
+			if !reflect.DeepEqual(metrics, tt.wantMetrics) {
+				t.Errorf("metrics = %+v, want %+v", metrics, tt.wantMetrics)
+			}
+		})
+	}
+}
+
+func TestCheckCommand_NagiosMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		want        MonitorStatus
+		wantMessage string
+		wantMetrics int
+	}{
+		{name: "ok", command: "echo 'HTTP OK | time=0.01s;1;2'", want: StatusOK, wantMessage: "HTTP OK", wantMetrics: 1},
+		{name: "warning", command: "echo 'DISK WARNING | /=91%;90;95'; exit 1", want: StatusWarning, wantMessage: "DISK WARNING", wantMetrics: 1},
+		{name: "critical", command: "echo 'PROCS CRITICAL: 0 processes'; exit 2", want: StatusCritical, wantMessage: "PROCS CRITICAL: 0 processes"},
+		{name: "unknown", command: "echo 'check_foo: invalid argument'; exit 3", want: StatusUnknown, wantMessage: "check_foo: invalid argument"},
+		{name: "unexpected exit code", command: "exit 127", want: StatusUnknown, wantMessage: "Plugin returned no output (exit code 127)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := Monitor{Name: "plugin", Type: "command", Command: tt.command, OutputMode: OutputModeNagios}
+			monitor.ApplyDefaults()
+			status, message, metrics := checkCommand(context.Background(), monitor)
+			if status != tt.want || message != tt.wantMessage {
+				t.Errorf("checkCommand() = %s %q, want %s %q", status, message, tt.want, tt.wantMessage)
+			}
+			if len(metrics) != tt.wantMetrics {
+				t.Errorf("got %d metrics, want %d: %+v", len(metrics), tt.wantMetrics, metrics)
+			}
+		})
+	}
+}
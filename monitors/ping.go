@@ -0,0 +1,265 @@
+package monitors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// DefaultPingCount is how many echo requests a ping monitor sends when count is not set
+const DefaultPingCount = 5
+
+// MaxPingCount bounds count, so a check can't outlast its interval by much
+const MaxPingCount = 100
+
+// Default packet loss thresholds for ping monitors, in percent, as in check_ping
+const (
+	DefaultPingLossWarning  = 20
+	DefaultPingLossCritical = 60
+)
+
+// pingInterval is the time between echo requests
+var pingInterval = 200 * time.Millisecond
+
+// Protocol numbers for parsing ICMP messages
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// pingStats summarizes the replies to a series of echo requests
+type pingStats struct {
+	sent     int
+	received int
+	rtts     []time.Duration
+}
+
+// loss returns the percentage of requests that got no reply
+func (s pingStats) loss() float64 {
+	if s.sent == 0 {
+		return 0
+	}
+	return float64(s.sent-s.received) * 100 / float64(s.sent)
+}
+
+// summary returns the minimum, average and maximum round trip time in milliseconds, and
+// the jitter: the mean difference between consecutive round trip times
+func (s pingStats) summary() (minRTT, avgRTT, maxRTT, jitter float64) {
+	if len(s.rtts) == 0 {
+		return 0, 0, 0, 0
+	}
+	minRTT, maxRTT = math.Inf(1), math.Inf(-1)
+	var sum, deltas, previous float64
+	for i, rtt := range s.rtts {
+		ms := float64(rtt.Microseconds()) / 1000
+		minRTT, maxRTT, sum = math.Min(minRTT, ms), math.Max(maxRTT, ms), sum+ms
+		if i > 0 {
+			deltas += math.Abs(ms - previous)
+		}
+		previous = ms
+	}
+	avgRTT = sum / float64(len(s.rtts))
+	if len(s.rtts) > 1 {
+		jitter = deltas / float64(len(s.rtts)-1)
+	}
+	return minRTT, avgRTT, maxRTT, jitter
+}
+
+// checkPing sends ICMP echo requests to the host and checks packet loss and round trip time
+func checkPing(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(monitor.Timeout)*time.Second)
+	defer cancel()
+
+	addr, err := resolvePingTarget(ctx, monitor.Host)
+	if err != nil {
+		return StatusCritical, fmt.Sprintf("Failed to resolve %s: %v", monitor.Host, err), nil
+	}
+	stats, err := ping(ctx, addr, monitor.Count)
+	if err != nil {
+		return StatusUnknown, fmt.Sprintf("Ping to %s failed: %v", monitor.Host, err), nil
+	}
+
+	var lossThreshold, rttThreshold *Threshold
+	if monitor.Thresholds != nil {
+		lossThreshold, rttThreshold = monitor.Thresholds.PacketLossPercent, monitor.Thresholds.RTTMs
+	}
+	loss := stats.loss()
+	minRTT, avgRTT, maxRTT, jitter := stats.summary()
+	metrics := []Metric{
+		Metric{Name: "packet_loss", Value: loss, Unit: unitPercent}.withThreshold(lossThreshold),
+		Metric{Name: "rtt_avg", Value: avgRTT, Unit: unitMilliseconds}.withThreshold(rttThreshold),
+		{Name: "rtt_min", Value: minRTT, Unit: unitMilliseconds},
+		{Name: "rtt_max", Value: maxRTT, Unit: unitMilliseconds},
+		{Name: "rtt_jitter", Value: jitter, Unit: unitMilliseconds},
+	}
+
+	target := monitor.Host
+	if target != addr.String() {
+		target = fmt.Sprintf("%s (%s)", monitor.Host, addr)
+	}
+	if stats.received == 0 {
+		return StatusCritical, fmt.Sprintf("PING %s: no replies to %d requests", target, stats.sent), metrics
+	}
+	message := fmt.Sprintf("PING %s: %d/%d received, %s%% loss, rtt min/avg/max/jitter %.3f/%.3f/%.3f/%.3f ms",
+		target, stats.received, stats.sent, formatValue(math.Round(loss*10)/10), minRTT, avgRTT, maxRTT, jitter)
+
+	status := StatusOK
+	if lossThreshold != nil {
+		status = worseStatus(status, lossThreshold.evaluate(loss, false))
+	}
+	if rttThreshold != nil {
+		status = worseStatus(status, rttThreshold.evaluate(avgRTT, false))
+	}
+	return status, message, metrics
+}
+
+// resolvePingTarget returns the address to ping, preferring IPv4
+func resolvePingTarget(ctx context.Context, host string) (net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			return ip4, nil
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses")
+	}
+	return addrs[0].IP, nil
+}
+
+// listenICMP opens an unprivileged ICMP datagram socket, or a raw socket if the system
+// doesn't allow those (on Linux, see net.ipv4.ping_group_range). With preferRaw the raw
+// socket is tried first, for callers that need the ICMP errors only it receives. It
+// reports whether the socket is a datagram socket, for which the kernel picks the echo
+// identifier.
+func listenICMP(v6, preferRaw bool) (*icmp.PacketConn, bool, error) {
+	datagram, raw, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if v6 {
+		datagram, raw, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+	if preferRaw {
+		if conn, err := icmp.ListenPacket(raw, address); err == nil {
+			return conn, false, nil
+		}
+	}
+	conn, err := icmp.ListenPacket(datagram, address)
+	if err == nil {
+		return conn, true, nil
+	}
+	conn, rawErr := icmp.ListenPacket(raw, address)
+	if rawErr != nil {
+		return nil, false, fmt.Errorf("no ICMP socket available: %w", errors.Join(err, rawErr))
+	}
+	return conn, false, nil
+}
+
+// ping sends count echo requests to addr, one every pingInterval, and waits for each
+// reply for up to its share of the context's deadline
+func ping(ctx context.Context, addr net.IP, count int) (pingStats, error) {
+	v6 := addr.To4() == nil
+	conn, datagram, err := listenICMP(v6, false)
+	if err != nil {
+		return pingStats{}, err
+	}
+	defer conn.Close()
+
+	var dst net.Addr = &net.IPAddr{IP: addr}
+	if datagram {
+		dst = &net.UDPAddr{IP: addr}
+	}
+	var requestType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	protocol := protocolICMP
+	if v6 {
+		requestType, replyType, protocol = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, protocolICMPv6
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Duration(count) * time.Second)
+	}
+	perPacket := time.Until(deadline) / time.Duration(count)
+	id := rand.N(1 << 16)
+	token := make([]byte, 8)
+	for i := range token {
+		token[i] = byte(rand.N(256))
+	}
+
+	var stats pingStats
+	buf := make([]byte, 1500)
+	for seq := range count {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+				return stats, nil
+			case <-time.After(pingInterval):
+			}
+		}
+		request, err := (&icmp.Message{
+			Type: requestType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: token},
+		}).Marshal(nil)
+		if err != nil {
+			return stats, err
+		}
+		sent := time.Now()
+		if _, err := conn.WriteTo(request, dst); err != nil {
+			return stats, err
+		}
+		stats.sent++
+
+		readDeadline := sent.Add(perPacket)
+		if deadline.Before(readDeadline) {
+			readDeadline = deadline
+		}
+		conn.SetReadDeadline(readDeadline)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break // lost
+			}
+			if err != nil {
+				return stats, err
+			}
+			if !sameIP(from, addr) {
+				continue
+			}
+			reply, err := icmp.ParseMessage(protocol, buf[:n])
+			if err != nil || reply.Type != replyType {
+				continue
+			}
+			// Raw sockets see every echo reply on the host; datagram sockets only their own,
+			// with the identifier the kernel chose
+			echo, ok := reply.Body.(*icmp.Echo)
+			if !ok || echo.Seq != seq || (!datagram && (echo.ID != id || string(echo.Data) != string(token))) {
+				continue
+			}
+			stats.received++
+			stats.rtts = append(stats.rtts, time.Since(sent))
+			break
+		}
+	}
+	return stats, nil
+}
+
+// sameIP reports whether a packet came from ip
+func sameIP(from net.Addr, ip net.IP) bool {
+	switch addr := from.(type) {
+	case *net.IPAddr:
+		return addr.IP.Equal(ip)
+	case *net.UDPAddr:
+		return addr.IP.Equal(ip)
+	}
+	return false
+}
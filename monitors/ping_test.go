@@ -0,0 +1,98 @@
+package monitors
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPingStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		stats      pingStats
+		wantLoss   float64
+		wantMin    float64
+		wantAvg    float64
+		wantMax    float64
+		wantJitter float64
+	}{
+		{name: "no requests", stats: pingStats{}},
+		{name: "all lost", stats: pingStats{sent: 4}, wantLoss: 100},
+		{name: "one reply", stats: pingStats{sent: 1, received: 1, rtts: []time.Duration{2 * time.Millisecond}}, wantMin: 2, wantAvg: 2, wantMax: 2},
+		{
+			name:     "partial loss",
+			stats:    pingStats{sent: 5, received: 4, rtts: []time.Duration{10 * time.Millisecond, 14 * time.Millisecond, 12 * time.Millisecond, 12 * time.Millisecond}},
+			wantLoss: 20, wantMin: 10, wantAvg: 12, wantMax: 14, wantJitter: 2, // (4 + 2 + 0) / 3
+		},
+		{name: "sub-millisecond", stats: pingStats{sent: 2, received: 2, rtts: []time.Duration{50 * time.Microsecond, 150 * time.Microsecond}}, wantMin: 0.05, wantAvg: 0.1, wantMax: 0.15, wantJitter: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if loss := tt.stats.loss(); loss != tt.wantLoss {
+				t.Errorf("loss() = %v, want %v", loss, tt.wantLoss)
+			}
+			minRTT, avgRTT, maxRTT, jitter := tt.stats.summary()
+			if math.Abs(minRTT-tt.wantMin) > 1e-9 || math.Abs(avgRTT-tt.wantAvg) > 1e-9 || math.Abs(maxRTT-tt.wantMax) > 1e-9 || math.Abs(jitter-tt.wantJitter) > 1e-9 {
+				t.Errorf("summary() = %v/%v/%v/%v, want %v/%v/%v/%v", minRTT, avgRTT, maxRTT, jitter, tt.wantMin, tt.wantAvg, tt.wantMax, tt.wantJitter)
+			}
+		})
+	}
+}
+
+func TestCheckPing_Loopback(t *testing.T) {
+	if conn, _, err := listenICMP(false, false); err != nil {
+		t.Skipf("ICMP sockets unavailable: %v", err)
+	} else {
+		conn.Close()
+	}
+	previous := pingInterval
+	pingInterval = 10 * time.Millisecond
+	defer func() { pingInterval = previous }()
+
+	tests := []struct {
+		name        string
+		monitor     Monitor
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "replies", monitor: Monitor{Host: "127.0.0.1", Count: 3}, want: StatusOK, wantMessage: "PING 127.0.0.1: 3/3 received, 0% loss"},
+		{name: "host name", monitor: Monitor{Host: "localhost", Count: 2}, want: StatusOK, wantMessage: "PING localhost (127.0.0.1): 2/2 received"},
+		{name: "rtt threshold", monitor: Monitor{Host: "127.0.0.1", Count: 2, Thresholds: &Thresholds{RTTMs: limits(0, 1000)}}, want: StatusWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := tt.monitor
+			monitor.Name, monitor.Type = "ping", "ping"
+			monitor.ApplyDefaults()
+			if err := monitor.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			status, message, metrics := checkPing(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkPing() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+			names := make([]string, len(metrics))
+			for i, metric := range metrics {
+				names[i] = metric.Name
+			}
+			if strings.Join(names, ",") != "packet_loss,rtt_avg,rtt_min,rtt_max,rtt_jitter" {
+				t.Errorf("metrics = %v", names)
+			}
+			if metrics[0].Value != 0 || metrics[0].Crit == nil || *metrics[0].Crit != DefaultPingLossCritical {
+				t.Errorf("packet_loss metric = %+v, want 0 with the default thresholds", metrics[0])
+			}
+		})
+	}
+}
+
+func TestCheckPing_Unresolvable(t *testing.T) {
+	monitor := Monitor{Name: "ping", Type: "ping", Host: "host.invalid", Timeout: 2}
+	monitor.ApplyDefaults()
+	if status, message, _ := checkPing(context.Background(), monitor); status != StatusCritical || !strings.Contains(message, "Failed to resolve host.invalid") {
+		t.Errorf("checkPing() = %s %q", status, message)
+	}
+}
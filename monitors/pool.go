@@ -0,0 +1,95 @@
+package monitors
+
+import (
+	"cartographer-go-agent/configuration"
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+)
+
+// workerPool bounds how many monitors run at once, overall and per monitor type, so a
+// burst of due checks can't fork dozens of commands at the same time.
+type workerPool struct {
+	all chan struct{}
+
+	mu         sync.Mutex
+	byType     map[string]chan struct{}
+	typeLimit  func(monitorType string) int
+	limit      int
+	typeLimits map[string]int // as configured, to detect changes on reload
+}
+
+func newWorkerPool(config configuration.Config) *workerPool {
+	return &workerPool{
+		all:        make(chan struct{}, config.GetMonitorConcurrency()),
+		byType:     make(map[string]chan struct{}),
+		typeLimit:  config.GetMonitorTypeConcurrency,
+		limit:      config.MonitorConcurrency,
+		typeLimits: maps.Clone(config.MonitorTypeConcurrency),
+	}
+}
+
+// matches reports whether the pool was built with the limits in config
+func (p *workerPool) matches(config configuration.Config) bool {
+	return p.limit == config.MonitorConcurrency && maps.Equal(p.typeLimits, config.MonitorTypeConcurrency)
+}
+
+// run executes the monitor, including its retries, once a slot is free. The type slot
+// is taken first so a monitor waiting on its type doesn't hold an overall slot. If ctx
+// is done before a slot frees up, the monitor is reported as unknown without running.
+func (p *workerPool) run(ctx context.Context, monitor Monitor) MonitorResult {
+	typeSlots := p.typeSlots(monitor.Type)
+	select {
+	case typeSlots <- struct{}{}:
+	case <-ctx.Done():
+		return notRunResult(monitor, ctx.Err())
+	}
+	defer func() { <-typeSlots }()
+	select {
+	case p.all <- struct{}{}:
+	case <-ctx.Done():
+		return notRunResult(monitor, ctx.Err())
+	}
+	defer func() { <-p.all }()
+
+	return executeMonitor(ctx, monitor)
+}
+
+// notRunResult is the result of a monitor that was cancelled while waiting for a slot
+func notRunResult(monitor Monitor, cause error) MonitorResult {
+	return MonitorResult{
+		Name:      monitor.Name,
+		Type:      monitor.Type,
+		Status:    StatusUnknown,
+		Message:   fmt.Sprintf("Check not run: %v", cause),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// runAll executes monitors in parallel and returns their results in the same order
+func (p *workerPool) runAll(ctx context.Context, monitors []Monitor) []MonitorResult {
+	results := make([]MonitorResult, len(monitors))
+	var wg sync.WaitGroup
+	for i, monitor := range monitors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = p.run(ctx, monitor)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (p *workerPool) typeSlots(monitorType string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	slots, ok := p.byType[monitorType]
+	if !ok {
+		slots = make(chan struct{}, p.typeLimit(monitorType))
+		p.byType[monitorType] = slots
+	}
+	return slots
+}
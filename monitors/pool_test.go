@@ -0,0 +1,134 @@
+package monitors
+
+import (
+	"cartographer-go-agent/configuration"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyServer answers slowly and records the most requests it had in flight at once
+type concurrencyServer struct {
+	*httptest.Server
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	requests    atomic.Int32
+}
+
+func newConcurrencyServer(t *testing.T, status int) *concurrencyServer {
+	t.Helper()
+	s := &concurrencyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		current := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for {
+			peak := s.maxInFlight.Load()
+			if current <= peak || s.maxInFlight.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func httpMonitors(url string, count int) []Monitor {
+	monitors := make([]Monitor, count)
+	for i := range monitors {
+		monitors[i] = Monitor{Name: fmt.Sprintf("check_%d", i), Type: "http", URL: url}
+		monitors[i].ApplyDefaults()
+	}
+	return monitors
+}
+
+func TestWorkerPool_Limits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config configuration.Config
+		want   int32
+	}{
+		{name: "global limit", config: configuration.Config{MonitorConcurrency: 3}, want: 3},
+		{name: "type limit below global", config: configuration.Config{MonitorConcurrency: 4, MonitorTypeConcurrency: map[string]int{"http": 2}}, want: 2},
+		{name: "global limit below type", config: configuration.Config{MonitorConcurrency: 1, MonitorTypeConcurrency: map[string]int{"http": 4}}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newConcurrencyServer(t, http.StatusOK)
+			monitors := httpMonitors(server.URL, 8)
+
+			results := newWorkerPool(tt.config).runAll(context.Background(), monitors)
+
+			if peak := server.maxInFlight.Load(); peak != tt.want {
+				t.Errorf("max concurrent checks = %d, want %d", peak, tt.want)
+			}
+			for i, result := range results {
+				if result.Name != monitors[i].Name {
+					t.Errorf("results[%d] = %s, want definition order", i, result.Name)
+				}
+				if result.Status != StatusOK {
+					t.Errorf("%s: %s %s", result.Name, result.Status, result.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerPool_TypesAreLimitedSeparately(t *testing.T) {
+	pool := newWorkerPool(configuration.Config{})
+	if got := cap(pool.typeSlots("command")); got != configuration.DefaultCommandMonitorConcurrency {
+		t.Errorf("command slots = %d, want %d", got, configuration.DefaultCommandMonitorConcurrency)
+	}
+	if got := cap(pool.typeSlots("http")); got != configuration.DefaultMonitorConcurrency {
+		t.Errorf("http slots = %d, want %d", got, configuration.DefaultMonitorConcurrency)
+	}
+	if pool.typeSlots("http") != pool.typeSlots("http") {
+		t.Error("expected monitors of a type to share their slots")
+	}
+}
+
+func TestWorkerPool_KeepsRetries(t *testing.T) {
+	server := newConcurrencyServer(t, http.StatusInternalServerError)
+	monitors := httpMonitors(server.URL, 2)
+	for i := range monitors {
+		monitors[i].Retries = 2
+	}
+
+	var wg sync.WaitGroup
+	pool := newWorkerPool(configuration.Config{MonitorConcurrency: 2})
+	for _, monitor := range monitors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := pool.run(context.Background(), monitor); result.Status != StatusCritical {
+				t.Errorf("%s: status %s, want CRITICAL", result.Name, result.Status)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each monitor makes its initial attempt and both retries
+	if got := server.requests.Load(); got != 6 {
+		t.Errorf("requests = %d, want 6", got)
+	}
+}
+
+func TestWorkerPool_Matches(t *testing.T) {
+	config := configuration.Config{MonitorConcurrency: 4, MonitorTypeConcurrency: map[string]int{"command": 2}}
+	pool := newWorkerPool(config)
+	if !pool.matches(config) {
+		t.Error("expected the pool to match the config it was built from")
+	}
+	config.MonitorTypeConcurrency = map[string]int{"command": 3}
+	if pool.matches(config) {
+		t.Error("expected a changed type limit not to match")
+	}
+}
@@ -1,6 +1,7 @@
 package monitors
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os/exec"
@@ -9,47 +10,53 @@ import (
 )
 
 // checkPort performs a port connectivity check
-func checkPort(monitor Monitor) (MonitorStatus, string) {
+func checkPort(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
+	if monitor.hasPayloadProbe() {
+		return checkProbe(ctx, monitor)
+	}
 	if monitor.Protocol == "tcp" {
-		return checkTCPPort(monitor)
+		return checkTCPPort(ctx, monitor)
 	} else if monitor.Protocol == "udp" {
-		return checkUDPPort(monitor)
+		return checkUDPPort(ctx, monitor)
 	}
 
-	return StatusUnknown, fmt.Sprintf("Unknown protocol: %s", monitor.Protocol)
+	return StatusUnknown, fmt.Sprintf("Unknown protocol: %s", monitor.Protocol), nil
 }
 
 // checkTCPPort checks if a TCP port is open and accepting connections
-func checkTCPPort(monitor Monitor) (MonitorStatus, string) {
+func checkTCPPort(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
 	// Use net.JoinHostPort to properly handle IPv6 addresses
 	address := net.JoinHostPort(monitor.Host, fmt.Sprintf("%d", monitor.Port))
 	timeout := time.Duration(monitor.Timeout) * time.Second
 
-	conn, err := net.DialTimeout("tcp", address, timeout)
+	dialer := net.Dialer{Timeout: timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
-		return StatusCritical, fmt.Sprintf("TCP connection failed: %v", err)
+		return StatusCritical, fmt.Sprintf("TCP connection failed: %v", err), nil
 	}
 	defer conn.Close()
+	connectTime := durationMetric("connect_time", time.Since(start))
 
-	return StatusOK, fmt.Sprintf("TCP port %d open on %s", monitor.Port, monitor.Host)
+	return StatusOK, fmt.Sprintf("TCP port %d open on %s", monitor.Port, monitor.Host), []Metric{connectTime}
 }
 
 // checkUDPPort checks if a UDP port is bound on localhost using netstat
-func checkUDPPort(monitor Monitor) (MonitorStatus, string) {
+func checkUDPPort(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
 	// Try ss first (newer, faster), fall back to netstat
 	if isCommandAvailable("ss") {
-		return checkUDPPortWithSS(monitor)
+		return checkUDPPortWithSS(ctx, monitor)
 	}
-	return checkUDPPortWithNetstat(monitor)
+	return checkUDPPortWithNetstat(ctx, monitor)
 }
 
 // checkUDPPortWithSS uses ss to check UDP port binding
-func checkUDPPortWithSS(monitor Monitor) (MonitorStatus, string) {
+func checkUDPPortWithSS(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
 	// ss -ulnH | grep :PORT
-	cmd := exec.Command("ss", "-ulnH")
+	cmd := exec.CommandContext(ctx, "ss", "-ulnH")
 	output, err := cmd.Output()
 	if err != nil {
-		return StatusUnknown, fmt.Sprintf("Failed to execute ss: %v", err)
+		return StatusUnknown, fmt.Sprintf("Failed to execute ss: %v", err), nil
 	}
 
 	lines := strings.Split(string(output), "\n")
@@ -61,21 +68,21 @@ func checkUDPPortWithSS(monitor Monitor) (MonitorStatus, string) {
 			// Check if the character after :PORT is whitespace or end of string
 			endIdx := idx + len(portStr)
 			if endIdx >= len(line) || line[endIdx] == ' ' || line[endIdx] == '\t' {
-				return StatusOK, fmt.Sprintf("UDP port %d is bound on localhost", monitor.Port)
+				return StatusOK, fmt.Sprintf("UDP port %d is bound on localhost", monitor.Port), nil
 			}
 		}
 	}
 
-	return StatusCritical, fmt.Sprintf("UDP port %d is not bound on localhost", monitor.Port)
+	return StatusCritical, fmt.Sprintf("UDP port %d is not bound on localhost", monitor.Port), nil
 }
 
 // checkUDPPortWithNetstat uses netstat to check UDP port binding
-func checkUDPPortWithNetstat(monitor Monitor) (MonitorStatus, string) {
+func checkUDPPortWithNetstat(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
 	// netstat -uln | grep :PORT
-	cmd := exec.Command("netstat", "-uln")
+	cmd := exec.CommandContext(ctx, "netstat", "-uln")
 	output, err := cmd.Output()
 	if err != nil {
-		return StatusUnknown, fmt.Sprintf("Failed to execute netstat: %v", err)
+		return StatusUnknown, fmt.Sprintf("Failed to execute netstat: %v", err), nil
 	}
 
 	lines := strings.Split(string(output), "\n")
@@ -87,12 +94,12 @@ func checkUDPPortWithNetstat(monitor Monitor) (MonitorStatus, string) {
 			// Check if the character after :PORT is whitespace or end of string
 			endIdx := idx + len(portStr)
 			if endIdx >= len(line) || line[endIdx] == ' ' || line[endIdx] == '\t' {
-				return StatusOK, fmt.Sprintf("UDP port %d is bound on localhost", monitor.Port)
+				return StatusOK, fmt.Sprintf("UDP port %d is bound on localhost", monitor.Port), nil
 			}
 		}
 	}
 
-	return StatusCritical, fmt.Sprintf("UDP port %d is not bound on localhost", monitor.Port)
+	return StatusCritical, fmt.Sprintf("UDP port %d is not bound on localhost", monitor.Port), nil
 }
 
 // isCommandAvailable checks if a command is available in PATH
@@ -0,0 +1,260 @@
+package monitors
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxProbeResponse bounds how much of a response a probe reads
+const maxProbeResponse = 64 * 1024
+
+// bannerProbe is a built-in check for a common protocol: an optional request and a
+// pattern the reply must match
+type bannerProbe struct {
+	name   string
+	send   string
+	expect *regexp.Regexp
+	// metrics reads values from a successful reply
+	metrics func(response string) []Metric
+}
+
+// bannerProbes are the built-in probes, by the name used in the probe setting
+var bannerProbes = map[string]bannerProbe{
+	"ssh":  {name: "SSH banner", expect: regexp.MustCompile(`^SSH-\d+\.\d+-\S+`)},
+	"smtp": {name: "SMTP greeting", expect: regexp.MustCompile(`^220[ -]`)},
+	// A server that requires AUTH answers PING with NOAUTH, which still shows it is up
+	"redis":     {name: "Redis PING", send: "PING\r\n", expect: regexp.MustCompile(`^(\+PONG|-NOAUTH)`)},
+	"memcached": {name: "memcached stats", send: "stats\r\n", expect: regexp.MustCompile(`(?s)^STAT .*\r\nEND\r\n`), metrics: memcachedMetrics},
+}
+
+// memcachedStats are the stats reported as metrics by the memcached probe
+var memcachedStats = map[string]string{
+	"curr_connections": unitCount,
+	"curr_items":       unitCount,
+	"bytes":            unitBytes,
+	"evictions":        unitCount,
+	"get_hits":         unitCount,
+	"get_misses":       unitCount,
+}
+
+// responseMatcher is one condition on a probe's response
+type responseMatcher struct {
+	description string
+	matches     func(response []byte) bool
+}
+
+// hasPayloadProbe reports whether a port monitor sends a payload or validates a response,
+// rather than only checking that the port is open or bound
+func (m *Monitor) hasPayloadProbe() bool {
+	if m.Send != "" || m.SendHex != "" || m.Probe != "" {
+		return true
+	}
+	v := m.Validations
+	return v != nil && (v.ResponseContains != "" || v.ResponseRegex != "" || v.ResponseHex != "")
+}
+
+// checkProbe connects to host:port, sends the configured payload and validates the response
+func checkProbe(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
+	address := net.JoinHostPort(monitor.Host, strconv.Itoa(monitor.Port))
+	probe, isBuiltin := bannerProbes[monitor.Probe]
+	payload, matchers, err := probeRequest(monitor, probe)
+	if err != nil {
+		return StatusUnknown, fmt.Sprintf("Invalid probe for %s: %v", monitor.Name, err), nil
+	}
+	label := strings.ToUpper(monitor.Protocol) + " probe"
+	if isBuiltin {
+		label = probe.name
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(monitor.Timeout)*time.Second)
+	defer cancel()
+
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, monitor.Protocol, address)
+	if err != nil {
+		return StatusCritical, fmt.Sprintf("%s connection failed: %v", strings.ToUpper(monitor.Protocol), err), nil
+	}
+	defer conn.Close()
+	var metrics []Metric
+	if monitor.Protocol == "tcp" {
+		metrics = append(metrics, durationMetric("connect_time", time.Since(start)))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	sent := time.Now()
+	if len(payload) > 0 {
+		if _, err := conn.Write(payload); err != nil {
+			return StatusCritical, fmt.Sprintf("%s to %s failed to send: %v", label, address, err), metrics
+		}
+	}
+	response, err := readProbeResponse(conn, matchers)
+	responseTime := time.Since(sent)
+	var threshold *Threshold
+	if monitor.Thresholds != nil {
+		threshold = monitor.Thresholds.ResponseTimeMs
+	}
+	metrics = append(metrics,
+		durationMetric("response_time", responseTime).withThreshold(threshold),
+		Metric{Name: "response_size", Value: float64(len(response)), Unit: unitBytes},
+	)
+	if len(response) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return StatusCritical, fmt.Sprintf("%s to %s got no response: %v", label, address, err), metrics
+	}
+
+	for _, matcher := range matchers {
+		if !matcher.matches(response) {
+			return StatusCritical, fmt.Sprintf("%s to %s: response %s, got %s", label, address, matcher.description, quoteResponse(response)), metrics
+		}
+	}
+	if isBuiltin && probe.metrics != nil {
+		metrics = append(metrics, probe.metrics(string(response))...)
+	}
+	message := fmt.Sprintf("%s on %s: %s", label, address, quoteResponse(response))
+	if threshold != nil {
+		ms := responseTime.Milliseconds()
+		if status := threshold.evaluate(float64(ms), false); status != StatusOK {
+			return status, fmt.Sprintf("%s, but the response took %dms", message, ms), metrics
+		}
+	}
+	return StatusOK, message, metrics
+}
+
+// probeRequest returns the payload to send and the conditions the response must meet
+func probeRequest(monitor Monitor, probe bannerProbe) ([]byte, []responseMatcher, error) {
+	payload := []byte(monitor.Send)
+	switch {
+	case monitor.SendHex != "":
+		decoded, err := decodeHex(monitor.SendHex)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid send_hex: %w", err)
+		}
+		payload = decoded
+	case probe.send != "":
+		payload = []byte(probe.send)
+	}
+
+	var matchers []responseMatcher
+	if probe.expect != nil {
+		matchers = append(matchers, responseMatcher{
+			description: fmt.Sprintf("is not a valid %s", probe.name),
+			matches:     probe.expect.Match,
+		})
+	}
+	if v := monitor.Validations; v != nil {
+		if v.ResponseContains != "" {
+			matchers = append(matchers, responseMatcher{
+				description: fmt.Sprintf("does not contain '%s'", v.ResponseContains),
+				matches:     func(response []byte) bool { return bytes.Contains(response, []byte(v.ResponseContains)) },
+			})
+		}
+		if v.ResponseRegex != "" {
+			re, err := regexp.Compile(v.ResponseRegex)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid response_regex: %w", err)
+			}
+			matchers = append(matchers, responseMatcher{
+				description: fmt.Sprintf("does not match regex '%s'", v.ResponseRegex),
+				matches:     re.Match,
+			})
+		}
+		if v.ResponseHex != "" {
+			expected, err := decodeHex(v.ResponseHex)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid response_hex: %w", err)
+			}
+			matchers = append(matchers, responseMatcher{
+				description: fmt.Sprintf("does not contain bytes %x", expected),
+				matches:     func(response []byte) bool { return bytes.Contains(response, expected) },
+			})
+		}
+	}
+	return payload, matchers, nil
+}
+
+// readProbeResponse reads until the response meets every matcher, or with no matchers
+// until the first data arrives. It stops early at EOF, the deadline or maxProbeResponse.
+func readProbeResponse(conn net.Conn, matchers []responseMatcher) ([]byte, error) {
+	var response []byte
+	buf := make([]byte, 4096)
+	for len(response) < maxProbeResponse {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if len(response) > 0 && allMatch(response, matchers) {
+			return response, nil
+		}
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = fmt.Errorf("timed out")
+			}
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+func allMatch(response []byte, matchers []responseMatcher) bool {
+	for _, matcher := range matchers {
+		if !matcher.matches(response) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeHex decodes hex bytes, ignoring whitespace so payloads can be grouped, e.g. "de ad be ef"
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s))
+}
+
+// quoteResponse shows the first line of a response, or its bytes in hex if it isn't text
+func quoteResponse(response []byte) string {
+	line, _, _ := bytes.Cut(response, []byte("\n"))
+	line = bytes.TrimRight(line, "\r")
+	for _, r := range string(line) {
+		if r == unicode.ReplacementChar || (!unicode.IsPrint(r) && r != '\t') {
+			return "0x" + truncateOutput(hex.EncodeToString(response))
+		}
+	}
+	return truncateOutput(string(line))
+}
+
+// memcachedMetrics reads selected values from a memcached stats reply
+func memcachedMetrics(response string) []Metric {
+	var metrics []Metric
+	for line := range strings.Lines(response) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			continue
+		}
+		unit, ok := memcachedStats[fields[1]]
+		if !ok {
+			continue
+		}
+		if value, err := strconv.ParseFloat(fields[2], 64); err == nil {
+			metrics = append(metrics, Metric{Name: fields[1], Value: value, Unit: unit})
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,203 @@
+package monitors
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// startTCPServer accepts connections on localhost, writes greeting, then answers each
+// line read with reply(line). Connections stay open, so a probe whose response never
+// matches waits out its timeout.
+func startTCPServer(t *testing.T, greeting string, reply func(line string) string) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte(greeting))
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if reply == nil {
+						continue
+					}
+					conn.Write([]byte(reply(scanner.Text())))
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// startUDPServer answers each datagram with reply(payload), or not at all if reply returns nil
+func startUDPServer(t *testing.T, reply func(payload []byte) []byte) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := reply(buf[:n]); response != nil {
+				conn.WriteTo(response, from)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func redisReply(line string) string {
+	if line == "PING" {
+		return "+PONG\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func memcachedReply(line string) string {
+	if line != "stats" {
+		return "ERROR\r\n"
+	}
+	return "STAT pid 1\r\nSTAT uptime 42\r\nSTAT curr_connections 10\r\n" +
+		"STAT get_hits 7\r\nSTAT bytes 2048\r\nEND\r\n"
+}
+
+func TestCheckProbe_TCP(t *testing.T) {
+	ssh := startTCPServer(t, "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n", nil)
+	smtp := startTCPServer(t, "220-mail.example.com ESMTP\r\n220 ready\r\n", nil)
+	notSMTP := startTCPServer(t, "554 no service\r\n", nil)
+	redis := startTCPServer(t, "", redisReply)
+	redisAuth := startTCPServer(t, "", func(string) string { return "-NOAUTH Authentication required.\r\n" })
+	memcached := startTCPServer(t, "", memcachedReply)
+	echo := startTCPServer(t, "", func(line string) string { return "echo: " + line + "\n" })
+	binary := startTCPServer(t, "\x00\x01\xfe\xff", nil)
+	silent := startTCPServer(t, "", nil)
+
+	tests := []struct {
+		name        string
+		monitor     Monitor
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "ssh banner", monitor: Monitor{Port: ssh, Probe: "ssh"}, want: StatusOK, wantMessage: "SSH banner on 127.0.0.1:"},
+		{name: "ssh banner version", monitor: Monitor{Port: ssh, Probe: "ssh", Validations: &Validations{ResponseRegex: `OpenSSH_9\.`}}, want: StatusOK, wantMessage: "SSH-2.0-OpenSSH_9.6p1"},
+		{name: "ssh banner outdated", monitor: Monitor{Port: ssh, Probe: "ssh", Validations: &Validations{ResponseRegex: `OpenSSH_10\.`}}, want: StatusCritical, wantMessage: "does not match regex"},
+		{name: "not ssh", monitor: Monitor{Port: smtp, Probe: "ssh"}, want: StatusCritical, wantMessage: "is not a valid SSH banner, got 220-mail.example.com ESMTP"},
+		{name: "smtp greeting", monitor: Monitor{Port: smtp, Probe: "smtp"}, want: StatusOK, wantMessage: "SMTP greeting on"},
+		{name: "smtp rejects", monitor: Monitor{Port: notSMTP, Probe: "smtp"}, want: StatusCritical, wantMessage: "is not a valid SMTP greeting"},
+		{name: "redis", monitor: Monitor{Port: redis, Probe: "redis"}, want: StatusOK, wantMessage: "Redis PING on 127.0.0.1:"},
+		{name: "redis with auth", monitor: Monitor{Port: redisAuth, Probe: "redis"}, want: StatusOK, wantMessage: "-NOAUTH"},
+		{name: "memcached", monitor: Monitor{Port: memcached, Probe: "memcached"}, want: StatusOK, wantMessage: "STAT pid 1"},
+		{name: "memcached probe on redis", monitor: Monitor{Port: redis, Probe: "memcached"}, want: StatusCritical, wantMessage: "is not a valid memcached stats, got -ERR"},
+		{name: "send and contains", monitor: Monitor{Port: echo, Send: "hello\n", Validations: &Validations{ResponseContains: "echo: hello"}}, want: StatusOK, wantMessage: "TCP probe on"},
+		{name: "send hex", monitor: Monitor{Port: echo, SendHex: "68 69 0a"}, want: StatusOK, wantMessage: "echo: hi"},
+		{name: "contains fails", monitor: Monitor{Port: echo, Send: "hello\n", Validations: &Validations{ResponseContains: "goodbye"}}, want: StatusCritical, wantMessage: "does not contain 'goodbye', got echo: hello"},
+		{name: "response bytes", monitor: Monitor{Port: binary, Validations: &Validations{ResponseHex: "fe ff"}}, want: StatusOK, wantMessage: "0x0001feff"},
+		{name: "response bytes missing", monitor: Monitor{Port: binary, Validations: &Validations{ResponseHex: "cafe"}}, want: StatusCritical, wantMessage: "does not contain bytes cafe, got 0x0001feff"},
+		{name: "invalid regex", monitor: Monitor{Port: echo, Send: "x\n", Validations: &Validations{ResponseRegex: "("}}, want: StatusUnknown, wantMessage: "invalid response_regex"},
+		{name: "response time", monitor: Monitor{Port: redis, Probe: "redis", Thresholds: &Thresholds{ResponseTimeMs: limits(0, 1000)}}, want: StatusWarning, wantMessage: "+PONG, but the response took"},
+		{name: "no response", monitor: Monitor{Port: silent, Send: "hello\n"}, want: StatusCritical, wantMessage: "got no response: timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := tt.monitor
+			monitor.Name, monitor.Type, monitor.Host, monitor.Timeout = "probe", "port", "127.0.0.1", 1
+			monitor.ApplyDefaults()
+			status, message, metrics := checkPort(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkPort() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+			if status != StatusUnknown && (len(metrics) < 3 || metrics[0].Name != "connect_time" || metrics[1].Name != "response_time") {
+				t.Errorf("metrics = %+v", metrics)
+			}
+		})
+	}
+}
+
+func TestCheckProbe_MemcachedMetrics(t *testing.T) {
+	monitor := Monitor{Name: "memcached", Type: "port", Host: "127.0.0.1", Port: startTCPServer(t, "", memcachedReply), Probe: "memcached"}
+	monitor.ApplyDefaults()
+	status, message, metrics := checkPort(context.Background(), monitor)
+	if status != StatusOK {
+		t.Fatalf("checkPort() = %s %q", status, message)
+	}
+	values := make(map[string]float64)
+	for _, metric := range metrics {
+		values[metric.Name] = metric.Value
+	}
+	if values["curr_connections"] != 10 || values["get_hits"] != 7 || values["bytes"] != 2048 {
+		t.Errorf("metrics = %+v", metrics)
+	}
+	if _, ok := values["uptime"]; ok {
+		t.Errorf("unexpected uptime metric")
+	}
+}
+
+func TestCheckProbe_UDP(t *testing.T) {
+	echo := startUDPServer(t, func(payload []byte) []byte { return append([]byte("echo:"), payload...) })
+	silent := startUDPServer(t, func([]byte) []byte { return nil })
+
+	tests := []struct {
+		name        string
+		monitor     Monitor
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "reply", monitor: Monitor{Port: echo, Send: "status"}, want: StatusOK, wantMessage: "UDP probe on 127.0.0.1:"},
+		{name: "reply contains", monitor: Monitor{Port: echo, SendHex: "0102", Validations: &Validations{ResponseHex: "3a0102"}}, want: StatusOK},
+		{name: "reply mismatch", monitor: Monitor{Port: echo, Send: "status", Validations: &Validations{ResponseRegex: `^ok`}}, want: StatusCritical, wantMessage: "does not match regex '^ok', got echo:status"},
+		{name: "no reply", monitor: Monitor{Port: silent, Send: "status"}, want: StatusCritical, wantMessage: "got no response: timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := tt.monitor
+			monitor.Name, monitor.Type, monitor.Host, monitor.Protocol, monitor.Timeout = "probe", "port", "127.0.0.1", "udp", 1
+			monitor.ApplyDefaults()
+			if err := monitor.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			status, message, metrics := checkPort(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkPort() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+			if len(metrics) != 2 || metrics[0].Name != "response_time" {
+				t.Errorf("metrics = %+v", metrics)
+			}
+		})
+	}
+}
+
+func TestQuoteResponse(t *testing.T) {
+	tests := []struct {
+		response string
+		want     string
+	}{
+		{response: "+PONG\r\n", want: "+PONG"},
+		{response: "220 first\r\n220 second\r\n", want: "220 first"},
+		{response: "\x00\x10", want: "0x0010"},
+		{response: "ok\x1b[0m", want: "0x6f6b1b5b306d"},
+	}
+	for _, tt := range tests {
+		if got := quoteResponse([]byte(tt.response)); got != tt.want {
+			t.Errorf("quoteResponse(%q) = %q, want %q", tt.response, got, tt.want)
+		}
+	}
+}
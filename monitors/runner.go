@@ -3,13 +3,13 @@ package monitors
 import (
 	"cartographer-go-agent/common"
 	"cartographer-go-agent/configuration"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"time"
-
-	"github.com/nats-io/nats.go"
 )
 
 // MonitorStatus represents the status of a monitor check
@@ -38,6 +38,11 @@ type MonitorResult struct {
 	Message    string        `json:"message"`
 	Timestamp  string        `json:"timestamp"`
 	DurationMs int64         `json:"duration_ms"`
+	Metrics    []Metric      `json:"metrics,omitempty"`
+	// Certificates is the chain a tls monitor was presented, leaf first
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+	// State is the monitor's status history, set on scheduled runs
+	State *MonitorState `json:"state,omitempty"`
 
 	// Technical config - HOW it works
 	Config MonitorConfig `json:"config"`
@@ -50,6 +55,14 @@ type MonitorConfig struct {
 	Retries    int `json:"retries"`
 	RetryDelay int `json:"retry_delay"`
 
+	// Scheduling
+	Interval int    `json:"interval,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+
+	// Alerting
+	MaxCheckAttempts int         `json:"max_check_attempts,omitempty"`
+	Thresholds       *Thresholds `json:"thresholds,omitempty"`
+
 	// HTTP-specific
 	URL             string            `json:"url,omitempty"`
 	Method          string            `json:"method,omitempty"`
@@ -63,6 +76,9 @@ type MonitorConfig struct {
 	Port     int    `json:"port,omitempty"`
 	Host     string `json:"host,omitempty"`
 	Protocol string `json:"protocol,omitempty"`
+	Send     string `json:"send,omitempty"`
+	SendHex  string `json:"send_hex,omitempty"`
+	Probe    string `json:"probe,omitempty"`
 
 	// Systemd-specific
 	Target string `json:"target,omitempty"`
@@ -70,6 +86,24 @@ type MonitorConfig struct {
 	// Command-specific
 	Command    string `json:"command,omitempty"`
 	WorkingDir string `json:"working_dir,omitempty"`
+	OutputMode string `json:"output_mode,omitempty"`
+
+	// DNS-specific
+	Query      string `json:"query,omitempty"`
+	RecordType string `json:"record_type,omitempty"`
+	Resolver   string `json:"resolver,omitempty"`
+	DNSSEC     bool   `json:"dnssec,omitempty"`
+
+	// TLS-specific
+	ServerName string `json:"server_name,omitempty"`
+	StartTLS   string `json:"starttls,omitempty"`
+	CAFile     string `json:"ca_file,omitempty"`
+
+	// Ping-specific
+	Count int `json:"count,omitempty"`
+
+	// Traceroute-specific
+	MaxHops int `json:"max_hops,omitempty"`
 }
 
 // MonitorReport represents the full report sent to cartographer
@@ -78,96 +112,61 @@ type MonitorReport struct {
 	Monitors []MonitorResult `json:"monitors"`
 }
 
-// Run is the main entry point for the monitoring system
-func Run(config configuration.Config, version string, nc *nats.Conn) {
-	slog.Info("Starting monitoring system",
-		slog.String("monitors_dir", config.MonitorsDir),
-		slog.String("version", version),
-	)
-
-	// Get FQDN for reporting
-	fqdn := getFQDN(config)
-
-	// Main monitoring loop - run every minute
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	// Run immediately on start
-	runMonitoringCycle(config, fqdn, nc)
-
-	// Then run every minute
-	for range ticker.C {
-		runMonitoringCycle(config, fqdn, nc)
-	}
-}
-
-// runMonitoringCycle executes one complete monitoring cycle
-func runMonitoringCycle(config configuration.Config, fqdn string, nc *nats.Conn) {
-	slog.Debug("Starting monitoring cycle")
+// ErrMonitorNotFound is returned by RunMonitor when no monitor has the requested name
+var ErrMonitorNotFound = errors.New("monitor not found")
 
-	// Load monitor configurations
+// RunMonitor loads the monitors from config.MonitorsDir and executes the one named name
+// immediately, with the same retry logic as the scheduled cycle. If ctx is done before
+// the check finishes, the check is cancelled and an error wrapping ctx.Err() is returned.
+func RunMonitor(ctx context.Context, config configuration.Config, name string) (MonitorResult, error) {
 	monitors, loadErrors := LoadMonitors(config.MonitorsDir)
-
-	// Log any load errors but continue with valid monitors
-	for _, err := range loadErrors {
-		slog.Error("Monitor configuration error", slog.String("error", err.Error()))
-	}
-
-	if len(monitors) == 0 {
-		slog.Debug("No monitors configured, skipping cycle")
-		return
-	}
-
-	slog.Info("Executing monitors", slog.Int("count", len(monitors)))
-
-	// Execute all monitors and collect results
-	var results []MonitorResult
 	for _, monitor := range monitors {
-		result := executeMonitor(monitor)
-		results = append(results, result)
-
-		// Log the result
-		slog.Info("Monitor executed",
+		if monitor.Name != name {
+			continue
+		}
+		result := executeMonitor(ctx, monitor)
+		if err := ctx.Err(); err != nil {
+			return result, fmt.Errorf("monitor %s did not finish: %w", name, err)
+		}
+		slog.Info("Monitor executed on demand",
 			slog.String("name", monitor.Name),
 			slog.String("type", monitor.Type),
 			slog.String("status", string(result.Status)),
-			slog.String("message", result.Message),
 			slog.Int64("duration_ms", result.DurationMs),
 		)
+		return result, nil
 	}
 
-	// Add any load errors as UNKNOWN status monitors
-	for _, err := range loadErrors {
-		results = append(results, MonitorResult{
-			Name:       "config_error",
-			Type:       "config",
-			Status:     StatusUnknown,
-			Message:    err.Error(),
-			Timestamp:  time.Now().UTC().Format(time.RFC3339),
-			DurationMs: 0,
-		})
+	// The monitor may exist in a file that failed to load
+	if len(loadErrors) > 0 {
+		return MonitorResult{}, fmt.Errorf("%w: %s (%d monitor files failed to load: %v)", ErrMonitorNotFound, name, len(loadErrors), errors.Join(loadErrors...))
 	}
+	return MonitorResult{}, fmt.Errorf("%w: %s", ErrMonitorNotFound, name)
+}
 
-	// Create report
-	report := MonitorReport{
-		FQDN:     fqdn,
-		Monitors: results,
+// RunAllMonitors loads the monitors from config.MonitorsDir and executes them all
+// immediately, in parallel within the configured concurrency limits. Results are in
+// definition order; monitor files that failed to load are returned as an error alongside them.
+// Checks still running when ctx is done are cancelled and reported as an error.
+func RunAllMonitors(ctx context.Context, config configuration.Config) ([]MonitorResult, error) {
+	monitors, loadErrors := LoadMonitors(config.MonitorsDir)
+	results := newWorkerPool(config).runAll(ctx, monitors)
+	if err := ctx.Err(); err != nil {
+		return results, fmt.Errorf("monitors did not finish: %w", err)
 	}
-
-	// Send report via NATS
-	if err := sendReport(config, report, nc); err != nil {
-		slog.Error("Failed to send monitoring report", slog.String("error", err.Error()))
-	} else {
-		slog.Debug("Monitoring report sent successfully")
+	slog.Info("Monitors executed on demand", slog.Int("count", len(results)))
+	if len(loadErrors) > 0 {
+		return results, fmt.Errorf("%d monitor files failed to load: %w", len(loadErrors), errors.Join(loadErrors...))
 	}
+	return results, nil
 }
 
-// executeMonitor runs a single monitor with retry logic
-func executeMonitor(monitor Monitor) MonitorResult {
+// executeMonitor runs a single monitor with retry logic. Retries stop once ctx is done.
+func executeMonitor(ctx context.Context, monitor Monitor) MonitorResult {
 	var lastResult MonitorResult
 
 	// Initial attempt (always runs once)
-	lastResult = runMonitorCheck(monitor)
+	lastResult = runMonitorCheck(ctx, monitor)
 
 	// If OK or no retries configured, return immediately
 	if lastResult.Status == StatusOK || monitor.Retries == 0 {
@@ -182,12 +181,12 @@ func executeMonitor(monitor Monitor) MonitorResult {
 			slog.Int("max_retries", monitor.Retries),
 		)
 
-		if monitor.RetryDelay > 0 {
-			time.Sleep(time.Duration(monitor.RetryDelay) * time.Second)
+		if !common.SleepContext(ctx, time.Duration(monitor.RetryDelay)*time.Second) {
+			break
 		}
 
 		// Execute the appropriate monitor type
-		lastResult = runMonitorCheck(monitor)
+		lastResult = runMonitorCheck(ctx, monitor)
 
 		// If OK, no need to continue retrying
 		if lastResult.Status == StatusOK {
@@ -198,21 +197,31 @@ func executeMonitor(monitor Monitor) MonitorResult {
 	return lastResult
 }
 
-func runMonitorCheck(monitor Monitor) MonitorResult {
+func runMonitorCheck(ctx context.Context, monitor Monitor) MonitorResult {
 	start := time.Now()
 
 	var status MonitorStatus
 	var message string
+	var metrics []Metric
+	var certificates []CertificateInfo
 
 	switch monitor.Type {
 	case "http":
-		status, message = checkHTTP(monitor)
+		status, message, metrics = checkHTTP(ctx, monitor)
 	case "port":
-		status, message = checkPort(monitor)
+		status, message, metrics = checkPort(ctx, monitor)
 	case "systemd":
-		status, message = checkSystemd(monitor)
+		status, message, metrics = checkSystemd(ctx, monitor)
 	case "command":
-		status, message = checkCommand(monitor)
+		status, message, metrics = checkCommand(ctx, monitor)
+	case "dns":
+		status, message, metrics = checkDNS(ctx, monitor)
+	case "tls":
+		status, message, metrics, certificates = checkTLS(ctx, monitor)
+	case "ping":
+		status, message, metrics = checkPing(ctx, monitor)
+	case "traceroute":
+		status, message, metrics = checkTraceroute(ctx, monitor)
 	default:
 		status = StatusUnknown
 		message = fmt.Sprintf("Unknown monitor type: %s", monitor.Type)
@@ -222,22 +231,39 @@ func runMonitorCheck(monitor Monitor) MonitorResult {
 
 	// Build technical config (no metadata)
 	config := MonitorConfig{
-		Timeout:         monitor.Timeout,
-		Retries:         monitor.Retries,
-		RetryDelay:      monitor.RetryDelay,
-		URL:             monitor.URL,
-		Method:          monitor.Method,
-		Headers:         monitor.Headers,
-		Body:            monitor.Body,
-		VerifyTLS:       monitor.VerifyTLS,
-		FollowRedirects: monitor.FollowRedirects,
-		Validations:     monitor.Validations,
-		Port:            monitor.Port,
-		Host:            monitor.Host,
-		Protocol:        monitor.Protocol,
-		Target:          monitor.Target,
-		Command:         monitor.Command,
-		WorkingDir:      monitor.WorkingDir,
+		Timeout:          monitor.Timeout,
+		Retries:          monitor.Retries,
+		RetryDelay:       monitor.RetryDelay,
+		Interval:         monitor.Interval,
+		Schedule:         monitor.Schedule,
+		MaxCheckAttempts: monitor.MaxCheckAttempts,
+		Thresholds:       monitor.Thresholds,
+		URL:              monitor.URL,
+		Method:           monitor.Method,
+		Headers:          monitor.Headers,
+		Body:             monitor.Body,
+		VerifyTLS:        monitor.VerifyTLS,
+		FollowRedirects:  monitor.FollowRedirects,
+		Validations:      monitor.Validations,
+		Port:             monitor.Port,
+		Host:             monitor.Host,
+		Protocol:         monitor.Protocol,
+		Send:             monitor.Send,
+		SendHex:          monitor.SendHex,
+		Probe:            monitor.Probe,
+		Target:           monitor.Target,
+		Command:          monitor.Command,
+		WorkingDir:       monitor.WorkingDir,
+		OutputMode:       monitor.OutputMode,
+		Query:            monitor.Query,
+		RecordType:       monitor.RecordType,
+		Resolver:         monitor.Resolver,
+		DNSSEC:           monitor.DNSSEC,
+		ServerName:       monitor.ServerName,
+		StartTLS:         monitor.StartTLS,
+		CAFile:           monitor.CAFile,
+		Count:            monitor.Count,
+		MaxHops:          monitor.MaxHops,
 	}
 
 	return MonitorResult{
@@ -254,6 +280,9 @@ func runMonitorCheck(monitor Monitor) MonitorResult {
 		Message:    message,
 		Timestamp:  time.Now().UTC().Format(time.RFC3339),
 		DurationMs: duration,
+		Metrics:    metrics,
+
+		Certificates: certificates,
 
 		// Technical config
 		Config: config,
@@ -261,7 +290,7 @@ func runMonitorCheck(monitor Monitor) MonitorResult {
 }
 
 // sendReport publishes the monitor report via NATS
-func sendReport(config configuration.Config, report MonitorReport, nc *nats.Conn) error {
+func sendReport(config configuration.Config, report MonitorReport, pub *common.Publisher) error {
 	if config.DRYRUN {
 		jsonData, _ := json.MarshalIndent(report, "", "  ")
 		fmt.Println("DRYRUN - Would send monitoring report:")
@@ -269,7 +298,7 @@ func sendReport(config configuration.Config, report MonitorReport, nc *nats.Conn
 		return nil
 	}
 
-	return common.PublishJSON(nc, "agent.monitoring", report, false)
+	return pub.PublishJSON("agent.monitoring", report, false)
 }
 
 // getFQDN returns the FQDN for this agent, using config override if set
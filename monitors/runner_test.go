@@ -1,7 +1,13 @@
 package monitors
 
 import (
+	"cartographer-go-agent/configuration"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // TestRetryConfiguration tests that retry configuration is properly set
@@ -149,3 +155,89 @@ func TestMonitorReportStructure(t *testing.T) {
 		t.Errorf("expected 2 monitors, got %d", len(report.Monitors))
 	}
 }
+
+func TestRunMonitor(t *testing.T) {
+	dir := t.TempDir()
+	content := `monitors:
+  - name: echo_test
+    type: command
+    command: "echo hello"
+    validations:
+      output_contains: hello
+`
+	if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := configuration.Config{MonitorsDir: dir}
+
+	result, err := RunMonitor(context.Background(), config, "echo_test")
+	if err != nil {
+		t.Fatalf("RunMonitor() error = %v", err)
+	}
+	if result.Name != "echo_test" || result.Status != StatusOK {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	if _, err := RunMonitor(context.Background(), config, "missing"); !errors.Is(err, ErrMonitorNotFound) {
+		t.Errorf("expected ErrMonitorNotFound, got %v", err)
+	}
+}
+
+func TestRunMonitor_ContextDeadline(t *testing.T) {
+	dir := t.TempDir()
+	content := `monitors:
+  - name: slow
+    type: command
+    command: "sleep 30"
+    timeout: 60
+    retries: 2
+    retry_delay: 30
+`
+	if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := configuration.Config{MonitorsDir: dir}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := RunMonitor(ctx, config, "slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunMonitor() took %s after its deadline", elapsed)
+	}
+}
+
+func TestMonitoring_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeMonitor := func(file, name string) {
+		content := "monitors:\n  - name: " + name + "\n    type: command\n    command: \"true\"\n"
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enabled, disabled := true, false
+	config := configuration.Config{MonitorsDir: dir, EnableMonitoring: &enabled}
+
+	writeMonitor("a.yaml", "first")
+	monitoring := NewMonitoring(config, "1.0.0", nil)
+	if len(monitoring.monitors) != 1 {
+		t.Fatalf("expected 1 monitor, got %d", len(monitoring.monitors))
+	}
+
+	// Definitions are only re-read on Reload
+	writeMonitor("b.yaml", "second")
+	if len(monitoring.monitors) != 1 {
+		t.Fatalf("expected definitions to be cached, got %d monitors", len(monitoring.monitors))
+	}
+	if count, loadErrors := monitoring.Reload(config); count != 2 || len(loadErrors) != 0 {
+		t.Errorf("Reload() = %d, %v, want 2 monitors", count, loadErrors)
+	}
+
+	config.EnableMonitoring = &disabled
+	if count, _ := monitoring.Reload(config); count != 0 {
+		t.Errorf("expected no monitors while disabled, got %d", count)
+	}
+}
@@ -0,0 +1,333 @@
+package monitors
+
+import (
+	"cartographer-go-agent/common"
+	"cartographer-go-agent/configuration"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+)
+
+// reportInterval is how often the results of the monitors that ran are published to
+// agent.monitoring as one report, along with any monitor load errors
+const reportInterval = time.Minute
+
+// Monitoring runs each monitor on its own schedule, so a slow check doesn't delay the
+// others. Monitor definitions are loaded from the monitors directory at start and on
+// Reload, rather than before every run. Results are batched and published once per
+// report cycle, while state transitions are published as they happen.
+type Monitoring struct {
+	version string
+	pub     *common.Publisher
+	// report publishes results and publishEvents state transitions; replaced in tests
+	report         func(configuration.Config, MonitorReport)
+	publishEvents  func(configuration.Config, []MonitorEvent)
+	reportInterval time.Duration
+	// states is the status history of each monitor, loaded from the state file at start
+	states *stateTracker
+
+	mu         sync.Mutex
+	config     configuration.Config
+	monitors   []Monitor
+	loadErrors []error
+	// pending holds the latest result of each monitor that ran since the last report
+	pending []MonitorResult
+	// pool limits how many scheduled checks run at once
+	pool *workerPool
+
+	// jobsMu guards the scheduler, the context checks run with and the job of each
+	// scheduled monitor
+	jobsMu    sync.Mutex
+	scheduler gocron.Scheduler
+	checkCtx  context.Context
+	jobs      map[string]scheduledMonitor
+}
+
+// scheduledMonitor is the definition a job was created from, to detect changes on reload
+type scheduledMonitor struct {
+	monitor Monitor
+	job     gocron.Job
+}
+
+// NewMonitoring loads the monitor definitions for config
+func NewMonitoring(config configuration.Config, version string, pub *common.Publisher) *Monitoring {
+	m := &Monitoring{
+		version: version,
+		pub:     pub,
+		states:  newStateTracker(config.GetMonitorStateFile()),
+		jobs:    make(map[string]scheduledMonitor),
+
+		reportInterval: reportInterval,
+	}
+	m.report = m.sendReport
+	m.publishEvents = m.sendEvents
+	m.Reload(config)
+	return m
+}
+
+// Reload applies config and re-reads the monitor definitions. Jobs are only replaced for
+// monitors that were added, removed or changed. It returns the number of monitors loaded
+// and any load errors.
+func (m *Monitoring) Reload(config configuration.Config) (int, []error) {
+	var monitors []Monitor
+	var loadErrors []error
+	if config.IsMonitoringEnabled() {
+		monitors, loadErrors = LoadMonitors(config.MonitorsDir)
+		for _, err := range loadErrors {
+			slog.Error("Monitor configuration error", slog.String("error", err.Error()))
+		}
+	}
+
+	m.mu.Lock()
+	m.config = config
+	m.monitors = monitors
+	m.loadErrors = loadErrors
+	// Checks already running finish in the old pool
+	if m.pool == nil || !m.pool.matches(config) {
+		m.pool = newWorkerPool(config)
+	}
+	m.mu.Unlock()
+	slog.Debug("Loaded monitors", slog.Int("count", len(monitors)), slog.Int("errors", len(loadErrors)))
+
+	// Keep the state of monitors in files that failed to load, they may come back
+	if len(loadErrors) == 0 {
+		m.states.prune(monitors)
+	}
+
+	m.syncJobs()
+	return len(monitors), loadErrors
+}
+
+// Run schedules the monitors and runs them until ctx is done. Checks that are running
+// when ctx is cancelled get the shutdown grace period to finish and are cancelled after it.
+func (m *Monitoring) Run(ctx context.Context) {
+	m.mu.Lock()
+	config := m.config
+	m.mu.Unlock()
+	slog.Info("Starting monitoring system",
+		slog.String("monitors_dir", config.MonitorsDir),
+		slog.String("version", m.version),
+	)
+
+	checkCtx, cancelChecks := common.WithGracePeriod(ctx, config.GetShutdownGrace())
+	defer cancelChecks()
+
+	scheduler, err := gocron.NewScheduler(gocron.WithStopTimeout(config.GetShutdownGrace()))
+	if err != nil {
+		slog.Error("Error creating monitoring scheduler", slog.String("error", err.Error()))
+		return
+	}
+
+	// Publish the results of each cycle, and keep reporting broken monitor files until
+	// they are fixed
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(m.reportInterval),
+		gocron.NewTask(m.flushReport),
+	)
+	if err != nil {
+		slog.Error("Error scheduling monitoring report job", slog.String("error", err.Error()))
+	}
+
+	m.jobsMu.Lock()
+	m.scheduler = scheduler
+	m.checkCtx = checkCtx
+	m.jobsMu.Unlock()
+	m.syncJobs()
+	scheduler.Start()
+
+	<-ctx.Done()
+	if err := scheduler.Shutdown(); err != nil {
+		slog.Warn("Monitor checks did not finish in time", slog.String("error", err.Error()))
+	}
+	// Publish the checks that finished since the last report
+	m.flushReport()
+	slog.Info("Monitoring system stopped")
+}
+
+// syncJobs makes the scheduled jobs match the loaded monitors. It does nothing until Run
+// has created the scheduler.
+func (m *Monitoring) syncJobs() {
+	m.mu.Lock()
+	monitors := m.monitors
+	m.mu.Unlock()
+
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	if m.scheduler == nil {
+		return
+	}
+
+	wanted := make(map[string]Monitor, len(monitors))
+	for _, monitor := range monitors {
+		wanted[monitor.Name] = monitor
+	}
+	for name, scheduled := range m.jobs {
+		if monitor, ok := wanted[name]; ok && reflect.DeepEqual(monitor, scheduled.monitor) {
+			continue
+		}
+		if err := m.scheduler.RemoveJob(scheduled.job.ID()); err != nil {
+			slog.Warn("Failed to remove monitor job", slog.String("name", name), slog.String("error", err.Error()))
+		}
+		delete(m.jobs, name)
+	}
+
+	for _, monitor := range monitors {
+		if _, ok := m.jobs[monitor.Name]; ok {
+			continue
+		}
+		job, err := m.scheduler.NewJob(
+			jobDefinition(monitor),
+			gocron.NewTask(m.runScheduled, m.checkCtx, monitor),
+			jobOptions(monitor)...,
+		)
+		if err != nil {
+			slog.Error("Error scheduling monitor",
+				slog.String("name", monitor.Name),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		m.jobs[monitor.Name] = scheduledMonitor{monitor: monitor, job: job}
+	}
+}
+
+// jobDefinition returns the gocron schedule for a monitor
+func jobDefinition(monitor Monitor) gocron.JobDefinition {
+	if monitor.Schedule != "" {
+		return gocron.CronJob(monitor.Schedule, false)
+	}
+	interval := monitor.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return gocron.DurationJob(time.Duration(interval) * time.Second)
+}
+
+func jobOptions(monitor Monitor) []gocron.JobOption {
+	options := []gocron.JobOption{
+		gocron.WithName(monitor.Name),
+		// A run that overlaps the previous one is skipped rather than queued
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	}
+	// Interval monitors run as soon as they are loaded; cron schedules wait for their next slot
+	if monitor.Schedule == "" {
+		options = append(options, gocron.WithStartAt(gocron.WithStartImmediately()))
+	}
+	return options
+}
+
+// runScheduled executes a monitor, once the pool has a free slot, queues its result for
+// the next report and publishes any state transitions. A check cancelled by ctx is
+// discarded rather than recorded as a failure.
+func (m *Monitoring) runScheduled(ctx context.Context, monitor Monitor) {
+	m.mu.Lock()
+	pool := m.pool
+	m.mu.Unlock()
+
+	// Scheduled checks are bounded by their own timeout, and on shutdown by the grace period
+	result := pool.run(ctx, monitor)
+	if err := ctx.Err(); err != nil {
+		slog.Warn("Monitor check cancelled at shutdown",
+			slog.String("name", monitor.Name),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	state, events := m.states.update(monitor, result, time.Now())
+	m.states.save()
+	result.State = &state
+	slog.Info("Monitor executed",
+		slog.String("name", monitor.Name),
+		slog.String("type", monitor.Type),
+		slog.String("status", string(result.Status)),
+		slog.String("message", result.Message),
+		slog.Int64("duration_ms", result.DurationMs),
+	)
+
+	m.mu.Lock()
+	config := m.config
+	m.pending = addResult(m.pending, result)
+	m.mu.Unlock()
+	fqdn := getFQDN(config)
+
+	for i := range events {
+		events[i].FQDN = fqdn
+		slog.Info("Monitor state changed",
+			slog.String("name", monitor.Name),
+			slog.String("event", events[i].Event),
+			slog.String("previous_status", string(events[i].PreviousStatus)),
+			slog.String("status", string(events[i].Status)),
+			slog.Bool("flapping", events[i].Flapping),
+		)
+	}
+	if len(events) > 0 {
+		m.publishEvents(config, events)
+	}
+}
+
+// addResult adds result to pending, replacing an earlier result of the same monitor
+func addResult(pending []MonitorResult, result MonitorResult) []MonitorResult {
+	for i := range pending {
+		if pending[i].Name == result.Name {
+			pending[i] = result
+			return pending
+		}
+	}
+	return append(pending, result)
+}
+
+// flushReport publishes the results queued since the last report as one MonitorReport,
+// with monitor files that failed to load as UNKNOWN results. Nothing is published if
+// no monitor ran and all files loaded.
+func (m *Monitoring) flushReport() {
+	m.mu.Lock()
+	config, loadErrors, results := m.config, m.loadErrors, m.pending
+	m.pending = nil
+	m.mu.Unlock()
+	if len(results) == 0 && len(loadErrors) == 0 {
+		return
+	}
+
+	for _, err := range loadErrors {
+		results = append(results, MonitorResult{
+			Name:       "config_error",
+			Type:       "config",
+			Status:     StatusUnknown,
+			Message:    err.Error(),
+			Timestamp:  time.Now().UTC().Format(time.RFC3339),
+			DurationMs: 0,
+		})
+	}
+	m.report(config, MonitorReport{FQDN: getFQDN(config), Monitors: results})
+}
+
+func (m *Monitoring) sendReport(config configuration.Config, report MonitorReport) {
+	if err := sendReport(config, report, m.pub); err != nil {
+		slog.Error("Failed to send monitoring report", slog.String("error", err.Error()))
+	} else {
+		slog.Debug("Monitoring report sent successfully")
+	}
+}
+
+func (m *Monitoring) sendEvents(config configuration.Config, events []MonitorEvent) {
+	for _, event := range events {
+		if config.DRYRUN {
+			jsonData, _ := json.MarshalIndent(event, "", "  ")
+			fmt.Println("DRYRUN - Would send monitor event:")
+			fmt.Println(string(jsonData))
+			continue
+		}
+		if err := m.pub.PublishJSON(eventsSubject, event, false); err != nil {
+			slog.Error("Failed to send monitor event",
+				slog.String("name", event.Name),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
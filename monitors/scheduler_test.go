@@ -0,0 +1,209 @@
+package monitors
+
+import (
+	"cartographer-go-agent/configuration"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startMonitoring runs Monitoring on dir and records the names of reported monitors
+func startMonitoring(t *testing.T, dir string) (*Monitoring, func() map[string]int) {
+	t.Helper()
+	enabled := true
+	config := configuration.Config{
+		MonitorsDir:          dir,
+		EnableMonitoring:     &enabled,
+		ShutdownGraceSeconds: 5,
+		MonitorStateFile:     filepath.Join(t.TempDir(), "monitor-state.json"),
+	}
+	m := NewMonitoring(config, "1.0.0", nil)
+	m.publishEvents = func(configuration.Config, []MonitorEvent) {}
+	m.reportInterval = 50 * time.Millisecond
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	m.report = func(_ configuration.Config, report MonitorReport) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, result := range report.Monitors {
+			counts[result.Name]++
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Wait for the jobs to be scheduled
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.jobsMu.Lock()
+		scheduled := len(m.jobs)
+		m.jobsMu.Unlock()
+		if scheduled > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return m, func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		snapshot := make(map[string]int, len(counts))
+		for name, count := range counts {
+			snapshot[name] = count
+		}
+		return snapshot
+	}
+}
+
+func writeMonitorFile(t *testing.T, dir, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMonitoring_IndependentSchedules(t *testing.T) {
+	dir := t.TempDir()
+	writeMonitorFile(t, dir, "monitors.yaml", `monitors:
+  - name: fast
+    type: command
+    command: "true"
+    interval: 1
+  - name: slow
+    type: command
+    command: "sleep 2"
+    interval: 60
+`)
+
+	_, counts := startMonitoring(t, dir)
+	time.Sleep(1500 * time.Millisecond)
+
+	got := counts()
+	if got["fast"] < 2 {
+		t.Errorf("expected the fast monitor to run at least twice while the slow one runs, got %d", got["fast"])
+	}
+	if got["slow"] != 0 {
+		t.Errorf("expected the slow monitor to still be running, got %d results", got["slow"])
+	}
+}
+
+func TestMonitoring_ReloadOnlyReplacesChangedJobs(t *testing.T) {
+	dir := t.TempDir()
+	writeMonitorFile(t, dir, "a.yaml", "monitors:\n  - name: a\n    type: command\n    command: \"true\"\n")
+	writeMonitorFile(t, dir, "b.yaml", "monitors:\n  - name: b\n    type: command\n    command: \"true\"\n")
+	writeMonitorFile(t, dir, "c.yaml", "monitors:\n  - name: c\n    type: command\n    command: \"true\"\n")
+
+	m, _ := startMonitoring(t, dir)
+	jobIDs := func() map[string]string {
+		m.jobsMu.Lock()
+		defer m.jobsMu.Unlock()
+		ids := make(map[string]string, len(m.jobs))
+		for name, scheduled := range m.jobs {
+			ids[name] = scheduled.job.ID().String()
+		}
+		return ids
+	}
+	before := jobIDs()
+
+	writeMonitorFile(t, dir, "b.yaml", "monitors:\n  - name: b\n    type: command\n    command: \"true\"\n    interval: 15\n")
+	if err := os.Remove(filepath.Join(dir, "c.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	config := m.config
+	m.mu.Unlock()
+	m.Reload(config)
+
+	after := jobIDs()
+	if after["a"] != before["a"] {
+		t.Error("expected the unchanged monitor to keep its job")
+	}
+	if after["b"] == "" || after["b"] == before["b"] {
+		t.Error("expected the changed monitor to be rescheduled")
+	}
+	if _, ok := after["c"]; ok {
+		t.Error("expected the removed monitor to be unscheduled")
+	}
+}
+
+func TestMonitoring_BatchesResultsPerCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeMonitorFile(t, dir, "broken.yaml", "monitors: [")
+	enabled := true
+	config := configuration.Config{MonitorsDir: dir, EnableMonitoring: &enabled, MonitorStateFile: filepath.Join(dir, "state.json")}
+	m := NewMonitoring(config, "1.0.0", nil)
+
+	var reports []MonitorReport
+	m.report = func(_ configuration.Config, report MonitorReport) { reports = append(reports, report) }
+	m.publishEvents = func(configuration.Config, []MonitorEvent) {}
+
+	first := Monitor{Name: "first", Type: "command", Command: "true"}
+	second := Monitor{Name: "second", Type: "command", Command: "echo second"}
+	first.ApplyDefaults()
+	second.ApplyDefaults()
+	m.runScheduled(context.Background(), first)
+	m.runScheduled(context.Background(), second)
+	m.runScheduled(context.Background(), first)
+	m.flushReport()
+
+	if len(reports) != 1 {
+		t.Fatalf("expected one report for the cycle, got %d", len(reports))
+	}
+	var names []string
+	for _, result := range reports[0].Monitors {
+		names = append(names, result.Name)
+	}
+	if len(names) != 3 || names[0] != "first" || names[1] != "second" || names[2] != "config_error" {
+		t.Errorf("expected the latest result of each monitor and the load error, got %v", names)
+	}
+
+	// Load errors are reported every cycle until they are fixed
+	m.flushReport()
+	if len(reports) != 2 || len(reports[1].Monitors) != 1 || reports[1].Monitors[0].Name != "config_error" {
+		t.Errorf("expected only the load error in the next report, got %+v", reports[1:])
+	}
+}
+
+func TestMonitoring_CancelledCheckIsDiscarded(t *testing.T) {
+	dir := t.TempDir()
+	enabled := true
+	config := configuration.Config{MonitorsDir: dir, EnableMonitoring: &enabled, MonitorStateFile: filepath.Join(dir, "state.json")}
+	m := NewMonitoring(config, "1.0.0", nil)
+
+	var reports []MonitorReport
+	var events []MonitorEvent
+	m.report = func(_ configuration.Config, report MonitorReport) { reports = append(reports, report) }
+	m.publishEvents = func(_ configuration.Config, published []MonitorEvent) { events = append(events, published...) }
+
+	// The shutdown grace period is over
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	monitor := Monitor{Name: "slow", Type: "command", Command: "sleep 30"}
+	monitor.ApplyDefaults()
+	start := time.Now()
+	m.runScheduled(ctx, monitor)
+	m.flushReport()
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the check to be cancelled, took %s", elapsed)
+	}
+	if len(reports) != 0 || len(events) != 0 {
+		t.Errorf("expected a cancelled check not to be reported, got %+v and %+v", reports, events)
+	}
+	if _, ok := m.states.states["slow"]; ok {
+		t.Error("expected a cancelled check not to change the monitor state")
+	}
+}
@@ -0,0 +1,290 @@
+package monitors
+
+import (
+	"cartographer-go-agent/common"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Flap detection follows Nagios: the last flapHistorySize results are kept, and the
+// changes between them are weighted from flapOldestWeight for the oldest to
+// flapNewestWeight for the newest. A monitor starts flapping when the weighted
+// percentage reaches its high threshold and stops when it drops below the low one.
+const (
+	flapHistorySize  = 21
+	flapOldestWeight = 0.75
+	flapNewestWeight = 1.25
+
+	// DefaultFlapLowThreshold is the state change percentage below which a monitor stops flapping
+	DefaultFlapLowThreshold = 5.0
+	// DefaultFlapHighThreshold is the state change percentage at which a monitor starts flapping
+	DefaultFlapHighThreshold = 20.0
+)
+
+// eventsSubject receives a MonitorEvent for every state transition
+const eventsSubject = "agent.monitoring.events"
+
+// Event types reported in MonitorEvent.Event
+const (
+	EventStateChange     = "state_change"
+	EventFlappingStarted = "flapping_started"
+	EventFlappingStopped = "flapping_stopped"
+)
+
+// State types, as in Nagios: a failure is soft until it has been seen on max_check_attempts
+// consecutive checks, and then hard. OK states are always hard.
+const (
+	StateTypeSoft = "soft"
+	StateTypeHard = "hard"
+)
+
+// MonitorState is what the agent remembers about a monitor between checks
+type MonitorState struct {
+	Status              MonitorStatus `json:"status"`
+	Since               time.Time     `json:"since"` // when Status was first seen
+	StateType           string        `json:"state_type"`
+	Attempt             int           `json:"attempt"` // consecutive checks with Status, up to max_check_attempts
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	LastOK              time.Time     `json:"last_ok,omitzero"`
+	LastCheck           time.Time     `json:"last_check"`
+	Flapping            bool          `json:"flapping"`
+	PercentStateChange  float64       `json:"percent_state_change"`
+	// History holds the most recent results, oldest first, for flap detection
+	History []MonitorStatus `json:"history,omitempty"`
+}
+
+// MonitorEvent is published to agent.monitoring.events when a monitor changes status, when
+// a soft failure becomes hard, and when it starts or stops flapping. Only hard events
+// should page; a soft state_change back to OK is a blip that recovered on its own.
+type MonitorEvent struct {
+	FQDN     string `json:"fqdn"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Priority string `json:"priority,omitempty"`
+	Event    string `json:"event"`
+
+	Status            MonitorStatus `json:"status"`
+	StateType         string        `json:"state_type"`
+	PreviousStatus    MonitorStatus `json:"previous_status,omitempty"`
+	PreviousStateType string        `json:"previous_state_type,omitempty"`
+	Attempt           int           `json:"attempt"`
+	MaxCheckAttempts  int           `json:"max_check_attempts"`
+	// PreviousDurationSec is how long the previous status lasted
+	PreviousDurationSec int64   `json:"previous_duration_seconds,omitempty"`
+	Message             string  `json:"message"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	Flapping            bool    `json:"flapping"`
+	PercentStateChange  float64 `json:"percent_state_change"`
+	Timestamp           string  `json:"timestamp"`
+}
+
+// stateTracker keeps the state of every monitor and saves it to path after each update,
+// so a restart doesn't turn a long-running failure into a new one
+type stateTracker struct {
+	path string
+
+	mu     sync.Mutex
+	states map[string]*MonitorState
+	// saveFailed avoids logging the same save error on every check
+	saveFailed bool
+}
+
+// newStateTracker loads the state saved at path; a missing or unreadable file starts empty
+func newStateTracker(path string) *stateTracker {
+	t := &stateTracker{path: path, states: make(map[string]*MonitorState)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to read monitor state", slog.String("path", path), slog.String("error", err.Error()))
+		}
+		return t
+	}
+	if err := json.Unmarshal(data, &t.states); err != nil {
+		slog.Warn("Ignoring invalid monitor state file", slog.String("path", path), slog.String("error", err.Error()))
+		t.states = make(map[string]*MonitorState)
+	}
+	// State saved before soft states existed was always hard
+	for _, state := range t.states {
+		if state.StateType == "" {
+			state.StateType, state.Attempt = StateTypeHard, 1
+		}
+	}
+	return t
+}
+
+// update records a result and returns the new state of the monitor and the events its
+// transitions produced. A monitor without previous state is treated as if it was OK, so
+// it only produces an event if it isn't.
+func (t *stateTracker) update(monitor Monitor, result MonitorResult, now time.Time) (MonitorState, []MonitorEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, known := t.states[monitor.Name]
+	if !known {
+		state = &MonitorState{Status: StatusOK, StateType: StateTypeHard, Attempt: 1, Since: now}
+		t.states[monitor.Name] = state
+	}
+	previous := *state
+
+	state.LastCheck = now
+	if result.Status == StatusOK {
+		state.LastOK = now
+		state.ConsecutiveFailures = 0
+	} else {
+		state.ConsecutiveFailures++
+	}
+	if result.Status != state.Status {
+		state.Status = result.Status
+		state.Since = now
+	}
+
+	maxAttempts := max(monitor.MaxCheckAttempts, 1)
+	switch {
+	case result.Status == StatusOK:
+		state.StateType, state.Attempt = StateTypeHard, 1
+	case previous.Status == StatusOK:
+		state.Attempt = 1
+	case previous.StateType == StateTypeSoft:
+		state.Attempt = min(previous.Attempt+1, maxAttempts)
+	}
+	// A hard failure stays hard when it moves between warning and critical
+	if result.Status != StatusOK {
+		hardFailure := previous.Status != StatusOK && previous.StateType == StateTypeHard
+		state.StateType = StateTypeSoft
+		if hardFailure || state.Attempt >= maxAttempts {
+			state.StateType = StateTypeHard
+		}
+	}
+
+	state.History = append(state.History, result.Status)
+	if len(state.History) > flapHistorySize {
+		state.History = state.History[len(state.History)-flapHistorySize:]
+	}
+	state.PercentStateChange = percentStateChange(state.History)
+	low, high := monitor.flapThresholds()
+	switch {
+	case !state.Flapping && state.PercentStateChange >= high:
+		state.Flapping = true
+	case state.Flapping && state.PercentStateChange < low:
+		state.Flapping = false
+	}
+
+	var events []MonitorEvent
+	newEvent := func(kind string) MonitorEvent {
+		return MonitorEvent{
+			Name:                monitor.Name,
+			Type:                monitor.Type,
+			Priority:            monitor.Priority,
+			Event:               kind,
+			Status:              state.Status,
+			StateType:           state.StateType,
+			Attempt:             state.Attempt,
+			MaxCheckAttempts:    maxAttempts,
+			Message:             result.Message,
+			ConsecutiveFailures: state.ConsecutiveFailures,
+			Flapping:            state.Flapping,
+			PercentStateChange:  state.PercentStateChange,
+			Timestamp:           now.UTC().Format(time.RFC3339),
+		}
+	}
+	if previous.Status != state.Status || previous.StateType != state.StateType {
+		event := newEvent(EventStateChange)
+		if known {
+			event.PreviousStatus = previous.Status
+			event.PreviousStateType = previous.StateType
+			if previous.Status != state.Status {
+				event.PreviousDurationSec = int64(now.Sub(previous.Since).Seconds())
+			}
+		}
+		// Recovering from a soft failure is itself soft
+		if state.Status == StatusOK && previous.StateType == StateTypeSoft {
+			event.StateType = StateTypeSoft
+		}
+		events = append(events, event)
+	}
+	if previous.Flapping != state.Flapping {
+		kind := EventFlappingStarted
+		if !state.Flapping {
+			kind = EventFlappingStopped
+		}
+		events = append(events, newEvent(kind))
+	}
+
+	current := *state
+	current.History = nil
+	return current, events
+}
+
+// prune forgets monitors that are no longer defined
+func (t *stateTracker) prune(monitors []Monitor) {
+	defined := make(map[string]bool, len(monitors))
+	for _, monitor := range monitors {
+		defined[monitor.Name] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name := range t.states {
+		if !defined[name] {
+			delete(t.states, name)
+		}
+	}
+}
+
+// save writes the state of all monitors to the state file
+func (t *stateTracker) save() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.writeLocked()
+	if err != nil && !t.saveFailed {
+		slog.Warn("Failed to save monitor state", slog.String("path", t.path), slog.String("error", err.Error()))
+	}
+	t.saveFailed = err != nil
+}
+
+func (t *stateTracker) writeLocked() error {
+	data, err := json.Marshal(t.states)
+	if err != nil {
+		return fmt.Errorf("failed to encode monitor state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	return common.WriteFileAtomic(t.path, data, 0644)
+}
+
+// percentStateChange returns the weighted percentage of results in history that differ
+// from the one before, with recent changes weighted more than old ones. A history shorter
+// than flapHistorySize is scored as if it were preceded by results without changes.
+func percentStateChange(history []MonitorStatus) float64 {
+	comparisons := flapHistorySize - 1
+	offset := comparisons - (len(history) - 1)
+	var weighted float64
+	for i := 1; i < len(history); i++ {
+		if history[i] == history[i-1] {
+			continue
+		}
+		position := offset + i - 1 // 0 for the oldest possible change
+		weighted += flapOldestWeight + float64(position)*(flapNewestWeight-flapOldestWeight)/float64(comparisons-1)
+	}
+	return weighted * 100 / float64(comparisons)
+}
+
+// flapThresholds returns the monitor's flap detection thresholds, or the defaults
+func (m *Monitor) flapThresholds() (float64, float64) {
+	low, high := m.FlapLowThreshold, m.FlapHighThreshold
+	if low == 0 {
+		low = DefaultFlapLowThreshold
+	}
+	if high == 0 {
+		high = DefaultFlapHighThreshold
+	}
+	return low, high
+}
@@ -0,0 +1,207 @@
+package monitors
+
+import (
+	"cartographer-go-agent/configuration"
+	"context"
+	"math"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPercentStateChange(t *testing.T) {
+	alternating := make([]MonitorStatus, flapHistorySize)
+	for i := range alternating {
+		alternating[i] = StatusOK
+		if i%2 == 1 {
+			alternating[i] = StatusCritical
+		}
+	}
+
+	tests := []struct {
+		name    string
+		history []MonitorStatus
+		want    float64
+	}{
+		{name: "empty", history: nil, want: 0},
+		{name: "stable", history: []MonitorStatus{StatusOK, StatusOK, StatusOK}, want: 0},
+		{name: "newest change", history: []MonitorStatus{StatusOK, StatusCritical}, want: 6.25},
+		{name: "oldest change", history: append([]MonitorStatus{StatusCritical}, slices.Repeat([]MonitorStatus{StatusOK}, flapHistorySize-1)...), want: 3.75},
+		{name: "every result changes", history: alternating, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentStateChange(tt.history); math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("percentStateChange() = %.3f, want %.3f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateTracker_Transitions(t *testing.T) {
+	tracker := newStateTracker(filepath.Join(t.TempDir(), "state.json"))
+	monitor := Monitor{Name: "web", Type: "http", Priority: "high"}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	check := func(minute int, status MonitorStatus) (MonitorState, []MonitorEvent) {
+		return tracker.update(monitor, MonitorResult{Name: "web", Status: status}, start.Add(time.Duration(minute)*time.Minute))
+	}
+
+	if _, events := check(0, StatusOK); len(events) != 0 {
+		t.Errorf("expected no event for a first OK result, got %+v", events)
+	}
+	if _, events := check(1, StatusOK); len(events) != 0 {
+		t.Errorf("expected no event without a change, got %+v", events)
+	}
+
+	state, events := check(2, StatusCritical)
+	if len(events) != 1 || events[0].Event != EventStateChange {
+		t.Fatalf("expected a state change event, got %+v", events)
+	}
+	if events[0].PreviousStatus != StatusOK || events[0].Status != StatusCritical || events[0].PreviousDurationSec != 120 {
+		t.Errorf("unexpected event: %+v", events[0])
+	}
+	if !state.Since.Equal(start.Add(2*time.Minute)) || !state.LastOK.Equal(start.Add(time.Minute)) {
+		t.Errorf("unexpected since/last_ok: %+v", state)
+	}
+
+	state, events = check(3, StatusCritical)
+	if len(events) != 0 || state.ConsecutiveFailures != 2 || !state.Since.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("expected an ongoing failure, got %+v (events %+v)", state, events)
+	}
+	if state.History != nil {
+		t.Error("expected the returned state to leave out the history")
+	}
+}
+
+func TestStateTracker_Flapping(t *testing.T) {
+	tracker := newStateTracker(filepath.Join(t.TempDir(), "state.json"))
+	monitor := Monitor{Name: "flappy", Type: "command"}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var started, stopped int
+	run := func(status MonitorStatus) MonitorState {
+		now = now.Add(time.Minute)
+		state, events := tracker.update(monitor, MonitorResult{Status: status}, now)
+		for _, event := range events {
+			switch event.Event {
+			case EventFlappingStarted:
+				started++
+			case EventFlappingStopped:
+				stopped++
+			}
+		}
+		return state
+	}
+
+	for i := range 8 {
+		status := StatusOK
+		if i%2 == 1 {
+			status = StatusCritical
+		}
+		run(status)
+	}
+	if state := run(StatusCritical); !state.Flapping || started != 1 {
+		t.Fatalf("expected flapping after repeated changes, got %+v (started %d)", state, started)
+	}
+
+	// Stable results age the changes out of the window
+	var state MonitorState
+	for range flapHistorySize {
+		state = run(StatusCritical)
+	}
+	if state.Flapping || stopped != 1 {
+		t.Errorf("expected flapping to stop, got %+v (stopped %d)", state, stopped)
+	}
+}
+
+func TestStateTracker_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "monitor-state.json")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker := newStateTracker(path)
+	tracker.update(Monitor{Name: "db"}, MonitorResult{Status: StatusCritical}, now)
+	tracker.update(Monitor{Name: "removed"}, MonitorResult{Status: StatusOK}, now)
+	tracker.prune([]Monitor{{Name: "db"}})
+	tracker.save()
+
+	// After a restart the failure continues instead of starting again
+	restarted := newStateTracker(path)
+	state, events := restarted.update(Monitor{Name: "db"}, MonitorResult{Status: StatusCritical}, now.Add(time.Hour))
+	if len(events) != 0 || state.ConsecutiveFailures != 2 || !state.Since.Equal(now) {
+		t.Errorf("expected the saved state to be restored, got %+v (events %+v)", state, events)
+	}
+	if _, ok := restarted.states["removed"]; ok {
+		t.Error("expected pruned monitors not to be saved")
+	}
+}
+
+func TestMonitoring_PublishesStateChanges(t *testing.T) {
+	dir := t.TempDir()
+	enabled := true
+	config := configuration.Config{MonitorsDir: dir, EnableMonitoring: &enabled, MonitorStateFile: filepath.Join(dir, "state.json")}
+	m := NewMonitoring(config, "1.0.0", nil)
+
+	var reports []MonitorReport
+	var events []MonitorEvent
+	m.report = func(_ configuration.Config, report MonitorReport) { reports = append(reports, report) }
+	m.publishEvents = func(_ configuration.Config, published []MonitorEvent) { events = append(events, published...) }
+
+	monitor := Monitor{Name: "fails", Type: "command", Command: "false"}
+	monitor.ApplyDefaults()
+	monitor.Retries = 0
+	m.runScheduled(context.Background(), monitor)
+	m.flushReport()
+	m.runScheduled(context.Background(), monitor)
+	m.flushReport()
+
+	if len(events) != 1 || events[0].Status != StatusCritical || events[0].FQDN == "" {
+		t.Fatalf("expected a single state change event, got %+v", events)
+	}
+	if state := reports[1].Monitors[0].State; state == nil || state.ConsecutiveFailures != 2 {
+		t.Errorf("expected the result to carry the monitor state, got %+v", state)
+	}
+}
+
+func TestStateTracker_SoftAndHardStates(t *testing.T) {
+	tracker := newStateTracker(filepath.Join(t.TempDir(), "state.json"))
+	monitor := Monitor{Name: "api", Type: "http", MaxCheckAttempts: 3}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		status      MonitorStatus
+		wantType    string
+		wantAttempt int
+		wantEvent   string // state type of the event, or "" for none
+	}
+	steps := []step{
+		{status: StatusOK, wantType: StateTypeHard, wantAttempt: 1},
+		{status: StatusCritical, wantType: StateTypeSoft, wantAttempt: 1, wantEvent: StateTypeSoft},
+		{status: StatusOK, wantType: StateTypeHard, wantAttempt: 1, wantEvent: StateTypeSoft}, // blip recovered
+		{status: StatusCritical, wantType: StateTypeSoft, wantAttempt: 1, wantEvent: StateTypeSoft},
+		{status: StatusWarning, wantType: StateTypeSoft, wantAttempt: 2, wantEvent: StateTypeSoft},
+		{status: StatusCritical, wantType: StateTypeHard, wantAttempt: 3, wantEvent: StateTypeHard},
+		{status: StatusCritical, wantType: StateTypeHard, wantAttempt: 3},
+		{status: StatusWarning, wantType: StateTypeHard, wantAttempt: 3, wantEvent: StateTypeHard},
+		{status: StatusOK, wantType: StateTypeHard, wantAttempt: 1, wantEvent: StateTypeHard},
+	}
+
+	for i, s := range steps {
+		now = now.Add(time.Minute)
+		state, events := tracker.update(monitor, MonitorResult{Status: s.status}, now)
+		if state.StateType != s.wantType || state.Attempt != s.wantAttempt {
+			t.Errorf("step %d: state %s attempt %d, want %s attempt %d", i, state.StateType, state.Attempt, s.wantType, s.wantAttempt)
+		}
+		var eventType string
+		for _, event := range events {
+			if event.Event == EventStateChange {
+				eventType = event.StateType
+			}
+		}
+		if eventType != s.wantEvent {
+			t.Errorf("step %d: event state type %q, want %q", i, eventType, s.wantEvent)
+		}
+	}
+}
@@ -3,38 +3,41 @@
 package monitors
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"os/exec"
 	"strconv"
 	"strings"
 )
 
 // checkSystemd performs a systemd service check
-func checkSystemd(monitor Monitor) (MonitorStatus, string) {
+func checkSystemd(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
 	serviceName := monitor.Target
 
 	// Check if service exists
-	if !serviceExists(serviceName) {
-		return StatusCritical, fmt.Sprintf("Service '%s' does not exist", serviceName)
+	if !serviceExists(ctx, serviceName) {
+		return StatusCritical, fmt.Sprintf("Service '%s' does not exist", serviceName), nil
 	}
+	metrics := serviceMetrics(ctx, serviceName, monitor.Validations.RestartCount)
 
 	// Get service state
-	state, err := getServiceProperty(serviceName, "ActiveState")
+	state, err := getServiceProperty(ctx, serviceName, "ActiveState")
 	if err != nil {
-		return StatusUnknown, fmt.Sprintf("Failed to get service state: %v", err)
+		return StatusUnknown, fmt.Sprintf("Failed to get service state: %v", err), metrics
 	}
 
 	// Check state matches expected
 	expectedState := monitor.Validations.State
 	if state != expectedState {
-		return StatusCritical, fmt.Sprintf("Service state is '%s' (expected '%s')", state, expectedState)
+		return StatusCritical, fmt.Sprintf("Service state is '%s' (expected '%s')", state, expectedState), metrics
 	}
 
 	// Check if service should be enabled
 	if monitor.Validations.Enabled != nil && *monitor.Validations.Enabled {
-		enabledState, err := getServiceProperty(serviceName, "UnitFileState")
+		enabledState, err := getServiceProperty(ctx, serviceName, "UnitFileState")
 		if err != nil {
-			return StatusUnknown, fmt.Sprintf("Failed to get enabled state: %v", err)
+			return StatusUnknown, fmt.Sprintf("Failed to get enabled state: %v", err), metrics
 		}
 
 		// enabled, enabled-runtime, static, and indirect are all considered "enabled"
@@ -46,29 +49,50 @@ func checkSystemd(monitor Monitor) (MonitorStatus, string) {
 		}
 
 		if !validEnabledStates[enabledState] {
-			return StatusWarning, fmt.Sprintf("Service is %s but not enabled (state: %s)", state, enabledState)
+			return StatusWarning, fmt.Sprintf("Service is %s but not enabled (state: %s)", state, enabledState), metrics
 		}
 	}
 
 	// Check restart count if specified
 	if monitor.Validations.RestartCount != nil {
-		restartCount, err := getServiceRestartCount(serviceName)
+		restartCount, err := getServiceRestartCount(ctx, serviceName)
 		if err != nil {
-			return StatusUnknown, fmt.Sprintf("Failed to get restart count: %v", err)
+			return StatusUnknown, fmt.Sprintf("Failed to get restart count: %v", err), metrics
 		}
 
 		maxRestarts := *monitor.Validations.RestartCount
 		if restartCount > maxRestarts {
-			return StatusWarning, fmt.Sprintf("Service has restarted %d times (threshold: %d)", restartCount, maxRestarts)
+			return StatusWarning, fmt.Sprintf("Service has restarted %d times (threshold: %d)", restartCount, maxRestarts), metrics
 		}
 	}
 
-	return StatusOK, fmt.Sprintf("Service '%s' is %s", serviceName, state)
+	return StatusOK, fmt.Sprintf("Service '%s' is %s", serviceName, state), metrics
+}
+
+// serviceMetrics reports the service's restart count and memory usage, leaving out
+// properties systemd doesn't track for the unit
+func serviceMetrics(ctx context.Context, serviceName string, maxRestarts *int) []Metric {
+	var metrics []Metric
+	if restartCount, err := getServiceRestartCount(ctx, serviceName); err == nil {
+		metric := Metric{Name: "restart_count", Value: float64(restartCount), Unit: unitCount}
+		if maxRestarts != nil {
+			warn := float64(*maxRestarts)
+			metric.Warn = &warn
+		}
+		metrics = append(metrics, metric)
+	}
+	// MemoryCurrent is "[not set]", or the maximum uint64 on older systemd, without memory accounting
+	if memory, err := getServiceProperty(ctx, serviceName, "MemoryCurrent"); err == nil {
+		if bytes, err := strconv.ParseUint(memory, 10, 64); err == nil && bytes != math.MaxUint64 {
+			metrics = append(metrics, Metric{Name: "memory_current", Value: float64(bytes), Unit: unitBytes})
+		}
+	}
+	return metrics
 }
 
 // serviceExists checks if a systemd service exists
-func serviceExists(serviceName string) bool {
-	cmd := exec.Command("systemctl", "list-unit-files", serviceName+".service")
+func serviceExists(ctx context.Context, serviceName string) bool {
+	cmd := exec.CommandContext(ctx, "systemctl", "list-unit-files", serviceName+".service")
 	output, err := cmd.Output()
 	if err != nil {
 		return false
@@ -80,8 +104,8 @@ func serviceExists(serviceName string) bool {
 }
 
 // getServiceProperty retrieves a property of a systemd service
-func getServiceProperty(serviceName, property string) (string, error) {
-	cmd := exec.Command("systemctl", "show", serviceName+".service", "--property="+property, "--value")
+func getServiceProperty(ctx context.Context, serviceName, property string) (string, error) {
+	cmd := exec.CommandContext(ctx, "systemctl", "show", serviceName+".service", "--property="+property, "--value")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("systemctl show failed: %w", err)
@@ -91,9 +115,9 @@ func getServiceProperty(serviceName, property string) (string, error) {
 }
 
 // getServiceRestartCount gets the number of times a service has been restarted
-func getServiceRestartCount(serviceName string) (int, error) {
+func getServiceRestartCount(ctx context.Context, serviceName string) (int, error) {
 	// Get NRestarts property from systemctl
-	restartStr, err := getServiceProperty(serviceName, "NRestarts")
+	restartStr, err := getServiceProperty(ctx, serviceName, "NRestarts")
 	if err != nil {
 		return 0, err
 	}
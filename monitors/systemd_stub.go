@@ -2,7 +2,9 @@
 
 package monitors
 
+import "context"
+
 // checkSystemd is not supported on non-Linux platforms
-func checkSystemd(monitor Monitor) (MonitorStatus, string) {
-	return StatusUnknown, "Systemd monitoring is only supported on Linux"
+func checkSystemd(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
+	return StatusUnknown, "Systemd monitoring is only supported on Linux", nil
 }
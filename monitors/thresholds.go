@@ -0,0 +1,180 @@
+package monitors
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Threshold is a warning/critical pair for a measured value. Values at or beyond
+// Critical are CRITICAL and values at or beyond Warning are WARNING. Either may be
+// left out.
+type Threshold struct {
+	Warning  *float64 `yaml:"warning" json:"warning,omitempty"`
+	Critical *float64 `yaml:"critical" json:"critical,omitempty"`
+}
+
+// Thresholds are warning/critical pairs for the values a check measures
+type Thresholds struct {
+	// HTTP: time until the response body was read; DNS: time until the answer arrived
+	ResponseTimeMs *Threshold `yaml:"response_time_ms" json:"response_time_ms,omitempty"`
+	// HTTPS and TLS: days until the certificate expires; lower values are worse
+	CertExpiryDays *Threshold `yaml:"cert_expiry_days" json:"cert_expiry_days,omitempty"`
+	// Command: a number read from stdout, such as a disk usage percentage. Lower values
+	// are worse when critical is below warning.
+	Value *Threshold `yaml:"value" json:"value,omitempty"`
+	// Command: regex whose first capture group (or whole match) is the value; defaults to the whole output
+	ValueRegex string `yaml:"value_regex" json:"value_regex,omitempty"`
+	// Ping: percentage of echo requests without a reply
+	PacketLossPercent *Threshold `yaml:"packet_loss_percent" json:"packet_loss_percent,omitempty"`
+	// Ping: average round trip time; traceroute: round trip time to the destination
+	RTTMs *Threshold `yaml:"rtt_ms" json:"rtt_ms,omitempty"`
+	// Traceroute: hops to the destination
+	Hops *Threshold `yaml:"hops" json:"hops,omitempty"`
+}
+
+// evaluate returns the status for value. With lowerIsWorse, the thresholds are lower bounds.
+func (t *Threshold) evaluate(value float64, lowerIsWorse bool) MonitorStatus {
+	beyond := func(limit *float64) bool {
+		if limit == nil {
+			return false
+		}
+		if lowerIsWorse {
+			return value <= *limit
+		}
+		return value >= *limit
+	}
+	switch {
+	case beyond(t.Critical):
+		return StatusCritical
+	case beyond(t.Warning):
+		return StatusWarning
+	}
+	return StatusOK
+}
+
+// lowerIsWorse reports whether critical is set below warning, i.e. the value should stay high
+func (t *Threshold) lowerIsWorse() bool {
+	return t.Warning != nil && t.Critical != nil && *t.Critical < *t.Warning
+}
+
+// validate checks that the pair is ordered for the given direction
+func (t *Threshold) validate(name string, lowerIsWorse bool) error {
+	if t.Warning == nil && t.Critical == nil {
+		return fmt.Errorf("%s needs a warning or critical threshold", name)
+	}
+	if t.Warning == nil || t.Critical == nil {
+		return nil
+	}
+	if lowerIsWorse && *t.Critical > *t.Warning {
+		return fmt.Errorf("%s critical must not be above warning", name)
+	}
+	if !lowerIsWorse && *t.Critical < *t.Warning {
+		return fmt.Errorf("%s critical must not be below warning", name)
+	}
+	return nil
+}
+
+// validate checks the thresholds that apply to the monitor type
+func (t *Thresholds) validate(monitorType string) error {
+	if t.ResponseTimeMs != nil {
+		if monitorType != "http" && monitorType != "dns" && monitorType != "port" {
+			return fmt.Errorf("response_time_ms thresholds only apply to http, dns and port monitors")
+		}
+		if err := t.ResponseTimeMs.validate("response_time_ms", false); err != nil {
+			return err
+		}
+	}
+	if t.CertExpiryDays != nil {
+		if monitorType != "http" && monitorType != "tls" {
+			return fmt.Errorf("cert_expiry_days thresholds only apply to http and tls monitors")
+		}
+		if err := t.CertExpiryDays.validate("cert_expiry_days", true); err != nil {
+			return err
+		}
+	}
+	if t.Value != nil {
+		if monitorType != "command" {
+			return fmt.Errorf("value thresholds only apply to command monitors")
+		}
+		if err := t.Value.validate("value", t.Value.lowerIsWorse()); err != nil {
+			return err
+		}
+	}
+	if t.ValueRegex != "" {
+		if _, err := regexp.Compile(t.ValueRegex); err != nil {
+			return fmt.Errorf("invalid value_regex: %w", err)
+		}
+	}
+	if t.PacketLossPercent != nil && monitorType != "ping" {
+		return fmt.Errorf("packet_loss_percent thresholds only apply to ping monitors")
+	}
+	if t.RTTMs != nil && monitorType != "ping" && monitorType != "traceroute" {
+		return fmt.Errorf("rtt_ms thresholds only apply to ping and traceroute monitors")
+	}
+	if t.PacketLossPercent != nil {
+		if err := t.PacketLossPercent.validate("packet_loss_percent", false); err != nil {
+			return err
+		}
+	}
+	if t.RTTMs != nil {
+		if err := t.RTTMs.validate("rtt_ms", false); err != nil {
+			return err
+		}
+	}
+	if t.Hops != nil {
+		if monitorType != "traceroute" {
+			return fmt.Errorf("hops thresholds only apply to traceroute monitors")
+		}
+		if err := t.Hops.validate("hops", false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputValue reads the number the value thresholds apply to from command output
+func (t *Thresholds) outputValue(output string) (float64, error) {
+	text := strings.TrimSpace(output)
+	if t.ValueRegex != "" {
+		re, err := regexp.Compile(t.ValueRegex)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value_regex: %w", err)
+		}
+		match := re.FindStringSubmatch(output)
+		if match == nil {
+			return 0, fmt.Errorf("output does not match value_regex '%s'", t.ValueRegex)
+		}
+		text = match[0]
+		if len(match) > 1 {
+			text = match[1]
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(text), "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("no numeric value in output: %s", truncateOutput(text))
+	}
+	return value, nil
+}
+
+// statusSeverity orders statuses from best to worst when combining several checks
+var statusSeverity = map[MonitorStatus]int{
+	StatusOK:       0,
+	StatusWarning:  1,
+	StatusUnknown:  2,
+	StatusCritical: 3,
+}
+
+// worseStatus returns the more severe of two statuses
+func worseStatus(a, b MonitorStatus) MonitorStatus {
+	if statusSeverity[b] > statusSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// formatValue prints a measured value without a trailing .0 for whole numbers
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
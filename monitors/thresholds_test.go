@@ -0,0 +1,110 @@
+package monitors
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func limits(warning, critical float64) *Threshold {
+	return &Threshold{Warning: &warning, Critical: &critical}
+}
+
+func TestThreshold_Evaluate(t *testing.T) {
+	critical := 90.0
+	tests := []struct {
+		name      string
+		threshold *Threshold
+		value     float64
+		want      MonitorStatus
+	}{
+		{name: "below warning", threshold: limits(80, 90), value: 79, want: StatusOK},
+		{name: "at warning", threshold: limits(80, 90), value: 80, want: StatusWarning},
+		{name: "past critical", threshold: limits(80, 90), value: 95, want: StatusCritical},
+		{name: "critical only", threshold: &Threshold{Critical: &critical}, value: 85, want: StatusOK},
+		{name: "lower is worse, healthy", threshold: limits(30, 7), value: 60, want: StatusOK},
+		{name: "lower is worse, warning", threshold: limits(30, 7), value: 20, want: StatusWarning},
+		{name: "lower is worse, critical", threshold: limits(30, 7), value: 3, want: StatusCritical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.threshold.evaluate(tt.value, tt.threshold.lowerIsWorse()); got != tt.want {
+				t.Errorf("evaluate(%v) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThresholds_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		monitorType string
+		thresholds  Thresholds
+		wantError   string
+	}{
+		{name: "http pairs", monitorType: "http", thresholds: Thresholds{ResponseTimeMs: limits(500, 2000), CertExpiryDays: limits(30, 7)}},
+		{name: "response time inverted", monitorType: "http", thresholds: Thresholds{ResponseTimeMs: limits(2000, 500)}, wantError: "critical must not be below warning"},
+		{name: "cert days inverted", monitorType: "http", thresholds: Thresholds{CertExpiryDays: limits(7, 30)}, wantError: "critical must not be above warning"},
+		{name: "value on http", monitorType: "http", thresholds: Thresholds{Value: limits(80, 90)}, wantError: "only apply to command"},
+		{name: "empty pair", monitorType: "command", thresholds: Thresholds{Value: &Threshold{}}, wantError: "needs a warning or critical"},
+		{name: "invalid value regex", monitorType: "command", thresholds: Thresholds{Value: limits(80, 90), ValueRegex: "("}, wantError: "invalid value_regex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.thresholds.validate(tt.monitorType)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestCheckCommand_ValueThresholds(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    string
+		thresholds Thresholds
+		want       MonitorStatus
+	}{
+		{name: "disk percent ok", command: "echo 42%", thresholds: Thresholds{Value: limits(80, 90)}, want: StatusOK},
+		{name: "disk percent warning", command: "echo 85", thresholds: Thresholds{Value: limits(80, 90)}, want: StatusWarning},
+		{name: "disk percent critical", command: "echo 97", thresholds: Thresholds{Value: limits(80, 90)}, want: StatusCritical},
+		{name: "value from regex", command: "echo 'queue depth: 1200 jobs'", thresholds: Thresholds{Value: limits(500, 1000), ValueRegex: `depth: (\d+)`}, want: StatusCritical},
+		{name: "not a number", command: "echo full", thresholds: Thresholds{Value: limits(80, 90)}, want: StatusUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := Monitor{Name: "value", Type: "command", Command: tt.command, Thresholds: &tt.thresholds}
+			monitor.ApplyDefaults()
+			if status, message, _ := checkCommand(context.Background(), monitor); status != tt.want {
+				t.Errorf("status = %s (%s), want %s", status, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHTTP_ResponseTimeThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	monitor := Monitor{Name: "slow", Type: "http", URL: server.URL, Thresholds: &Thresholds{ResponseTimeMs: limits(50, 5000)}}
+	monitor.ApplyDefaults()
+	status, message, _ := checkHTTP(context.Background(), monitor)
+	if status != StatusWarning || !strings.Contains(message, "response took") {
+		t.Errorf("checkHTTP() = %s %q, want a response time warning", status, message)
+	}
+}
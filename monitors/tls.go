@@ -0,0 +1,351 @@
+package monitors
+
+import (
+	"bufio"
+	"cartographer-go-agent/common"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STARTTLS protocols a TLS monitor can upgrade a plaintext connection with
+const (
+	startTLSSMTP     = "smtp"
+	startTLSIMAP     = "imap"
+	startTLSPOP3     = "pop3"
+	startTLSPostgres = "postgres"
+)
+
+// tlsVersions are the values accepted for min_tls_version
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// weakSignatureAlgorithms are rejected in the leaf and intermediate certificates
+var weakSignatureAlgorithms = []x509.SignatureAlgorithm{
+	x509.MD2WithRSA,
+	x509.MD5WithRSA,
+	x509.SHA1WithRSA,
+	x509.DSAWithSHA1,
+	x509.ECDSAWithSHA1,
+}
+
+// Default certificate expiry thresholds for tls monitors, in days
+const (
+	DefaultTLSExpiryWarningDays  = 30
+	DefaultTLSExpiryCriticalDays = 7
+)
+
+// CertificateInfo describes a certificate presented by a server
+type CertificateInfo struct {
+	Position           string    `json:"position"` // leaf, intermediate or root
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serial_number"`
+	DNSNames           []string  `json:"dns_names,omitempty"`
+	IPAddresses        []string  `json:"ip_addresses,omitempty"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	DaysRemaining      int       `json:"days_remaining"`
+	KeyAlgorithm       string    `json:"key_algorithm"`
+	KeyBits            int       `json:"key_bits"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	FingerprintSHA256  string    `json:"fingerprint_sha256"`
+}
+
+// checkTLS connects to host:port, optionally upgrading with STARTTLS, and validates the
+// negotiated version and the certificates the server presents
+func checkTLS(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric, []CertificateInfo) {
+	address := net.JoinHostPort(monitor.Host, strconv.Itoa(monitor.Port))
+	serverName := monitor.ServerName
+	if serverName == "" {
+		serverName = monitor.Host
+	}
+
+	roots, err := tlsRoots(monitor.CAFile)
+	if err != nil {
+		return StatusUnknown, fmt.Sprintf("Failed to load ca_file: %v", err), nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(monitor.Timeout)*time.Second)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return StatusCritical, fmt.Sprintf("TCP connection failed: %v", err), nil, nil
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if monitor.StartTLS != "" {
+		if err := startTLS(conn, monitor.StartTLS); err != nil {
+			return StatusCritical, fmt.Sprintf("STARTTLS (%s) failed: %v", monitor.StartTLS, err), nil, nil
+		}
+	}
+
+	// Verification is done below, so the certificates are reported even when it fails
+	client := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	})
+	start := time.Now()
+	if err := client.HandshakeContext(ctx); err != nil {
+		return StatusCritical, fmt.Sprintf("TLS handshake failed: %v", err), nil, nil
+	}
+	handshakeTime := time.Since(start)
+	state := client.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return StatusCritical, "Server presented no certificate", nil, nil
+	}
+
+	leaf := state.PeerCertificates[0]
+	certificates := describeCertificates(state.PeerCertificates)
+	daysRemaining := certificates[0].DaysRemaining
+	expiryMetric := Metric{Name: "cert_days_remaining", Value: float64(daysRemaining), Unit: unitDays}
+	if monitor.Thresholds != nil {
+		expiryMetric = expiryMetric.withThreshold(monitor.Thresholds.CertExpiryDays)
+	}
+	metrics := []Metric{
+		durationMetric("handshake_time", handshakeTime),
+		expiryMetric,
+		{Name: "key_bits", Value: float64(certificates[0].KeyBits)},
+	}
+	version := tls.VersionName(state.Version)
+	fail := func(format string, args ...any) (MonitorStatus, string, []Metric, []CertificateInfo) {
+		return StatusCritical, fmt.Sprintf(format, args...), metrics, certificates
+	}
+
+	// An expired certificate also fails verification; say so plainly
+	if time.Now().After(leaf.NotAfter) {
+		return fail("Certificate for %s expired on %s", serverName, leaf.NotAfter.UTC().Format(time.DateOnly))
+	}
+
+	// Check the chain and the hostname
+	if monitor.VerifyTLS == nil || *monitor.VerifyTLS {
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+			return fail("Certificate chain is not trusted: %v", err)
+		}
+		if err := leaf.VerifyHostname(serverName); err != nil {
+			return fail("Certificate is not valid for %s: %v", serverName, err)
+		}
+	}
+
+	// Check the negotiated version and the strength of the certificates
+	if v := monitor.Validations; v != nil {
+		if v.MinTLSVersion != "" && state.Version < tlsVersions[v.MinTLSVersion] {
+			return fail("Negotiated %s, below the minimum TLS %s", version, v.MinTLSVersion)
+		}
+		for _, cert := range certificates {
+			if cert.Position == "root" {
+				continue
+			}
+			if v.MinKeyBits > 0 && cert.KeyAlgorithm == x509.RSA.String() && cert.KeyBits < v.MinKeyBits {
+				return fail("%s certificate has a %d bit RSA key (minimum %d)", cert.Position, cert.KeyBits, v.MinKeyBits)
+			}
+			if len(v.SignatureAlgorithms) > 0 && !slices.ContainsFunc(v.SignatureAlgorithms, func(allowed string) bool {
+				return strings.EqualFold(allowed, cert.SignatureAlgorithm)
+			}) {
+				return fail("%s certificate is signed with %s, which is not allowed", cert.Position, cert.SignatureAlgorithm)
+			}
+		}
+	}
+	for i, cert := range certificates {
+		if cert.Position != "root" && slices.Contains(weakSignatureAlgorithms, state.PeerCertificates[i].SignatureAlgorithm) {
+			return fail("%s certificate is signed with the weak %s algorithm", cert.Position, cert.SignatureAlgorithm)
+		}
+	}
+
+	// Check the expiry thresholds
+	message := fmt.Sprintf("%s on %s, certificate for %s expires in %d days (issuer %s)", version, address, serverName, daysRemaining, leaf.Issuer.CommonName)
+	if monitor.Thresholds != nil && monitor.Thresholds.CertExpiryDays != nil {
+		return monitor.Thresholds.CertExpiryDays.evaluate(float64(daysRemaining), true), message, metrics, certificates
+	}
+	return StatusOK, message, metrics, certificates
+}
+
+// tlsRoots returns the CAs in caFile, or nil for the system roots
+func tlsRoots(caFile string) (*x509.CertPool, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return pool, nil
+}
+
+// describeCertificates summarizes the chain as presented, leaf first
+func describeCertificates(chain []*x509.Certificate) []CertificateInfo {
+	infos := make([]CertificateInfo, len(chain))
+	for i, cert := range chain {
+		position := "intermediate"
+		switch {
+		case i == 0:
+			position = "leaf"
+		case cert.Subject.String() == cert.Issuer.String() && cert.CheckSignatureFrom(cert) == nil:
+			position = "root"
+		}
+		keyAlgorithm, keyBits := common.PublicKeyInfo(cert)
+		info := CertificateInfo{
+			Position:           position,
+			Subject:            cert.Subject.String(),
+			Issuer:             cert.Issuer.String(),
+			SerialNumber:       cert.SerialNumber.Text(16),
+			DNSNames:           cert.DNSNames,
+			NotBefore:          cert.NotBefore.UTC(),
+			NotAfter:           cert.NotAfter.UTC(),
+			DaysRemaining:      int(time.Until(cert.NotAfter).Hours() / 24),
+			KeyAlgorithm:       keyAlgorithm,
+			KeyBits:            keyBits,
+			SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+			FingerprintSHA256:  common.CertificateFingerprint(cert),
+		}
+		for _, ip := range cert.IPAddresses {
+			info.IPAddresses = append(info.IPAddresses, ip.String())
+		}
+		infos[i] = info
+	}
+	return infos
+}
+
+// startTLS asks the server to switch the plaintext connection to TLS
+func startTLS(conn net.Conn, protocol string) (err error) {
+	if protocol == startTLSPostgres {
+		// SSLRequest: length 8 and the magic request code 80877103
+		request := binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 8), 80877103)
+		if _, err := conn.Write(request); err != nil {
+			return err
+		}
+		reply := make([]byte, 1)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[0] != 'S' {
+			return fmt.Errorf("server does not support SSL (replied %q)", reply)
+		}
+		return nil
+	}
+
+	// Line based protocols: read the greeting, send the command, read the go-ahead. The
+	// server must wait for the handshake after its go-ahead, so anything left in the
+	// reader's buffer would be lost to the handshake, or was injected before it.
+	reader := bufio.NewReader(conn)
+	defer func() {
+		if err == nil && reader.Buffered() > 0 {
+			err = fmt.Errorf("server sent %d unexpected bytes before the TLS handshake", reader.Buffered())
+		}
+	}()
+	var greeting, command, ready string
+	switch protocol {
+	case startTLSSMTP:
+		if _, err := readSMTPReply(reader, "220"); err != nil {
+			return fmt.Errorf("greeting: %w", err)
+		}
+		if _, err := fmt.Fprintf(conn, "EHLO %s\r\n", localHostname()); err != nil {
+			return err
+		}
+		extensions, err := readSMTPReply(reader, "250")
+		if err != nil {
+			return fmt.Errorf("EHLO: %w", err)
+		}
+		if !slices.ContainsFunc(extensions, func(line string) bool { return strings.EqualFold(line, "STARTTLS") }) {
+			return fmt.Errorf("server does not offer STARTTLS")
+		}
+		if _, err := fmt.Fprint(conn, "STARTTLS\r\n"); err != nil {
+			return err
+		}
+		_, err = readSMTPReply(reader, "220")
+		return err
+	case startTLSIMAP:
+		greeting, command, ready = "* OK", "a001 STARTTLS\r\n", "a001 OK"
+	case startTLSPOP3:
+		greeting, command, ready = "+OK", "STLS\r\n", "+OK"
+	default:
+		return fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	line, err := readLine(reader)
+	if err != nil {
+		return fmt.Errorf("greeting: %w", err)
+	}
+	if !strings.HasPrefix(line, greeting) {
+		return fmt.Errorf("unexpected greeting: %s", truncateOutput(line))
+	}
+	if _, err := fmt.Fprint(conn, command); err != nil {
+		return err
+	}
+	// IMAP servers may send untagged responses before the tagged one
+	for {
+		line, err = readLine(reader)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, ready) {
+			return nil
+		}
+		if protocol != startTLSIMAP || !strings.HasPrefix(line, "* ") {
+			return fmt.Errorf("server refused: %s", truncateOutput(line))
+		}
+	}
+}
+
+// readSMTPReply reads a possibly multi-line reply and checks its code, returning the text
+// of each line
+func readSMTPReply(reader *bufio.Reader, code string) ([]string, error) {
+	var lines []string
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 4 || line[:3] != code {
+			return nil, fmt.Errorf("unexpected reply: %s", truncateOutput(line))
+		}
+		lines = append(lines, line[4:])
+		if line[3] != '-' {
+			return lines, nil
+		}
+	}
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// localHostname names this host in the SMTP EHLO
+func localHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "localhost"
+	}
+	return hostname
+}
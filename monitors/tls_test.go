@@ -0,0 +1,346 @@
+package monitors
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for local TLS listeners
+type testCA struct {
+	cert   *x509.Certificate
+	key    crypto.Signer
+	caFile string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, caFile: caFile}
+}
+
+// leafOptions adjust the certificates the test CA issues
+type leafOptions struct {
+	dnsNames  []string
+	notAfter  time.Time
+	rsaBits   int // RSA key of this size instead of ECDSA P-256
+	signature x509.SignatureAlgorithm
+}
+
+// issue returns a leaf certificate for 127.0.0.1 and the given names, signed by an
+// intermediate that is sent along with it
+func (ca *testCA) issue(t *testing.T, opts leafOptions) tls.Certificate {
+	t.Helper()
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(5, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediateTemplate, ca.cert, intermediateKey.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, _ := x509.ParseCertificate(intermediateDER)
+
+	var key crypto.Signer
+	if opts.rsaBits > 0 {
+		key, err = rsa.GenerateKey(rand.Reader, opts.rsaBits)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.notAfter.IsZero() {
+		opts.notAfter = time.Now().AddDate(0, 0, 90)
+	}
+	template := &x509.Certificate{
+		SerialNumber:       big.NewInt(3),
+		Subject:            pkix.Name{CommonName: "localhost"},
+		DNSNames:           append([]string{"localhost"}, opts.dnsNames...),
+		IPAddresses:        []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           opts.notAfter,
+		KeyUsage:           x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		SignatureAlgorithm: opts.signature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, intermediate, key.Public(), intermediateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der, intermediateDER}, PrivateKey: key}
+}
+
+// startTLSListener serves cert on a local port. The preamble runs on each plaintext
+// connection before the handshake, to play the server side of STARTTLS.
+func startTLSListener(t *testing.T, config *tls.Config, preamble func(net.Conn, *bufio.Reader) bool) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if preamble != nil && !preamble(conn, bufio.NewReader(conn)) {
+					return
+				}
+				server := tls.Server(conn, config)
+				if server.Handshake() == nil {
+					io.Copy(io.Discard, server)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// expect reads a line from the client and reports whether it starts with prefix
+func expect(reader *bufio.Reader, prefix string) bool {
+	line, err := reader.ReadString('\n')
+	return err == nil && strings.HasPrefix(line, prefix)
+}
+
+func smtpPreamble(conn net.Conn, reader *bufio.Reader) bool {
+	io.WriteString(conn, "220-mail.example.com ESMTP\r\n220 ready\r\n")
+	if !expect(reader, "EHLO ") {
+		return false
+	}
+	io.WriteString(conn, "250-mail.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+	if !expect(reader, "STARTTLS") {
+		return false
+	}
+	io.WriteString(conn, "220 2.0.0 Ready to start TLS\r\n")
+	return true
+}
+
+func imapPreamble(conn net.Conn, reader *bufio.Reader) bool {
+	io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n")
+	if !expect(reader, "a001 STARTTLS") {
+		return false
+	}
+	io.WriteString(conn, "* CAPABILITY IMAP4rev1\r\na001 OK Begin TLS negotiation now\r\n")
+	return true
+}
+
+func pop3Preamble(conn net.Conn, reader *bufio.Reader) bool {
+	io.WriteString(conn, "+OK POP3 ready\r\n")
+	if !expect(reader, "STLS") {
+		return false
+	}
+	io.WriteString(conn, "+OK Begin TLS\r\n")
+	return true
+}
+
+// pipelinedPreamble sends data after the go-ahead, before the client starts the handshake
+func pipelinedPreamble(conn net.Conn, reader *bufio.Reader) bool {
+	io.WriteString(conn, "+OK POP3 ready\r\n")
+	if !expect(reader, "STLS") {
+		return false
+	}
+	io.WriteString(conn, "+OK Begin TLS\r\n+OK injected\r\n")
+	return false
+}
+
+func postgresPreamble(reply byte) func(net.Conn, *bufio.Reader) bool {
+	return func(conn net.Conn, reader *bufio.Reader) bool {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(reader, request); err != nil || request[7] != 0x2f {
+			return false
+		}
+		conn.Write([]byte{reply})
+		return reply == 'S'
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	ca := newTestCA(t)
+	valid := ca.issue(t, leafOptions{dnsNames: []string{"mail.example.com"}})
+	skipVerify := false
+
+	tests := []struct {
+		name        string
+		cert        tls.Certificate
+		maxVersion  uint16
+		preamble    func(net.Conn, *bufio.Reader) bool
+		monitor     Monitor
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "valid", cert: valid, monitor: Monitor{}, want: StatusOK, wantMessage: "certificate for 127.0.0.1 expires in 89 days (issuer Test Intermediate CA)"},
+		{name: "server name", cert: valid, monitor: Monitor{ServerName: "mail.example.com"}, want: StatusOK},
+		{name: "wrong server name", cert: valid, monitor: Monitor{ServerName: "www.example.org"}, want: StatusCritical, wantMessage: "not valid for www.example.org"},
+		{name: "untrusted", cert: valid, monitor: Monitor{CAFile: "-"}, want: StatusCritical, wantMessage: "chain is not trusted"},
+		{name: "untrusted without verification", cert: valid, monitor: Monitor{CAFile: "-", VerifyTLS: &skipVerify}, want: StatusOK},
+		{name: "expiring", cert: ca.issue(t, leafOptions{notAfter: time.Now().AddDate(0, 0, 20)}), monitor: Monitor{}, want: StatusWarning, wantMessage: "expires in 19 days"},
+		{name: "nearly expired", cert: ca.issue(t, leafOptions{notAfter: time.Now().AddDate(0, 0, 3)}), monitor: Monitor{}, want: StatusCritical},
+		{name: "custom expiry thresholds", cert: ca.issue(t, leafOptions{notAfter: time.Now().AddDate(0, 0, 20)}), monitor: Monitor{Thresholds: &Thresholds{CertExpiryDays: limits(14, 3)}}, want: StatusOK},
+		{name: "expired", cert: ca.issue(t, leafOptions{notAfter: time.Now().Add(-time.Minute)}), monitor: Monitor{}, want: StatusCritical, wantMessage: "Certificate for 127.0.0.1 expired on"},
+		{name: "tls version below minimum", cert: valid, maxVersion: tls.VersionTLS12, monitor: Monitor{Validations: &Validations{MinTLSVersion: "1.3"}}, want: StatusCritical, wantMessage: "Negotiated TLS 1.2, below the minimum TLS 1.3"},
+		{name: "tls version at minimum", cert: valid, maxVersion: tls.VersionTLS12, monitor: Monitor{Validations: &Validations{MinTLSVersion: "1.2"}}, want: StatusOK},
+		{name: "small rsa key", cert: ca.issue(t, leafOptions{rsaBits: 1024}), monitor: Monitor{Validations: &Validations{MinKeyBits: 2048}}, want: StatusCritical, wantMessage: "leaf certificate has a 1024 bit RSA key (minimum 2048)"},
+		{name: "ecdsa key passes rsa minimum", cert: valid, monitor: Monitor{Validations: &Validations{MinKeyBits: 2048}}, want: StatusOK},
+		{name: "signature algorithm allowed", cert: valid, monitor: Monitor{Validations: &Validations{SignatureAlgorithms: []string{"ecdsa-sha256"}}}, want: StatusOK},
+		{name: "signature algorithm not allowed", cert: ca.issue(t, leafOptions{signature: x509.ECDSAWithSHA384}), monitor: Monitor{Validations: &Validations{SignatureAlgorithms: []string{"ECDSA-SHA256"}}}, want: StatusCritical, wantMessage: "leaf certificate is signed with ECDSA-SHA384, which is not allowed"},
+		{name: "smtp starttls", cert: valid, preamble: smtpPreamble, monitor: Monitor{StartTLS: "smtp"}, want: StatusOK},
+		{name: "imap starttls", cert: valid, preamble: imapPreamble, monitor: Monitor{StartTLS: "imap"}, want: StatusOK},
+		{name: "pop3 starttls", cert: valid, preamble: pop3Preamble, monitor: Monitor{StartTLS: "pop3"}, want: StatusOK},
+		{name: "postgres starttls", cert: valid, preamble: postgresPreamble('S'), monitor: Monitor{StartTLS: "postgres"}, want: StatusOK},
+		{name: "postgres without ssl", cert: valid, preamble: postgresPreamble('N'), monitor: Monitor{StartTLS: "postgres"}, want: StatusCritical, wantMessage: "server does not support SSL"},
+		{name: "data before the handshake", cert: valid, preamble: pipelinedPreamble, monitor: Monitor{StartTLS: "pop3"}, want: StatusCritical, wantMessage: "unexpected bytes before the TLS handshake"},
+		{name: "starttls against the wrong protocol", cert: valid, preamble: imapPreamble, monitor: Monitor{StartTLS: "smtp"}, want: StatusCritical, wantMessage: "STARTTLS (smtp) failed: greeting"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := startTLSListener(t, &tls.Config{Certificates: []tls.Certificate{tt.cert}, MaxVersion: tt.maxVersion}, tt.preamble)
+			monitor := tt.monitor
+			monitor.Name, monitor.Type, monitor.Host, monitor.Port = "tls", "tls", "127.0.0.1", port
+			switch monitor.CAFile {
+			case "":
+				monitor.CAFile = ca.caFile
+			case "-":
+				monitor.CAFile = ""
+			}
+			monitor.ApplyDefaults()
+			if err := monitor.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			status, message, metrics, certificates := checkTLS(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkTLS() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+			if strings.HasPrefix(message, "STARTTLS") {
+				return // no handshake, nothing to report
+			}
+			if len(metrics) != 3 || len(certificates) != 2 {
+				t.Fatalf("checkTLS() returned %d metrics and %d certificates, want 3 and 2", len(metrics), len(certificates))
+			}
+		})
+	}
+}
+
+func TestCheckTLS_Certificates(t *testing.T) {
+	ca := newTestCA(t)
+	port := startTLSListener(t, &tls.Config{Certificates: []tls.Certificate{ca.issue(t, leafOptions{rsaBits: 2048})}}, nil)
+	monitor := Monitor{Name: "tls", Type: "tls", Host: "localhost", Port: port, CAFile: ca.caFile}
+	monitor.ApplyDefaults()
+
+	status, _, metrics, certificates := checkTLS(context.Background(), monitor)
+	if status != StatusOK {
+		t.Fatalf("checkTLS() status = %s", status)
+	}
+	leaf, intermediate := certificates[0], certificates[1]
+	if leaf.Position != "leaf" || leaf.Subject != "CN=localhost" || leaf.Issuer != "CN=Test Intermediate CA" {
+		t.Errorf("unexpected leaf: %+v", leaf)
+	}
+	if leaf.KeyAlgorithm != "RSA" || leaf.KeyBits != 2048 || leaf.SignatureAlgorithm != "ECDSA-SHA256" {
+		t.Errorf("leaf key = %s %d signed %s", leaf.KeyAlgorithm, leaf.KeyBits, leaf.SignatureAlgorithm)
+	}
+	if strings.Join(leaf.DNSNames, ",") != "localhost" || strings.Join(leaf.IPAddresses, ",") != "127.0.0.1" || len(leaf.FingerprintSHA256) != 64 {
+		t.Errorf("unexpected leaf names or fingerprint: %+v", leaf)
+	}
+	if intermediate.Position != "intermediate" || intermediate.Issuer != "CN=Test Root CA" || intermediate.KeyAlgorithm != "ECDSA" || intermediate.KeyBits != 256 {
+		t.Errorf("unexpected intermediate: %+v", intermediate)
+	}
+
+	want := map[string]float64{"cert_days_remaining": 89, "key_bits": 2048}
+	for _, metric := range metrics {
+		if value, ok := want[metric.Name]; ok && metric.Value != value {
+			t.Errorf("metric %s = %v, want %v", metric.Name, metric.Value, value)
+		}
+	}
+	if metrics[1].Warn == nil || *metrics[1].Warn != DefaultTLSExpiryWarningDays {
+		t.Errorf("cert_days_remaining warn = %v, want the default", metrics[1].Warn)
+	}
+}
+
+func TestCheckTLS_HTTPTestServer(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The httptest certificate is valid for example.com and 127.0.0.1 until 2084
+	monitor := Monitor{Name: "tls", Type: "tls", Host: serverURL.Hostname(), Port: port, ServerName: "example.com", CAFile: caFile}
+	monitor.ApplyDefaults()
+	if status, message, _, _ := checkTLS(context.Background(), monitor); status != StatusOK {
+		t.Errorf("checkTLS() = %s %q", status, message)
+	}
+}
+
+func TestCheckTLS_ConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	monitor := Monitor{Name: "tls", Type: "tls", Host: "127.0.0.1", Port: port, Timeout: 2}
+	monitor.ApplyDefaults()
+	if status, message, _, _ := checkTLS(context.Background(), monitor); status != StatusCritical || !strings.Contains(message, "TCP connection failed") {
+		t.Errorf("checkTLS() = %s %q", status, message)
+	}
+}
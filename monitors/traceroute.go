@@ -0,0 +1,226 @@
+package monitors
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// DefaultTracerouteMaxHops is how far a traceroute monitor probes when max_hops is not set
+const DefaultTracerouteMaxHops = 30
+
+// MaxTracerouteHops bounds max_hops
+const MaxTracerouteHops = 64
+
+// tracerouteHopWait is the longest a traceroute waits for the reply to one hop's probe
+var tracerouteHopWait = time.Second
+
+// traceResult is the path found by a traceroute
+type traceResult struct {
+	// hops are the addresses that answered each TTL, nil where no reply arrived
+	hops    []net.IP
+	reached bool
+	// rtt is the round trip time of the probe that reached the destination
+	rtt time.Duration
+}
+
+// path formats the hops like traceroute, with * for hops that didn't reply
+func (r traceResult) path() string {
+	parts := make([]string, len(r.hops))
+	for i, hop := range r.hops {
+		parts[i] = "*"
+		if hop != nil {
+			parts[i] = hop.String()
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+// checkTraceroute probes the path to the host with ICMP echo requests of increasing TTL,
+// and checks that the host is reached and how many hops away it is
+func checkTraceroute(ctx context.Context, monitor Monitor) (MonitorStatus, string, []Metric) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(monitor.Timeout)*time.Second)
+	defer cancel()
+
+	addr, err := resolvePingTarget(ctx, monitor.Host)
+	if err != nil {
+		return StatusCritical, fmt.Sprintf("Failed to resolve %s: %v", monitor.Host, err), nil
+	}
+	result, err := traceroute(ctx, addr, monitor.MaxHops)
+	if err != nil {
+		return StatusUnknown, fmt.Sprintf("Traceroute to %s failed: %v", monitor.Host, err), nil
+	}
+
+	target := monitor.Host
+	if target != addr.String() {
+		target = fmt.Sprintf("%s (%s)", monitor.Host, addr)
+	}
+	if !result.reached {
+		return StatusCritical, fmt.Sprintf("TRACEROUTE %s: not reached within %d hops: %s", target, len(result.hops), result.path()), nil
+	}
+
+	var hopsThreshold, rttThreshold *Threshold
+	if monitor.Thresholds != nil {
+		hopsThreshold, rttThreshold = monitor.Thresholds.Hops, monitor.Thresholds.RTTMs
+	}
+	hops := float64(len(result.hops))
+	rtt := float64(result.rtt.Microseconds()) / 1000
+	metrics := []Metric{
+		Metric{Name: "hops", Value: hops, Unit: unitCount}.withThreshold(hopsThreshold),
+		Metric{Name: "rtt", Value: rtt, Unit: unitMilliseconds}.withThreshold(rttThreshold),
+	}
+	message := fmt.Sprintf("TRACEROUTE %s: reached in %d hops, rtt %.3f ms: %s", target, len(result.hops), rtt, result.path())
+
+	status := StatusOK
+	if hopsThreshold != nil {
+		status = worseStatus(status, hopsThreshold.evaluate(hops, false))
+	}
+	if rttThreshold != nil {
+		status = worseStatus(status, rttThreshold.evaluate(rtt, false))
+	}
+	return status, message, metrics
+}
+
+// traceroute sends one echo request per TTL, from 1 up to maxHops, until addr replies.
+// Routers on the way answer with time exceeded messages, which only raw sockets receive;
+// on an unprivileged datagram socket those hops show as unresponsive, but the hop count
+// to the destination is still found. Each hop waits up to tracerouteHopWait, less if the
+// remaining hops wouldn't fit in the context's deadline.
+func traceroute(ctx context.Context, addr net.IP, maxHops int) (traceResult, error) {
+	v6 := addr.To4() == nil
+	conn, datagram, err := listenICMP(v6, true)
+	if err != nil {
+		return traceResult{}, err
+	}
+	defer conn.Close()
+
+	var dst net.Addr = &net.IPAddr{IP: addr}
+	if datagram {
+		dst = &net.UDPAddr{IP: addr}
+	}
+	var requestType icmp.Type = ipv4.ICMPTypeEcho
+	setTTL := func(ttl int) error { return conn.IPv4PacketConn().SetTTL(ttl) }
+	if v6 {
+		requestType = ipv6.ICMPTypeEchoRequest
+		setTTL = func(ttl int) error { return conn.IPv6PacketConn().SetHopLimit(ttl) }
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Duration(maxHops) * tracerouteHopWait)
+	}
+	id := rand.N(1 << 16)
+
+	var result traceResult
+	buf := make([]byte, 1500)
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		if ctx.Err() != nil {
+			return result, nil
+		}
+		if err := setTTL(ttl); err != nil {
+			return result, fmt.Errorf("failed to set TTL: %w", err)
+		}
+		request, err := (&icmp.Message{
+			Type: requestType,
+			Body: &icmp.Echo{ID: id, Seq: ttl, Data: []byte("cartographer")},
+		}).Marshal(nil)
+		if err != nil {
+			return result, err
+		}
+		sent := time.Now()
+		if _, err := conn.WriteTo(request, dst); err != nil {
+			return result, err
+		}
+
+		wait := min(tracerouteHopWait, time.Until(deadline)/time.Duration(maxHops-ttl+1))
+		conn.SetReadDeadline(sent.Add(wait))
+		var hop net.IP
+		for hop == nil {
+			n, from, err := conn.ReadFrom(buf)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break // no reply from this hop
+			}
+			if err != nil {
+				return result, err
+			}
+			var reached bool
+			hop, reached = matchTraceReply(buf[:n], from, addr, v6, datagram, id, ttl)
+			if reached {
+				result.hops = append(result.hops, hop)
+				result.reached = true
+				result.rtt = time.Since(sent)
+				return result, nil
+			}
+		}
+		result.hops = append(result.hops, hop)
+	}
+	return result, nil
+}
+
+// matchTraceReply checks whether packet answers the probe with the given TTL: an echo
+// reply from addr, or a time exceeded message quoting the probe. It returns the address
+// that answered, or nil, and whether it was the destination.
+func matchTraceReply(packet []byte, from net.Addr, addr net.IP, v6, datagram bool, id, seq int) (net.IP, bool) {
+	protocol, replyType, exceededType := protocolICMP, icmp.Type(ipv4.ICMPTypeEchoReply), icmp.Type(ipv4.ICMPTypeTimeExceeded)
+	if v6 {
+		protocol, replyType, exceededType = protocolICMPv6, ipv6.ICMPTypeEchoReply, ipv6.ICMPTypeTimeExceeded
+	}
+	msg, err := icmp.ParseMessage(protocol, packet)
+	if err != nil {
+		return nil, false
+	}
+	var source net.IP
+	switch from := from.(type) {
+	case *net.IPAddr:
+		source = from.IP
+	case *net.UDPAddr:
+		source = from.IP
+	default:
+		return nil, false
+	}
+
+	switch msg.Type {
+	case replyType:
+		// Datagram sockets only see their own replies, with the identifier the kernel chose
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || !source.Equal(addr) || echo.Seq != seq || (!datagram && echo.ID != id) {
+			return nil, false
+		}
+		return source, true
+	case exceededType:
+		exceeded, ok := msg.Body.(*icmp.TimeExceeded)
+		if !ok || !quotesEcho(exceeded.Data, v6, id, seq) {
+			return nil, false
+		}
+		return source, false
+	}
+	return nil, false
+}
+
+// quotesEcho reports whether data, the original datagram quoted in an ICMP error, is
+// our echo request with the given identifier and sequence number
+func quotesEcho(data []byte, v6 bool, id, seq int) bool {
+	headerLen := ipv6.HeaderLen
+	if !v6 {
+		if len(data) < ipv4.HeaderLen {
+			return false
+		}
+		headerLen = int(data[0]&0x0f) * 4
+	}
+	// type, code, checksum, identifier, sequence number
+	if len(data) < headerLen+8 {
+		return false
+	}
+	echo := data[headerLen:]
+	return int(binary.BigEndian.Uint16(echo[4:6])) == id && int(binary.BigEndian.Uint16(echo[6:8])) == seq
+}
@@ -0,0 +1,128 @@
+package monitors
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func TestMatchTraceReply(t *testing.T) {
+	destination := net.IPv4(192, 0, 2, 1).To4()
+	router := &net.IPAddr{IP: net.IPv4(198, 51, 100, 1)}
+	marshal := func(msg icmp.Message) []byte {
+		packet, err := msg.Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+	// The probe as quoted in a time exceeded message: a 20 byte IPv4 header and the echo request
+	probe := func(id, seq int) []byte {
+		header := make([]byte, ipv4.HeaderLen)
+		header[0] = 0x45
+		return append(header, marshal(icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: seq}})...)
+	}
+	exceeded := func(quoted []byte) []byte {
+		return marshal(icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quoted}})
+	}
+	reply := func(id, seq int) []byte {
+		return marshal(icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: id, Seq: seq}})
+	}
+
+	tests := []struct {
+		name        string
+		packet      []byte
+		from        net.Addr
+		datagram    bool
+		wantHop     net.IP
+		wantReached bool
+	}{
+		{name: "time exceeded for the probe", packet: exceeded(probe(7, 3)), from: router, wantHop: router.IP},
+		{name: "time exceeded for another probe", packet: exceeded(probe(7, 2)), from: router},
+		{name: "time exceeded for another process", packet: exceeded(probe(8, 3)), from: router},
+		{name: "truncated quote", packet: exceeded(probe(7, 3)[:24]), from: router},
+		{name: "echo reply from the destination", packet: reply(7, 3), from: &net.IPAddr{IP: destination}, wantHop: destination, wantReached: true},
+		{name: "echo reply from another host", packet: reply(7, 3), from: router},
+		{name: "echo reply to another process", packet: reply(8, 3), from: &net.IPAddr{IP: destination}},
+		{name: "datagram echo reply with the kernel's identifier", packet: reply(8, 3), from: &net.UDPAddr{IP: destination}, datagram: true, wantHop: destination, wantReached: true},
+		{name: "not icmp", packet: []byte{1}, from: router},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hop, reached := matchTraceReply(tt.packet, tt.from, destination, false, tt.datagram, 7, 3)
+			if !hop.Equal(tt.wantHop) || reached != tt.wantReached {
+				t.Errorf("matchTraceReply() = %v, %v, want %v, %v", hop, reached, tt.wantHop, tt.wantReached)
+			}
+		})
+	}
+}
+
+func TestCheckTraceroute_Loopback(t *testing.T) {
+	if conn, _, err := listenICMP(false, true); err != nil {
+		t.Skipf("ICMP sockets unavailable: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	tests := []struct {
+		name        string
+		monitor     Monitor
+		want        MonitorStatus
+		wantMessage string
+	}{
+		{name: "reached", monitor: Monitor{Host: "127.0.0.1"}, want: StatusOK, wantMessage: "TRACEROUTE 127.0.0.1: reached in 1 hops"},
+		{name: "host name", monitor: Monitor{Host: "localhost", MaxHops: 5}, want: StatusOK, wantMessage: "TRACEROUTE localhost (127.0.0.1): reached in 1 hops"},
+		{name: "hops threshold", monitor: Monitor{Host: "127.0.0.1", Thresholds: &Thresholds{Hops: limits(1, 10)}}, want: StatusWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := tt.monitor
+			monitor.Name, monitor.Type = "traceroute", "traceroute"
+			monitor.ApplyDefaults()
+			if err := monitor.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			status, message, metrics := checkTraceroute(context.Background(), monitor)
+			if status != tt.want || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("checkTraceroute() = %s %q, want %s containing %q", status, message, tt.want, tt.wantMessage)
+			}
+			if len(metrics) != 2 || metrics[0].Name != "hops" || metrics[0].Value != 1 {
+				t.Errorf("metrics = %+v, want 1 hop", metrics)
+			}
+		})
+	}
+}
+
+func TestTraceroute_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		monitor Monitor
+		wantErr string
+	}{
+		{name: "valid", monitor: Monitor{Host: "192.0.2.1", MaxHops: 10}},
+		{name: "missing host", monitor: Monitor{}, wantErr: "host is required"},
+		{name: "too many hops", monitor: Monitor{Host: "192.0.2.1", MaxHops: MaxTracerouteHops + 1}, wantErr: "max_hops must be between"},
+		{name: "packet loss threshold", monitor: Monitor{Host: "192.0.2.1", Thresholds: &Thresholds{PacketLossPercent: limits(10, 50)}}, wantErr: "only apply to ping monitors"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor := tt.monitor
+			monitor.Name, monitor.Type = "trace", "traceroute"
+			monitor.ApplyDefaults()
+			err := monitor.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}